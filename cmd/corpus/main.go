@@ -0,0 +1,67 @@
+// Command corpus runs the heuristics over a golden corpus offline and prints the labels that changed.
+//
+//	go run ./cmd/corpus -dir pkg/api/service/testdata/corpus
+//
+// Use -rules to try a rules file and -update to accept the current results as the expected ones.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	"github.com/labstack/echo/v4"
+	level "github.com/labstack/gommon/log"
+
+	"github.com/ellypaws/inkbunny-app/pkg/api/rules"
+	"github.com/ellypaws/inkbunny-app/pkg/api/service"
+)
+
+func main() {
+	dir := flag.String("dir", "corpus", "the corpus directory, with a directory per case")
+	rulesPath := flag.String("rules", os.Getenv("RULES"), "the rules file to evaluate, defaults to the built-in rules")
+	update := flag.Bool("update", false, "replace the expected results with the current ones")
+	verbose := flag.Bool("v", false, "log the heuristics")
+	flag.Parse()
+
+	if *rulesPath != "" {
+		set, err := rules.Load(*rulesPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		rules.SetActive(set)
+	}
+
+	cases, err := service.LoadCorpus(*dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	e := echo.New()
+	e.Logger.SetLevel(level.OFF)
+	if *verbose {
+		e.Logger.SetLevel(level.DEBUG)
+	}
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+
+	results, err := service.RunCorpus(c, cases)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	changed := service.WriteCorpusDiff(os.Stdout, results)
+	if *update {
+		for i := range cases {
+			cases[i].Update(results[i])
+			if err := cases[i].Write(*dir); err != nil {
+				log.Fatal(err)
+			}
+		}
+		return
+	}
+	if changed > 0 {
+		os.Exit(1)
+	}
+}
@@ -1,11 +1,13 @@
 package main
 
 import (
+	"database/sql"
 	"fmt"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -18,16 +20,18 @@ import (
 
 	"github.com/ellypaws/inkbunny-app/pkg/api"
 	"github.com/ellypaws/inkbunny-app/pkg/api/cache"
+	"github.com/ellypaws/inkbunny-app/pkg/api/rules"
 	"github.com/ellypaws/inkbunny-app/pkg/db"
 
 	sd "github.com/ellypaws/inkbunny-sd/stable_diffusion"
 )
 
 var (
-	database *db.Sqlite
+	database db.Store
 	sdHost   = sd.DefaultHost
 	apiHost  *url.URL
 	port     uint = 1323
+	corpus   string
 )
 
 func main() {
@@ -39,6 +43,7 @@ func main() {
 		LogLevel:    level.DEBUG,
 		Middlewares: middlewares,
 		Extra:       extra,
+		CorpusDir:   corpus,
 	})
 }
 
@@ -154,9 +159,34 @@ func init() {
 		log.Println("warning: SD_HOST not set, using default localhost:7860")
 	}
 
-	var err error
-	database, err = db.New(nil)
+	// rules activated through PUT /rules are stored in the database and replace these when the server starts
+	if path := os.Getenv("RULES"); path != "" {
+		set, err := rules.Load(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		rules.SetActive(set)
+		log.Printf("using rules %s from %s", set.Version, path)
+	}
+
+	corpus = os.Getenv("CORPUS_DIR")
+
+	if dsn := os.Getenv("DATABASE_URL"); dsn != "" {
+		if !slices.Contains(sql.Drivers(), "pgx") {
+			log.Fatal("DATABASE_URL is set but the postgres driver isn't registered, build the server with -tags postgres")
+		}
+		postgres, err := db.NewPostgres(nil, dsn)
+		if err != nil {
+			log.Fatal(err)
+		}
+		database = postgres
+		log.Println("using postgres from DATABASE_URL")
+		return
+	}
+
+	sqlite, err := db.New(nil)
 	if err != nil {
 		log.Fatal(err)
 	}
+	database = sqlite
 }
@@ -0,0 +1,6 @@
+//go:build postgres
+
+package main
+
+// register the pgx driver used by db.NewPostgres, build with -tags postgres
+import _ "github.com/jackc/pgx/v5/stdlib"
@@ -1,6 +1,8 @@
 package api
 
 import (
+	"database/sql"
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -11,10 +13,13 @@ import (
 )
 
 var deleteHandlers = pathHandler{
-	"/ticket/:id":       handler{deleteTicket, staffMiddleware},
-	"/artist":           handler{deleteArtist, staffMiddleware},
-	"/artist/:username": handler{deleteArtist, staffMiddleware},
-	"/auditor":          handler{deleteAuditor, staffMiddleware},
+	"/ticket/:id":         handler{deleteTicket, staffMiddleware},
+	"/artist":             handler{deleteArtist, listsMiddleware},
+	"/artist/:username":   handler{deleteArtist, listsMiddleware},
+	"/artist/consent/:id": handler{deleteArtistConsent, listsMiddleware},
+	"/character/:id":      handler{deleteCharacter, listsMiddleware},
+	"/parser/:id":         handler{deleteParserBinding, listsMiddleware},
+	"/auditor":            handler{deleteAuditor, staffMiddleware},
 }
 
 func deleteTicket(c echo.Context) error {
@@ -28,7 +33,15 @@ func deleteTicket(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, crashy.ErrorResponse{ErrorString: "invalid id"})
 	}
 
-	if err := Database.DeleteTicket(i); err != nil {
+	if err := db.Error(Database); err != nil {
+		return c.JSON(http.StatusInternalServerError, crashy.Wrap(err))
+	}
+
+	auditor, _ := GetCurrentAuditor(c)
+	if err := Database.DeleteTicket(i, auditor); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.JSON(http.StatusNotFound, crashy.ErrorResponse{ErrorString: "ticket not found"})
+		}
 		return c.JSON(http.StatusInternalServerError, crashy.Wrap(err))
 	}
 
@@ -61,6 +74,69 @@ func deleteArtist(c echo.Context) error {
 	return c.JSON(http.StatusOK, artists)
 }
 
+func deleteArtistConsent(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, crashy.ErrorResponse{ErrorString: "invalid id"})
+	}
+
+	if err := db.Error(Database); err != nil {
+		return c.JSON(http.StatusInternalServerError, crashy.Wrap(err))
+	}
+
+	err = Database.DeleteArtistConsent(id)
+	if errors.Is(err, db.ErrMissingConsent) {
+		return c.JSON(http.StatusNotFound, crashy.Wrap(err))
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, crashy.Wrap(err))
+	}
+
+	return c.JSON(http.StatusOK, db.ArtistConsent{ID: id})
+}
+
+func deleteCharacter(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, crashy.ErrorResponse{ErrorString: "invalid id"})
+	}
+
+	if err := db.Error(Database); err != nil {
+		return c.JSON(http.StatusInternalServerError, crashy.Wrap(err))
+	}
+
+	err = Database.DeleteCharacter(id)
+	if errors.Is(err, db.ErrMissingCharacter) {
+		return c.JSON(http.StatusNotFound, crashy.Wrap(err))
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, crashy.Wrap(err))
+	}
+
+	return c.JSON(http.StatusOK, db.Character{ID: id})
+}
+
+func deleteParserBinding(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, crashy.ErrorResponse{ErrorString: "invalid id"})
+	}
+
+	if err := db.Error(Database); err != nil {
+		return c.JSON(http.StatusInternalServerError, crashy.Wrap(err))
+	}
+
+	err = Database.DeleteParserBinding(id)
+	if errors.Is(err, db.ErrMissingParserBinding) {
+		return c.JSON(http.StatusNotFound, crashy.Wrap(err))
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, crashy.Wrap(err))
+	}
+
+	return c.JSON(http.StatusOK, db.ParserBinding{ID: id})
+}
+
 func deleteAuditor(c echo.Context) error {
 	var auditors []db.Auditor
 	if err := c.Bind(&auditors); err != nil {
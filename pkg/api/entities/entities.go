@@ -1,8 +1,12 @@
 package entities
 
 import (
+	"encoding/json"
+
 	"github.com/ellypaws/inkbunny/api"
 
+	"github.com/ellypaws/inkbunny-app/pkg/api/rules"
+	"github.com/ellypaws/inkbunny-app/pkg/db"
 	"github.com/ellypaws/inkbunny-sd/llm"
 )
 
@@ -38,3 +42,39 @@ type DescriptionResponse struct {
 type PrefillRequest struct {
 	Description string `json:"description"`
 }
+
+type RulesRequest struct {
+	Rules      json.RawMessage `json:"rules"`
+	Submission *db.Submission  `json:"submission,omitempty"`
+}
+
+type RulesValidation struct {
+	Valid    bool            `json:"valid"`
+	Error    string          `json:"error,omitempty"`
+	Version  string          `json:"version,omitempty"`
+	Matches  []rules.Match   `json:"matches,omitempty"`
+	Revision *rules.Revision `json:"revision,omitempty"` // The ACP revision in force when the submission was updated
+	Subject  string          `json:"subject,omitempty"`
+}
+
+// ParserTestRequest runs a saved parser, or an unsaved definition, over a sample attachment.
+type ParserTestRequest struct {
+	Parser     string               `json:"parser,omitempty"`
+	Definition *db.ParserDefinition `json:"definition,omitempty"`
+	Text       string               `json:"text"`
+	FileName   string               `json:"file_name,omitempty"`
+}
+
+// ParserActivation activates a parser definition for the artists in UserIDs.
+type ParserActivation struct {
+	UserIDs []int64 `json:"user_ids"`
+}
+
+// ParserActivated is the result of activating a parser definition.
+// Resolved lists the cannot_parse tickets the parser could read, Failed the ones it still couldn't or that failed to save.
+type ParserActivated struct {
+	Definition db.ParserDefinition `json:"definition"`
+	Bindings   []db.ParserBinding  `json:"bindings"`
+	Resolved   []int64             `json:"resolved,omitempty"`
+	Failed     map[int64]string    `json:"failed,omitempty"`
+}
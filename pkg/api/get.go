@@ -1,6 +1,7 @@
 package api
 
 import (
+	"database/sql"
 	_ "embed"
 	"encoding/json"
 	"errors"
@@ -12,6 +13,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/ellypaws/inkbunny/api"
 	"github.com/labstack/echo/v4"
@@ -20,6 +22,7 @@ import (
 
 	"github.com/ellypaws/inkbunny-app/pkg/api/cache"
 	. "github.com/ellypaws/inkbunny-app/pkg/api/entities"
+	"github.com/ellypaws/inkbunny-app/pkg/api/rules"
 	"github.com/ellypaws/inkbunny-app/pkg/api/service"
 	"github.com/ellypaws/inkbunny-app/pkg/app"
 	"github.com/ellypaws/inkbunny-app/pkg/crashy"
@@ -41,13 +44,23 @@ var getHandlers = pathHandler{
 	"/heuristics/:id":           handler{GetHeuristicsHandler, append(reducedMiddleware, WithRedis...)},
 	"/audits":                   handler{GetAuditHandler, staffMiddleware},
 	"/tickets":                  handler{GetTicketsHandler, staffMiddleware},
+	"/tickets/submission/:id":   handler{GetSubmissionTicketsHandler, staffMiddleware},
+	"/tickets/user/:user":       handler{GetUserTicketsHandler, staffMiddleware},
+	"/ticket/:id/history":       handler{GetTicketHistoryHandler, staffMiddleware},
 	"/auditors":                 handler{GetAllAuditorsJHandler, staffMiddleware},
 	"/username/:username":       handler{GetUsernameHandler, append(loggedInMiddleware, WithRedis...)},
 	"/avatar/:username":         handler{GetAvatarHandler, StaticMiddleware},
 	"/artists":                  handler{GetArtistsHandler, append(loggedInMiddleware, WithRedis...)},
+	"/artists/consents":         handler{GetArtistConsentsHandler, staffMiddleware},
+	"/characters":               handler{GetCharactersHandler, staffMiddleware},
+	"/parsers":                  handler{GetParsersHandler, staffMiddleware},
 	"/models":                   handler{GetModelsHandler, withCache},
 	"/models/:hash":             handler{GetModelsHandler, WithRedis},
 	"/files/:file":              handler{GetFileHandler, StaticMiddleware},
+	"/rules":                    handler{GetRulesHandler, nil},
+	"/submissions/:id":          handler{GetSubmissionHistoryHandler, staffMiddleware},
+	"/search/local":             handler{GetLocalSearchHandler, staffMiddleware},
+	"/reevaluation":             handler{GetReevaluationHandler, staffMiddleware},
 }
 
 // Deprecated: use registerAs((*echo.Echo).GET, getHandlers) instead
@@ -401,29 +414,158 @@ func GetAuditHandler(c echo.Context) error {
 	return c.JSON(http.StatusOK, audits)
 }
 
+// GetTicketsHandler returns a page of tickets matching the query parameters.
+// Filters: status, label, priority, closed, assigned_id, reported, reporter, submission_id,
+// opened_after, opened_before, closed_after and closed_before as RFC 3339 or 2006-01-02.
+// Use sort (id, date_opened, date_closed or priority, prefixed with - for descending), limit,
+// and cursor set to the next_cursor of the previous page.
 func GetTicketsHandler(c echo.Context) error {
-	assignedID := c.QueryParam("assigned_id")
+	if err := db.Error(Database); err != nil {
+		return c.JSON(http.StatusInternalServerError, crashy.Wrap(err))
+	}
 
-	if assignedID != "" {
-		p, err := strconv.ParseInt(assignedID, 10, 64)
-		if err != nil {
+	query, err := ticketQuery(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, crashy.Wrap(err))
+	}
+
+	page, err := Database.QueryTickets(query)
+	if err != nil {
+		if errors.Is(err, db.ErrInvalidSort) || errors.Is(err, db.ErrInvalidCursor) {
 			return c.JSON(http.StatusBadRequest, crashy.Wrap(err))
 		}
+		return c.JSON(http.StatusInternalServerError, crashy.Wrap(err))
+	}
+
+	return c.JSON(http.StatusOK, page)
+}
+
+func ticketQuery(c echo.Context) (db.TicketQuery, error) {
+	query := db.TicketQuery{
+		Status:   c.QueryParam("status"),
+		Label:    db.TicketLabel(c.QueryParam("label")),
+		Priority: c.QueryParam("priority"),
+		Reported: c.QueryParam("reported"),
+		Reporter: c.QueryParam("reporter"),
+		Sort:     c.QueryParam("sort"),
+		Cursor:   c.QueryParam("cursor"),
+	}
+
+	if closed := c.QueryParam("closed"); closed != "" {
+		b, err := strconv.ParseBool(closed)
+		if err != nil {
+			return query, fmt.Errorf("invalid closed: %w", err)
+		}
+		query.Closed = &b
+	}
 
-		tickets, err := Database.GetTicketsByAuditor(p)
+	if submissionID := c.QueryParam("submission_id"); submissionID != "" {
+		i, err := strconv.ParseInt(submissionID, 10, 64)
 		if err != nil {
-			return c.JSON(http.StatusInternalServerError, crashy.Wrap(err))
+			return query, fmt.Errorf("invalid submission_id: %w", err)
 		}
+		query.SubmissionID = i
+	}
+
+	if assignedID := c.QueryParam("assigned_id"); assignedID != "" {
+		i, err := strconv.ParseInt(assignedID, 10, 64)
+		if err != nil {
+			return query, fmt.Errorf("invalid assigned_id: %w", err)
+		}
+		query.AssignedID = &i
+	}
+
+	if limit := c.QueryParam("limit"); limit != "" {
+		i, err := strconv.Atoi(limit)
+		if err != nil {
+			return query, fmt.Errorf("invalid limit: %w", err)
+		}
+		query.Limit = i
+	}
+
+	for param, value := range map[string]**time.Time{
+		"opened_after":  &query.OpenedAfter,
+		"opened_before": &query.OpenedBefore,
+		"closed_after":  &query.ClosedAfter,
+		"closed_before": &query.ClosedBefore,
+	} {
+		v := c.QueryParam(param)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			t, err = time.Parse(time.DateOnly, v)
+		}
+		if err != nil {
+			return query, fmt.Errorf("invalid %s, expected RFC 3339 or %s: %w", param, time.DateOnly, err)
+		}
+		*value = &t
+	}
+
+	return query, nil
+}
+
+// GetSubmissionTicketsHandler returns every ticket about a submission.
+func GetSubmissionTicketsHandler(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, crashy.ErrorResponse{ErrorString: "invalid submission id", Debug: err})
+	}
+
+	if err := db.Error(Database); err != nil {
+		return c.JSON(http.StatusInternalServerError, crashy.Wrap(err))
+	}
+
+	tickets, err := Database.GetTicketsBySubmission(id)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return c.JSON(http.StatusInternalServerError, crashy.Wrap(err))
+	}
+
+	return c.JSON(http.StatusOK, append([]db.Ticket{}, tickets...))
+}
+
+// GetUserTicketsHandler returns every ticket a user reported or was reported in, by user ID or username.
+func GetUserTicketsHandler(c echo.Context) error {
+	user := c.Param("user")
+	if user == "" {
+		return c.JSON(http.StatusBadRequest, crashy.ErrorResponse{ErrorString: "missing user"})
+	}
+
+	if err := db.Error(Database); err != nil {
+		return c.JSON(http.StatusInternalServerError, crashy.Wrap(err))
+	}
+
+	tickets, err := Database.GetTicketsByUser(user)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return c.JSON(http.StatusInternalServerError, crashy.Wrap(err))
+	}
+
+	return c.JSON(http.StatusOK, append([]db.Ticket{}, tickets...))
+}
+
+// GetTicketHistoryHandler returns every change made to a ticket, oldest first.
+// The history is kept after the ticket is deleted.
+func GetTicketHistoryHandler(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, crashy.ErrorResponse{ErrorString: "invalid ticket id", Debug: err})
+	}
 
-		return c.JSON(http.StatusOK, tickets)
+	if err := db.Error(Database); err != nil {
+		return c.JSON(http.StatusInternalServerError, crashy.Wrap(err))
 	}
 
-	tickets, err := Database.GetAllTickets()
+	events, err := Database.GetTicketEvents(id)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, crashy.Wrap(err))
 	}
 
-	return c.JSON(http.StatusOK, tickets)
+	if len(events) == 0 {
+		return c.JSON(http.StatusNotFound, crashy.ErrorResponse{ErrorString: "ticket has no history"})
+	}
+
+	return c.JSON(http.StatusOK, events)
 }
 
 func validAuditor(c echo.Context, user api.Credentials) bool {
@@ -466,6 +608,7 @@ func GetAllAuditorsJHandler(c echo.Context) error {
 //   - Set query "interrogate" to "true" to parse entities.TaggerResponse from image files using (*sd.Host).Interrogate
 //   - Set query "stream" to "true" to receive multiple JSON objects
 //   - Set the param ":id" to "search" to combine search to immediately review
+//   - Set query "seed_range" for report outputs to only group images with the same prompt when their seeds are within the range
 func GetReviewHandler(c echo.Context) error {
 	sid, err := GetSID(c)
 	if err != nil {
@@ -504,6 +647,11 @@ func GetReviewHandler(c echo.Context) error {
 		})
 	}
 
+	seedRange, err := seedRangeParam(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, crashy.ErrorResponse{ErrorString: "invalid seed_range", Debug: err})
+	}
+
 	cacheToUse := cache.SwitchCache(c)
 	query := url.Values{
 		"interrogate": {interrogate},
@@ -550,13 +698,7 @@ func GetReviewHandler(c echo.Context) error {
 	} else {
 		key = strings.Join(submissionIDSlice, ",")
 	}
-	reviewKey := fmt.Sprintf(
-		"%s:review:%s:%s?%s",
-		echo.MIMEApplicationJSON,
-		output,
-		key,
-		query.Encode(),
-	)
+	reviewKey := service.ReviewKey(output, key, query)
 
 	var processed []service.Detail
 	var missed = submissionIDSlice
@@ -577,6 +719,7 @@ func GetReviewHandler(c echo.Context) error {
 				Database:      Database,
 				ApiHost:       ServerHost,
 				Auditor:       auditor,
+				SeedRange:     seedRange,
 			},
 		)
 		if errFunc != nil {
@@ -619,6 +762,9 @@ func GetReviewHandler(c echo.Context) error {
 	details := service.ProcessResponse(c, &service.Config{
 		SubmissionDetails: submissionDetails,
 		Artists:           Database.AllArtists(),
+		Characters:        Database.AllCharacters(),
+		Database:          Database,
+		Queue:             Queue,
 		Cache:             cacheToUse,
 		Host:              SDHost,
 		Output:            output,
@@ -642,7 +788,7 @@ func GetReviewHandler(c echo.Context) error {
 		}
 		store = tickets
 	case service.OutputReport, service.OutputReportIDs:
-		report := service.CreateTicketReport(auditor, details, ServerHost)
+		report := service.CreateTicketReport(auditor, details, ServerHost, seedRange)
 		service.StoreReport(c, Database, report)
 		store = report
 	case service.OutputSingleTicket:
@@ -667,19 +813,33 @@ func GetReviewHandler(c echo.Context) error {
 	return c.JSON(http.StatusOK, store)
 }
 
-// GetReportHandler returns a report analysis of an artist
-// Set query "limit" to limit the number of submissions returned
+// seedRangeParam parses query "seed_range" for service.FlagTooMany, it defaults to 0.
+func seedRangeParam(c echo.Context) (int64, error) {
+	q := c.QueryParam("seed_range")
+	if q == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(q, 10, 64)
+}
+
+// GetReportHandler returns a report analysis of an artist across all their AI submissions
+// Set query "limit" to set the number of submissions retrieved per page of the search
 // Set query "text" to use a custom search term
+// Set query "seed_range" to only group images with the same prompt when their seeds are within the range
 func GetReportHandler(c echo.Context) error {
 	artist := c.Param("id")
 	cacheToUse := cache.SwitchCache(c)
 	limitQuery := c.QueryParam("limit")
 
+	seedRange, err := seedRangeParam(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, crashy.ErrorResponse{ErrorString: "invalid seed_range", Debug: err})
+	}
+
 	var limit int
 	if limitQuery == "" {
-		limit = 10
+		limit = 100
 	} else {
-		var err error
 		limit, err = strconv.Atoi(limitQuery)
 		if err != nil {
 			return c.JSON(http.StatusBadRequest, crashy.ErrorResponse{ErrorString: "invalid limit", Debug: err})
@@ -702,17 +862,21 @@ func GetReportHandler(c echo.Context) error {
 
 	hashed := db.Hash(sid)
 
-	submissions, err := service.RetrieveSearch(c, api.SubmissionSearchRequest{
+	search := api.SubmissionSearchRequest{
 		SID:                sid,
 		Username:           artist,
 		SubmissionsPerPage: api.IntString(limit),
 		SubmissionIDsOnly:  true,
 		GetRID:             true,
 		KeywordID:          db.AIGeneratedID,
-	})
+	}
+	submissions, err := service.RetrieveSearch(c, search)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, crashy.Wrap(err))
 	}
+	if err := service.RetrieveSearchPages(c, search, &submissions); err != nil {
+		return c.JSON(http.StatusInternalServerError, crashy.Wrap(err))
+	}
 
 	if len(submissions.Submissions) == 0 {
 		return c.JSON(http.StatusNotFound, crashy.ErrorResponse{ErrorString: "no submissions found"})
@@ -721,6 +885,11 @@ func GetReportHandler(c echo.Context) error {
 	var missed []string
 	var processed []service.Detail
 
+	query := url.Values{
+		"interrogate": {""},
+		"parameters":  {"true"},
+		"sid":         {hashed},
+	}
 	skipCache := c.Request().Header.Get(echo.HeaderCacheControl) == "no-cache"
 	for _, submission := range submissions.Submissions {
 		if skipCache {
@@ -728,13 +897,7 @@ func GetReportHandler(c echo.Context) error {
 			continue
 		}
 
-		key := fmt.Sprintf(
-			"%s:review:%s:%s?interrogate=&parameters=true&sid=%s",
-			echo.MIMEApplicationJSON,
-			service.OutputBadges,
-			submission.SubmissionID,
-			hashed,
-		)
+		key := service.ReviewKey(service.OutputBadges, submission.SubmissionID, query)
 		item, errFunc := cacheToUse.Get(key)
 		if errFunc == nil {
 			var detail service.Detail
@@ -775,6 +938,9 @@ func GetReportHandler(c echo.Context) error {
 		details := service.ProcessResponse(c, &service.Config{
 			SubmissionDetails: submissionDetails,
 			Artists:           Database.AllArtists(),
+			Characters:        Database.AllCharacters(),
+			Database:          Database,
+			Queue:             Queue,
 			Cache:             cacheToUse,
 			Host:              SDHost,
 			Output:            service.OutputBadges,
@@ -782,18 +948,16 @@ func GetReportHandler(c echo.Context) error {
 			Interrogate:       false,
 			Auditor:           auditor,
 			ApiHost:           ServerHost,
-			Query: url.Values{
-				"interrogate": {""},
-				"parameters":  {"true"},
-				"sid":         {hashed},
-			},
-			Writer: c.Get("writer").(http.Flusher),
+			Query:             query,
+			Writer:            c.Get("writer").(http.Flusher),
 		})
 
 		processed = append(processed, details...)
 	}
 
+	tooMany := service.FlagTooMany(processed, seedRange)
 	out := service.CreateReport(processed, auditor, ServerHost)
+	out.TooMany = tooMany
 
 	var store any
 	date := out.ReportDate.Format("2006-01-02")
@@ -925,6 +1089,7 @@ func GetHeuristicsHandler(c echo.Context) error {
 
 	cacheToUse := cache.SwitchCache(c)
 	artists := Database.AllArtists()
+	characters := Database.AllCharacters()
 
 	writer := c.Get("writer").(http.Flusher)
 
@@ -935,7 +1100,7 @@ func GetHeuristicsHandler(c echo.Context) error {
 
 		submission := service.InkbunnySubmissionToDBSubmission(sub, true)
 		go func(wg *sync.WaitGroup, sub *db.Submission) {
-			service.RetrieveParams(c, wg, sub, cacheToUse, artists)
+			service.RetrieveParams(c, wg, sub, cacheToUse, Database, artists, characters)
 
 			if c.QueryParam("stream") == "true" {
 				mutex.Lock()
@@ -1121,6 +1286,51 @@ func GetArtistsHandler(c echo.Context) error {
 	return c.JSON(http.StatusOK, artistsWithIcon)
 }
 
+// GetArtistConsentsHandler returns the recorded artist consents, including expired ones
+// Set query "artist" to only return the consents of one artist
+func GetArtistConsentsHandler(c echo.Context) error {
+	if err := db.Error(Database); err != nil {
+		return c.JSON(http.StatusInternalServerError, crashy.Wrap(err))
+	}
+
+	consents, err := Database.GetArtistConsents(c.QueryParam("artist"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, crashy.Wrap(err))
+	}
+	if consents == nil {
+		consents = []db.ArtistConsent{}
+	}
+
+	return c.JSON(http.StatusOK, consents)
+}
+
+// GetCharactersHandler returns the registered characters and their owners
+func GetCharactersHandler(c echo.Context) error {
+	if err := db.Error(Database); err != nil {
+		return c.JSON(http.StatusInternalServerError, crashy.Wrap(err))
+	}
+
+	characters := Database.AllCharacters()
+	if characters == nil {
+		characters = []db.Character{}
+	}
+
+	return c.JSON(http.StatusOK, characters)
+}
+
+// GetParsersHandler returns the registered parameter parsers, the bindings that pick them and the parser definitions
+func GetParsersHandler(c echo.Context) error {
+	if err := db.Error(Database); err != nil {
+		return c.JSON(http.StatusInternalServerError, crashy.Wrap(err))
+	}
+
+	return c.JSON(http.StatusOK, service.ParserRegistry{
+		Parsers:     service.Parsers(),
+		Bindings:    service.ParserBindings(Database),
+		Definitions: Database.AllParserDefinitions(),
+	})
+}
+
 // GetModelsHandler returns a list of known models
 // Set query "civitai" to "true" to return civitai.CivitAIModel
 // Set query "recache" to "true" to force a recache (slow)
@@ -1189,3 +1399,85 @@ func GetModelsHandler(c echo.Context) error {
 
 	return c.JSON(http.StatusOK, match)
 }
+
+// GetRulesHandler returns the active ACP rule set used to label submissions.
+// Set query "facts" to "true" to also list the facts rule conditions can use.
+func GetRulesHandler(c echo.Context) error {
+	if c.QueryParam("facts") == "true" {
+		facts := rules.Facts()
+		slices.Sort(facts)
+		return c.JSON(http.StatusOK, struct {
+			*rules.Set
+			Facts []string `json:"facts"`
+		}{rules.Active(), facts})
+	}
+	return c.JSON(http.StatusOK, rules.Active())
+}
+
+// GetSubmissionHistoryHandler returns every stored version of a reviewed submission, oldest first.
+func GetSubmissionHistoryHandler(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, crashy.ErrorResponse{ErrorString: "invalid submission id", Debug: err})
+	}
+
+	if err := db.Error(Database); err != nil {
+		return c.JSON(http.StatusInternalServerError, crashy.Wrap(err))
+	}
+
+	history, err := Database.GetSubmissionHistory(id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, crashy.Wrap(err))
+	}
+
+	if len(history) == 0 {
+		return c.JSON(http.StatusNotFound, crashy.ErrorResponse{ErrorString: "submission has not been reviewed"})
+	}
+
+	return c.JSON(http.StatusOK, history)
+}
+
+// GetReevaluationHandler returns the current service.Version and the report of the last re-evaluation of stored submissions.
+func GetReevaluationHandler(c echo.Context) error {
+	reevaluation.Lock()
+	defer reevaluation.Unlock()
+	return c.JSON(http.StatusOK, service.ReevaluationStatus{
+		Version: service.Version(),
+		Running: reevaluation.running,
+		Last:    reevaluation.last,
+	})
+}
+
+// GetLocalSearchHandler searches the reviewed submissions and tickets stored in the database.
+// Use q for the query, kind to only return submissions or tickets, and limit for the number of hits.
+func GetLocalSearchHandler(c echo.Context) error {
+	query := strings.TrimSpace(c.QueryParam("q"))
+	if query == "" {
+		return c.JSON(http.StatusBadRequest, crashy.ErrorResponse{ErrorString: "missing query"})
+	}
+
+	kind := c.QueryParam("kind")
+	if kind != "" && kind != db.SearchSubmission && kind != db.SearchTicket {
+		return c.JSON(http.StatusBadRequest, crashy.ErrorResponse{ErrorString: fmt.Sprintf("kind must be %s or %s", db.SearchSubmission, db.SearchTicket)})
+	}
+
+	var limit int
+	if l := c.QueryParam("limit"); l != "" {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, crashy.ErrorResponse{ErrorString: "invalid limit", Debug: err})
+		}
+	}
+
+	if err := db.Error(Database); err != nil {
+		return c.JSON(http.StatusInternalServerError, crashy.Wrap(err))
+	}
+
+	hits, err := Database.Search(query, kind, limit)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, crashy.Wrap(err))
+	}
+
+	return c.JSON(http.StatusOK, hits)
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/labstack/echo/v4"
 
 	"github.com/ellypaws/inkbunny-app/pkg/api/cache"
+	"github.com/ellypaws/inkbunny-app/pkg/api/service"
 	"github.com/ellypaws/inkbunny-app/pkg/crashy"
 	"github.com/ellypaws/inkbunny-app/pkg/db"
 )
@@ -189,6 +190,29 @@ func Anonymous(next echo.HandlerFunc) echo.HandlerFunc {
 
 var staffMiddleware = []echo.MiddlewareFunc{LoggedInMiddleware, RequireAuditor}
 
+// UpdatesLists compares the artists, characters and parser bindings before and after a handler changed them,
+// then moves the cache keys to the new lists and re-evaluates the stored submissions the changed entries affect,
+// see service.UpdateListsRevision and service.ListChanges.
+func UpdatesLists(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if Database == nil {
+			return next(c)
+		}
+		before := service.ReadLists(Database)
+		err := next(c)
+		if c.Response().Status < http.StatusBadRequest {
+			after := service.ReadLists(Database)
+			if changes := before.Changes(after); !changes.Empty() {
+				service.UpdateListsRevision(after)
+				go reevaluate(c.Echo(), changes)
+			}
+		}
+		return err
+	}
+}
+
+var listsMiddleware = []echo.MiddlewareFunc{LoggedInMiddleware, RequireAuditor, UpdatesLists}
+
 var reducedMiddleware = []echo.MiddlewareFunc{RequireSID, TryAuditor}
 
 var reportMiddleware = []echo.MiddlewareFunc{SIDMiddleware, TryAuditor}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"errors"
 	"net/http"
 	"slices"
 
@@ -12,11 +13,13 @@ import (
 )
 
 var patchHandlers = pathHandler{
-	"/ticket":  handler{updateTicket, staffMiddleware},
-	"/artist":  handler{upsertArtist, staffMiddleware},
-	"/auditor": handler{upsertAuditor, staffMiddleware},
-	"/models":  handler{upsertModel, staffMiddleware},
-	"/report":  handler{PatchReport, append(reducedMiddleware, WithRedis...)},
+	"/ticket":         handler{updateTicket, staffMiddleware},
+	"/artist":         handler{upsertArtist, listsMiddleware},
+	"/artist/consent": handler{updateArtistConsent, listsMiddleware},
+	"/character":      handler{updateCharacter, listsMiddleware},
+	"/auditor":        handler{upsertAuditor, staffMiddleware},
+	"/models":         handler{upsertModel, staffMiddleware},
+	"/report":         handler{PatchReport, append(reducedMiddleware, WithRedis...)},
 }
 
 func updateTicket(c echo.Context) error {
@@ -33,14 +36,17 @@ func updateTicket(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, crashy.ErrorResponse{ErrorString: "missing date opened"})
 	}
 
-	id, err := Database.UpsertTicket(ticket)
+	auditor, _ := GetCurrentAuditor(c)
+	id, err := Database.UpsertTicket(ticket, auditor)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, crashy.Wrap(err))
 	}
 
-	if ticket.ID != id {
+	if ticket.ID != 0 && ticket.ID != id {
 		return c.JSON(http.StatusInternalServerError, crashy.ErrorResponse{ErrorString: "got the wrong ticket back from the database", Debug: ticket})
 	}
+	ticket.ID = id
+
 	return c.JSON(http.StatusOK, ticket)
 }
 
@@ -71,6 +77,68 @@ func upsertArtist(c echo.Context) error {
 	return c.JSON(http.StatusOK, artists)
 }
 
+// updateArtistConsent replaces the stored consent with the same ID
+func updateArtistConsent(c echo.Context) error {
+	var consent db.ArtistConsent
+	if err := c.Bind(&consent); err != nil {
+		return c.JSON(http.StatusBadRequest, crashy.Wrap(err))
+	}
+
+	if err := db.Error(Database); err != nil {
+		return c.JSON(http.StatusInternalServerError, crashy.Wrap(err))
+	}
+
+	if consent.ID == 0 {
+		return c.JSON(http.StatusBadRequest, crashy.ErrorResponse{ErrorString: "missing id", Debug: consent})
+	}
+	if consent.Artist == "" {
+		return c.JSON(http.StatusBadRequest, crashy.ErrorResponse{ErrorString: "missing artist", Debug: consent})
+	}
+	if consent.GrantedBy == "" {
+		consent.GrantedBy = consent.Artist
+	}
+
+	_, err := Database.UpsertArtistConsent(consent)
+	if errors.Is(err, db.ErrMissingConsent) {
+		return c.JSON(http.StatusNotFound, crashy.Wrap(err))
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, crashy.Wrap(err))
+	}
+
+	return c.JSON(http.StatusOK, consent)
+}
+
+// updateCharacter replaces the stored character with the same ID
+func updateCharacter(c echo.Context) error {
+	var character db.Character
+	if err := c.Bind(&character); err != nil {
+		return c.JSON(http.StatusBadRequest, crashy.Wrap(err))
+	}
+
+	if err := db.Error(Database); err != nil {
+		return c.JSON(http.StatusInternalServerError, crashy.Wrap(err))
+	}
+
+	if character.ID == 0 {
+		return c.JSON(http.StatusBadRequest, crashy.ErrorResponse{ErrorString: "missing id", Debug: character})
+	}
+	if character.Name == "" || character.Owner == "" {
+		return c.JSON(http.StatusBadRequest, crashy.ErrorResponse{ErrorString: "missing name or owner", Debug: character})
+	}
+
+	character.Matches = nil
+	_, err := Database.UpsertCharacter(character)
+	if errors.Is(err, db.ErrMissingCharacter) {
+		return c.JSON(http.StatusNotFound, crashy.Wrap(err))
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, crashy.Wrap(err))
+	}
+
+	return c.JSON(http.StatusOK, character)
+}
+
 func upsertAuditor(c echo.Context) error {
 	var auditors []db.Auditor
 	if err := c.Bind(&auditors); err != nil {
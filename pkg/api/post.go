@@ -3,9 +3,12 @@ package api
 import (
 	"bytes"
 	"encoding/base64"
+	"encoding/json"
+	"fmt"
 	"image"
 	"io"
 	"net/http"
+	"slices"
 	"strconv"
 	"time"
 
@@ -14,7 +17,9 @@ import (
 	"github.com/go-errors/errors"
 	"github.com/labstack/echo/v4"
 
+	"github.com/ellypaws/inkbunny-app/pkg/api/cache"
 	. "github.com/ellypaws/inkbunny-app/pkg/api/entities"
+	"github.com/ellypaws/inkbunny-app/pkg/api/rules"
 	"github.com/ellypaws/inkbunny-app/pkg/api/service"
 	"github.com/ellypaws/inkbunny-app/pkg/crashy"
 	"github.com/ellypaws/inkbunny-app/pkg/db"
@@ -24,24 +29,29 @@ import (
 )
 
 var postHandlers = pathHandler{
-	"/login":              handler{login, nil},
-	"/guest":              handler{guest, nil},
-	"/logout":             handler{logout, loggedInMiddleware},
-	"/validate":           handler{validate, loggedInMiddleware},
-	"/llm":                handler{inference, nil},
-	"/llm/json":           handler{stable, nil},
-	"/prefill":            handler{prefill, nil},
-	"/interrogate":        handler{interrogate, nil},
-	"/interrogate/upload": handler{interrogateImage, nil},
-	"/review/:id":         handler{GetReviewHandler, append(reducedMiddleware, WithRedis...)},
-	"/report":             handler{PatchReport, append(reducedMiddleware, WithRedis...)},
-	"/heuristics":         handler{heuristics, nil},
-	"/heuristics/:id":     handler{GetHeuristicsHandler, append(reducedMiddleware, WithRedis...)},
-	"/sd/:path":           handler{HandlePath, nil},
-	"/artists":            handler{upsertArtist, staffMiddleware},
-	"/inkbunny/search":    handler{GetInkbunnySearch, append(loggedInMiddleware, WithRedis...)},
-	"/inkbunny/sorter":    handler{GetSorterHandler, append(reducedMiddleware, WithRedis...)},
-	"/generate":           handler{generate, append(staffMiddleware, WithRedis...)},
+	"/login":                          handler{login, nil},
+	"/guest":                          handler{guest, nil},
+	"/logout":                         handler{logout, loggedInMiddleware},
+	"/validate":                       handler{validate, loggedInMiddleware},
+	"/llm":                            handler{inference, nil},
+	"/llm/json":                       handler{stable, nil},
+	"/prefill":                        handler{prefill, nil},
+	"/interrogate":                    handler{interrogate, nil},
+	"/interrogate/upload":             handler{interrogateImage, nil},
+	"/review/:id":                     handler{GetReviewHandler, append(reducedMiddleware, WithRedis...)},
+	"/report":                         handler{PatchReport, append(reducedMiddleware, WithRedis...)},
+	"/heuristics":                     handler{heuristics, nil},
+	"/heuristics/:id":                 handler{GetHeuristicsHandler, append(reducedMiddleware, WithRedis...)},
+	"/sd/:path":                       handler{HandlePath, nil},
+	"/artists":                        handler{upsertArtist, staffMiddleware},
+	"/inkbunny/search":                handler{GetInkbunnySearch, append(loggedInMiddleware, WithRedis...)},
+	"/inkbunny/sorter":                handler{GetSorterHandler, append(reducedMiddleware, WithRedis...)},
+	"/generate":                       handler{generate, append(staffMiddleware, WithRedis...)},
+	"/rules/validate":                 handler{validateRules, staffMiddleware},
+	"/parser/test":                    handler{testParser, staffMiddleware},
+	"/reevaluation":                   handler{startReevaluation, staffMiddleware},
+	"/parser/definition/:id/activate": handler{activateParserDefinition, append(listsMiddleware, WithRedis...)},
+	"/corpus/:id":                     handler{addCorpusCase, staffMiddleware},
 }
 
 // Deprecated: use registerAs((*echo.Echo).POST, postHandlers) instead
@@ -597,3 +607,305 @@ func generate(c echo.Context) error {
 	}
 	return c.JSON(http.StatusOK, responses)
 }
+
+// validateRules parses a rule file and evaluates it against a sample submission without activating it.
+// The rules can be sent as a YAML/JSON string or as a JSON object.
+//
+//	{
+//		"rules": "version: ...",
+//		"submission": {"metadata": {"ai_submission": true}, ...}
+//	}
+func validateRules(c echo.Context) error {
+	var request RulesRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, crashy.Wrap(err))
+	}
+
+	set, err := parseRules(request.Rules)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, RulesValidation{Valid: false, Error: err.Error()})
+	}
+
+	validation := RulesValidation{
+		Valid:   true,
+		Version: set.Version,
+	}
+	if request.Submission != nil {
+		validation.Matches = set.Evaluate(request.Submission)
+		validation.Revision = set.RevisionAt(request.Submission.Updated)
+		validation.Subject = set.SubjectFor(set.Labels(request.Submission))
+	}
+
+	return c.JSON(http.StatusOK, validation)
+}
+
+func parseRules(raw json.RawMessage) (*rules.Set, error) {
+	source, err := rulesSource(raw)
+	if err != nil {
+		return nil, err
+	}
+	return rules.Parse(source)
+}
+
+// rulesSource returns the rules of a request, sent either as a YAML or JSON string or as a JSON object.
+func rulesSource(raw json.RawMessage) ([]byte, error) {
+	if len(raw) == 0 {
+		return nil, errors.New("rules are required")
+	}
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return []byte(text), nil
+	}
+	return raw, nil
+}
+
+// testParser runs a registered parser, or a parser definition that isn't saved yet, over a sample attachment
+// and returns the objects it found.
+func testParser(c echo.Context) error {
+	var request ParserTestRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, crashy.Wrap(err))
+	}
+
+	if request.Text == "" {
+		return c.JSON(http.StatusBadRequest, crashy.ErrorResponse{ErrorString: "missing text"})
+	}
+	if request.FileName == "" {
+		request.FileName = "sample.txt"
+	}
+
+	var parser service.Parser
+	switch {
+	case request.Definition != nil:
+		var err error
+		parser, err = service.DefinitionParser(*request.Definition)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, crashy.ErrorResponse{ErrorString: err.Error(), Debug: request.Definition})
+		}
+	case request.Parser != "":
+		var ok bool
+		parser, ok = service.LookupParser(request.Parser)
+		if !ok {
+			return c.JSON(http.StatusBadRequest, crashy.ErrorResponse{ErrorString: "unknown parser", Debug: service.Parsers()})
+		}
+	default:
+		return c.JSON(http.StatusBadRequest, crashy.ErrorResponse{ErrorString: "missing parser or definition"})
+	}
+
+	return c.JSON(http.StatusOK, service.TestParser(parser, []byte(request.Text), request.FileName))
+}
+
+// activateParserDefinition registers a parser definition and binds it to the artists in the request.
+// The cannot_parse tickets of those artists are then parsed again from the cached attachments,
+// and the ones the parser could read are relabeled, with their subject following the new labels.
+func activateParserDefinition(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, crashy.Wrap(err))
+	}
+
+	var request ParserActivation
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, crashy.Wrap(err))
+	}
+	if len(request.UserIDs) == 0 {
+		return c.JSON(http.StatusBadRequest, crashy.ErrorResponse{ErrorString: "missing user_ids"})
+	}
+
+	if err := db.Error(Database); err != nil {
+		return c.JSON(http.StatusInternalServerError, crashy.Wrap(err))
+	}
+
+	definition, err := Database.GetParserDefinition(id)
+	if errors.Is(err, db.ErrMissingParserDefinition) {
+		return c.JSON(http.StatusNotFound, crashy.Wrap(err))
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, crashy.Wrap(err))
+	}
+
+	definition.Active = true
+	if err := service.RegisterParserDefinition(definition); err != nil {
+		return c.JSON(http.StatusBadRequest, crashy.ErrorResponse{ErrorString: err.Error(), Debug: definition})
+	}
+	if _, err := Database.UpsertParserDefinition(definition); err != nil {
+		return c.JSON(http.StatusInternalServerError, crashy.Wrap(err))
+	}
+
+	activated := ParserActivated{Definition: definition}
+	fail := func(ticketID int64, err error) {
+		if activated.Failed == nil {
+			activated.Failed = make(map[int64]string)
+		}
+		activated.Failed[ticketID] = err.Error()
+	}
+	for _, userID := range request.UserIDs {
+		binding := db.ParserBinding{Parser: definition.Name, UserID: &userID}
+		binding.ID, err = Database.UpsertParserBinding(binding)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, crashy.Wrap(err))
+		}
+		activated.Bindings = append(activated.Bindings, binding)
+	}
+
+	tickets, err := Database.GetTicketsByLabel(string(db.LabelCannotParse))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, crashy.Wrap(err))
+	}
+
+	auditor, _ := GetCurrentAuditor(c)
+	parser, _ := service.LookupParser(definition.Name)
+	cacheToUse := cache.SwitchCache(c)
+	artists := Database.AllArtists()
+	characters := Database.AllCharacters()
+	for _, ticket := range tickets {
+		labels, err := reparseTicket(ticket, parser, request.UserIDs, cacheToUse, artists, characters)
+		if err != nil {
+			fail(ticket.ID, err)
+			continue
+		}
+		if labels == nil {
+			continue
+		}
+
+		ticket.Subject = service.RelabeledSubject(ticket.Subject, ticket.Labels, labels)
+		ticket.Labels = labels
+		if _, err := Database.UpsertTicket(ticket, auditor); err != nil {
+			fail(ticket.ID, err)
+			continue
+		}
+		activated.Resolved = append(activated.Resolved, ticket.ID)
+	}
+
+	return c.JSON(http.StatusOK, activated)
+}
+
+// reparseTicket parses the latest stored version of each submission of the ticket with parser
+// and stores the submissions that it could read.
+// It returns the new labels of the ticket, or nil if the ticket isn't about the artists in userIDs.
+func reparseTicket(ticket db.Ticket, parser service.Parser, userIDs []int64, cacheToUse cache.Cache, artists []db.Artist, characters []db.Character) ([]db.TicketLabel, error) {
+	if len(ticket.SubmissionIDs) == 0 {
+		return nil, nil
+	}
+
+	reported := reportedUserIDs(ticket)
+	if len(reported) > 0 && !slices.ContainsFunc(reported, func(userID int64) bool { return slices.Contains(userIDs, userID) }) {
+		return nil, nil
+	}
+
+	var submissions []db.Submission
+	for _, submissionID := range ticket.SubmissionIDs {
+		history, err := Database.GetSubmissionHistory(submissionID)
+		if err != nil {
+			return nil, err
+		}
+		if len(history) == 0 {
+			if len(reported) == 0 {
+				// without a stored version or reported users the ticket can't be tied to the artists
+				return nil, nil
+			}
+			return nil, fmt.Errorf("submission %d was never stored", submissionID)
+		}
+		sub := history[len(history)-1].Submission
+		if !slices.Contains(userIDs, sub.UserID) {
+			return nil, nil
+		}
+		submissions = append(submissions, sub)
+	}
+
+	labels := slices.DeleteFunc(slices.Clone(ticket.Labels), func(label db.TicketLabel) bool {
+		return label == db.LabelCannotParse
+	})
+	for _, sub := range submissions {
+		if len(sub.Metadata.Objects) == 0 {
+			ok, err := service.Reparse(&sub, parser, cacheToUse, Database, artists, characters)
+			if err != nil && !ok {
+				return nil, fmt.Errorf("submission %d: %w", sub.ID, err)
+			}
+			if !ok {
+				return nil, fmt.Errorf("submission %d: no parameters found in the cached attachments", sub.ID)
+			}
+		}
+		subLabels := service.TicketLabels(sub)
+		if err := Database.StoreSubmission(sub, subLabels); err != nil {
+			return nil, err
+		}
+		for _, label := range subLabels {
+			if !slices.Contains(labels, label) {
+				labels = append(labels, label)
+			}
+		}
+	}
+	return labels, nil
+}
+
+// reportedUserIDs returns the IDs of the users reported in the ticket.
+func reportedUserIDs(ticket db.Ticket) []int64 {
+	var userIDs []int64
+	for _, reported := range ticket.UsersInvolved.ReportedIDs {
+		if userID, err := strconv.ParseInt(reported.UserID, 10, 64); err == nil {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	return userIDs
+}
+
+// addCorpusCase adds the latest reviewed version of a submission to the heuristics corpus in CorpusDir,
+// expecting the objects and labels it has now. The attachments are taken from the cache.
+// Set query "name" to name the case, it defaults to the submission ID.
+func addCorpusCase(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, crashy.ErrorResponse{ErrorString: "invalid submission id", Debug: err})
+	}
+
+	if err := db.Error(Database); err != nil {
+		return c.JSON(http.StatusInternalServerError, crashy.Wrap(err))
+	}
+
+	history, err := Database.GetSubmissionHistory(id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, crashy.Wrap(err))
+	}
+	if len(history) == 0 {
+		return c.JSON(http.StatusNotFound, crashy.ErrorResponse{ErrorString: "submission has not been reviewed"})
+	}
+	latest := history[len(history)-1]
+
+	name := c.QueryParam("name")
+	if name == "" {
+		name = strconv.FormatInt(id, 10)
+	}
+
+	caches := []cache.Cache{cache.SwitchCache(c), cache.TextCache, cache.FileCache}
+	attachment := func(url string) ([]byte, bool) {
+		for _, file := range latest.Submission.Files {
+			if file.File.FileURLFull != url {
+				continue
+			}
+			for _, cacheToUse := range caches {
+				if item, err := cacheToUse.Get(fmt.Sprintf("%s:%s", file.File.MimeType, url)); err == nil {
+					return item.Blob, true
+				}
+			}
+		}
+		return nil, false
+	}
+
+	corpusCase := service.NewCorpusCase(name, latest.Submission, latest.Labels, Database.AllArtists(), Database.AllCharacters(), attachment)
+	if err := corpusCase.Write(CorpusDir); err != nil {
+		return c.JSON(http.StatusInternalServerError, crashy.Wrap(err))
+	}
+
+	return c.JSON(http.StatusOK, corpusCase)
+}
+
+// startReevaluation evaluates the stored submissions of an older service.Version again in the background.
+// Use GET /reevaluation for the report.
+func startReevaluation(c echo.Context) error {
+	if Database == nil {
+		return c.JSON(http.StatusServiceUnavailable, crashy.ErrorResponse{ErrorString: "no database to re-evaluate"})
+	}
+	go reevaluate(c.Echo(), service.ListChanges{})
+	return c.NoContent(http.StatusAccepted)
+}
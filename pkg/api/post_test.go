@@ -6,6 +6,8 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -14,6 +16,7 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	"github.com/ellypaws/inkbunny-app/pkg/api/entities"
+	"github.com/ellypaws/inkbunny-app/pkg/api/service"
 	"github.com/ellypaws/inkbunny-app/pkg/db"
 	sd "github.com/ellypaws/inkbunny-sd/entities"
 	"github.com/ellypaws/inkbunny-sd/llm"
@@ -235,3 +238,40 @@ func searchAIGenerated(user *api.Credentials) api.SubmissionSearchResponse {
 	})
 	return searchResponse
 }
+
+func TestAddCorpusCase(t *testing.T) {
+	Database = tempDB()
+	if !assert.NoError(t, db.Error(Database)) {
+		return
+	}
+	CorpusDir = t.TempDir()
+
+	submission := db.Submission{
+		ID:       14576,
+		UserID:   1,
+		Title:    "title",
+		Metadata: db.Metadata{AISubmission: true, MissingTags: true},
+	}
+	if !assert.NoError(t, Database.StoreSubmission(submission, []db.TicketLabel{db.LabelMissingTags})) {
+		return
+	}
+
+	e := echo.New()
+	e.POST("/corpus/:id", postHandlers["/corpus/:id"].handler)
+	req := httptest.NewRequest(http.MethodPost, "/corpus/14576?name=missing_tags", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if !assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String()) {
+		return
+	}
+	b, err := os.ReadFile(filepath.Join(CorpusDir, "missing_tags", "case.json"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	var corpusCase service.CorpusCase
+	if assert.NoError(t, json.Unmarshal(b, &corpusCase)) {
+		assert.Equal(t, int64(14576), corpusCase.Submission.ID)
+		assert.Equal(t, []db.TicketLabel{db.LabelMissingTags}, corpusCase.Labels)
+	}
+}
@@ -6,14 +6,22 @@ import (
 
 	"github.com/labstack/echo/v4"
 
+	. "github.com/ellypaws/inkbunny-app/pkg/api/entities"
+	"github.com/ellypaws/inkbunny-app/pkg/api/rules"
+	"github.com/ellypaws/inkbunny-app/pkg/api/service"
 	"github.com/ellypaws/inkbunny-app/pkg/crashy"
 	"github.com/ellypaws/inkbunny-app/pkg/db"
 )
 
 var putHandlers = pathHandler{
-	"/ticket":  handler{newTicket, staffMiddleware},
-	"/artist":  handler{newArtist, staffMiddleware},
-	"/auditor": handler{newAuditor, staffMiddleware},
+	"/ticket":            handler{newTicket, staffMiddleware},
+	"/artist":            handler{newArtist, listsMiddleware},
+	"/artist/consent":    handler{newArtistConsent, listsMiddleware},
+	"/character":         handler{newCharacter, listsMiddleware},
+	"/parser":            handler{newParserBinding, listsMiddleware},
+	"/parser/definition": handler{newParserDefinition, staffMiddleware},
+	"/auditor":           handler{newAuditor, staffMiddleware},
+	"/rules":             handler{activateRules, staffMiddleware},
 }
 
 func newTicket(c echo.Context) error {
@@ -30,7 +38,8 @@ func newTicket(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, crashy.Wrap(err))
 	}
 
-	id, err := Database.InsertTicket(ticket)
+	auditor, _ := GetCurrentAuditor(c)
+	id, err := Database.InsertTicket(ticket, auditor)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, crashy.Wrap(err))
 	}
@@ -72,6 +81,121 @@ func newArtist(c echo.Context) error {
 	return c.JSON(http.StatusOK, artists)
 }
 
+// newArtistConsent records a new consent. GrantedBy defaults to the artist.
+func newArtistConsent(c echo.Context) error {
+	var consent db.ArtistConsent
+	if err := c.Bind(&consent); err != nil {
+		return c.JSON(http.StatusBadRequest, crashy.Wrap(err))
+	}
+
+	if err := db.Error(Database); err != nil {
+		return c.JSON(http.StatusInternalServerError, crashy.Wrap(err))
+	}
+
+	if consent.Artist == "" {
+		return c.JSON(http.StatusBadRequest, crashy.ErrorResponse{ErrorString: "missing artist", Debug: consent})
+	}
+	if consent.GrantedBy == "" {
+		consent.GrantedBy = consent.Artist
+	}
+
+	consent.ID = 0
+	consent.Created = time.Now().UTC()
+	id, err := Database.UpsertArtistConsent(consent)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, crashy.Wrap(err))
+	}
+
+	consent.ID = id
+	return c.JSON(http.StatusOK, consent)
+}
+
+func newCharacter(c echo.Context) error {
+	var character db.Character
+	if err := c.Bind(&character); err != nil {
+		return c.JSON(http.StatusBadRequest, crashy.Wrap(err))
+	}
+
+	if err := db.Error(Database); err != nil {
+		return c.JSON(http.StatusInternalServerError, crashy.Wrap(err))
+	}
+
+	if character.Name == "" || character.Owner == "" {
+		return c.JSON(http.StatusBadRequest, crashy.ErrorResponse{ErrorString: "missing name or owner", Debug: character})
+	}
+
+	character.ID = 0
+	character.Matches = nil
+	id, err := Database.UpsertCharacter(character)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, crashy.Wrap(err))
+	}
+
+	character.ID = id
+	return c.JSON(http.StatusOK, character)
+}
+
+// newParserBinding attaches a registered parser to a user, file name pattern or content pattern.
+// Reviews use the binding from the next time the parameters are parsed.
+func newParserBinding(c echo.Context) error {
+	var binding db.ParserBinding
+	if err := c.Bind(&binding); err != nil {
+		return c.JSON(http.StatusBadRequest, crashy.Wrap(err))
+	}
+
+	if err := db.Error(Database); err != nil {
+		return c.JSON(http.StatusInternalServerError, crashy.Wrap(err))
+	}
+
+	if _, ok := service.LookupParser(binding.Parser); !ok {
+		return c.JSON(http.StatusBadRequest, crashy.ErrorResponse{ErrorString: "unknown parser", Debug: service.Parsers()})
+	}
+	if err := binding.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, crashy.ErrorResponse{ErrorString: err.Error(), Debug: binding})
+	}
+
+	binding.ID = 0
+	id, err := Database.UpsertParserBinding(binding)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, crashy.Wrap(err))
+	}
+
+	binding.ID = id
+	return c.JSON(http.StatusOK, binding)
+}
+
+// newParserDefinition stores a staff-written parser. It isn't used until it's activated for an artist,
+// see activateParserDefinition.
+func newParserDefinition(c echo.Context) error {
+	var definition db.ParserDefinition
+	if err := c.Bind(&definition); err != nil {
+		return c.JSON(http.StatusBadRequest, crashy.Wrap(err))
+	}
+
+	if err := db.Error(Database); err != nil {
+		return c.JSON(http.StatusInternalServerError, crashy.Wrap(err))
+	}
+
+	if _, err := service.DefinitionParser(definition); err != nil {
+		return c.JSON(http.StatusBadRequest, crashy.ErrorResponse{ErrorString: err.Error(), Debug: definition})
+	}
+
+	definition.ID = 0
+	definition.Active = false
+	definition.Created = time.Now().UTC()
+	if auditor, err := GetCurrentAuditor(c); err == nil {
+		definition.Author = auditor.Username
+	}
+
+	id, err := Database.UpsertParserDefinition(definition)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, crashy.Wrap(err))
+	}
+
+	definition.ID = id
+	return c.JSON(http.StatusOK, definition)
+}
+
 func newAuditor(c echo.Context) error {
 	var auditors []db.Auditor
 	if err := c.Bind(&auditors); err != nil {
@@ -104,3 +228,41 @@ func newAuditor(c echo.Context) error {
 
 	return c.JSON(http.StatusOK, auditors)
 }
+
+// activateRules validates, stores and replaces the active rule set, so it is loaded again on the next start.
+// Cached reviews of the previous rules are no longer used, and stored submissions are evaluated again in the background.
+func activateRules(c echo.Context) error {
+	var request RulesRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, crashy.Wrap(err))
+	}
+
+	source, err := rulesSource(request.Rules)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, RulesValidation{Valid: false, Error: err.Error()})
+	}
+
+	set, err := rules.Parse(source)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, RulesValidation{Valid: false, Error: err.Error()})
+	}
+
+	if Database != nil {
+		stored := db.RuleSet{Version: set.Version, Source: string(source), Created: time.Now().UTC()}
+		if auditor, err := GetCurrentAuditor(c); err == nil {
+			stored.Author = auditor.Username
+		}
+		if _, err := Database.ActivateRuleSet(stored); err != nil {
+			return c.JSON(http.StatusInternalServerError, crashy.Wrap(err))
+		}
+	}
+
+	previous := rules.Active()
+	rules.SetActive(set)
+	c.Logger().Infof("activated rules %s (was %s)", set.Version, previous.Version)
+	if Database != nil && set.Version != previous.Version {
+		go reevaluate(c.Echo(), service.ListChanges{})
+	}
+
+	return c.JSON(http.StatusOK, set)
+}
@@ -0,0 +1,283 @@
+package rules
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Condition is either a group (All, Any, Not) or a comparison of a fact against Value.
+// When Each is set, the fact must be a list and Op is applied to every element.
+type Condition struct {
+	All []Condition `json:"all,omitempty" yaml:"all,omitempty"`
+	Any []Condition `json:"any,omitempty" yaml:"any,omitempty"`
+	Not *Condition  `json:"not,omitempty" yaml:"not,omitempty"`
+
+	Fact  string     `json:"fact,omitempty" yaml:"fact,omitempty"`
+	Op    Operator   `json:"op,omitempty" yaml:"op,omitempty"`
+	Value any        `json:"value,omitempty" yaml:"value,omitempty"`
+	Each  Quantifier `json:"each,omitempty" yaml:"each,omitempty"`
+
+	re *regexp.Regexp
+}
+
+type Operator string
+
+const (
+	OpTrue     Operator = "true"
+	OpFalse    Operator = "false"
+	OpEmpty    Operator = "empty"
+	OpNotEmpty Operator = "not_empty"
+	OpEquals   Operator = "eq"
+	OpNotEqual Operator = "ne"
+	OpContains Operator = "contains"
+	OpIn       Operator = "in"
+	OpMatches  Operator = "matches"
+	OpBefore   Operator = "before"
+	OpAfter    Operator = "after"
+	OpGreater  Operator = "gt"
+	OpAtLeast  Operator = "gte"
+	OpLess     Operator = "lt"
+	OpAtMost   Operator = "lte"
+)
+
+var operators = []Operator{
+	OpTrue, OpFalse, OpEmpty, OpNotEmpty, OpEquals, OpNotEqual, OpContains, OpIn,
+	OpMatches, OpBefore, OpAfter, OpGreater, OpAtLeast, OpLess, OpAtMost,
+}
+
+type Quantifier string
+
+const (
+	EachAny  Quantifier = "any"
+	EachAll  Quantifier = "all"
+	EachNone Quantifier = "none"
+)
+
+func (c *Condition) evaluate(in *input, captures map[string]string) bool {
+	switch {
+	case len(c.All) > 0:
+		for i := range c.All {
+			if !c.All[i].evaluate(in, captures) {
+				return false
+			}
+		}
+		return true
+	case len(c.Any) > 0:
+		for i := range c.Any {
+			if c.Any[i].evaluate(in, captures) {
+				return true
+			}
+		}
+		return false
+	case c.Not != nil:
+		return !c.Not.evaluate(in, make(map[string]string))
+	}
+
+	value := in.fact(c.Fact)
+	if c.Each == "" {
+		return c.compare(value, captures)
+	}
+
+	list, _ := value.([]any)
+	switch c.Each {
+	case EachAll:
+		for _, v := range list {
+			if !c.compare(v, captures) {
+				return false
+			}
+		}
+		return true
+	case EachNone:
+		for _, v := range list {
+			if c.compare(v, captures) {
+				return false
+			}
+		}
+		return true
+	default:
+		for _, v := range list {
+			if c.compare(v, captures) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func (c *Condition) compare(value any, captures map[string]string) bool {
+	switch c.Op {
+	case OpTrue:
+		return truthy(value)
+	case OpFalse:
+		return !truthy(value)
+	case OpEmpty:
+		return !truthy(value)
+	case OpNotEmpty:
+		return truthy(value)
+	case OpEquals:
+		return equal(value, c.Value)
+	case OpNotEqual:
+		return !equal(value, c.Value)
+	case OpContains:
+		if list, ok := value.([]any); ok {
+			return slices.ContainsFunc(list, func(v any) bool { return equal(v, c.Value) })
+		}
+		return strings.Contains(strings.ToLower(format(value)), strings.ToLower(format(c.Value)))
+	case OpIn:
+		list, ok := c.Value.([]any)
+		return ok && slices.ContainsFunc(list, func(v any) bool { return equal(value, v) })
+	case OpMatches:
+		if c.re == nil {
+			return false
+		}
+		if list, ok := value.([]any); ok {
+			for _, v := range list {
+				if match := c.re.FindString(format(v)); match != "" {
+					captures["match"] = match
+					return true
+				}
+			}
+			return false
+		}
+		match := c.re.FindString(format(value))
+		if match == "" {
+			return false
+		}
+		captures["match"] = match
+		return true
+	case OpBefore, OpAfter:
+		t, ok := value.(time.Time)
+		if !ok || t.IsZero() {
+			return false
+		}
+		against, ok := asTime(c.Value)
+		if !ok {
+			return false
+		}
+		if c.Op == OpBefore {
+			return t.Before(against)
+		}
+		return t.After(against)
+	case OpGreater, OpAtLeast, OpLess, OpAtMost:
+		a, ok := asFloat(value)
+		if !ok {
+			return false
+		}
+		b, ok := asFloat(c.Value)
+		if !ok {
+			return false
+		}
+		switch c.Op {
+		case OpGreater:
+			return a > b
+		case OpAtLeast:
+			return a >= b
+		case OpLess:
+			return a < b
+		default:
+			return a <= b
+		}
+	}
+	return false
+}
+
+func truthy(value any) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		return v != ""
+	case time.Time:
+		return !v.IsZero()
+	}
+	if f, ok := asFloat(value); ok {
+		return f != 0
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return rv.Len() > 0
+	case reflect.Pointer, reflect.Interface:
+		return !rv.IsNil()
+	}
+	return !rv.IsZero()
+}
+
+func equal(a, b any) bool {
+	if fa, ok := asFloat(a); ok {
+		if fb, ok := asFloat(b); ok {
+			return fa == fb
+		}
+	}
+	if ta, ok := a.(time.Time); ok {
+		if tb, ok := asTime(b); ok {
+			return ta.Equal(tb)
+		}
+	}
+	return strings.EqualFold(format(a), format(b))
+}
+
+func asFloat(value any) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case bool, nil:
+		return 0, false
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	rv := reflect.ValueOf(value)
+	switch {
+	case rv.CanInt():
+		return float64(rv.Int()), true
+	case rv.CanUint():
+		return float64(rv.Uint()), true
+	case rv.CanFloat():
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+func asTime(value any) (time.Time, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		for _, layout := range []string{time.RFC3339Nano, time.DateTime, time.DateOnly} {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+func format(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case []any:
+		s := make([]string, len(v))
+		for i := range v {
+			s[i] = format(v[i])
+		}
+		return strings.Join(s, ",")
+	}
+	return fmt.Sprint(value)
+}
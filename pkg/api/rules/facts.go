@@ -0,0 +1,237 @@
+package rules
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/ellypaws/inkbunny-app/pkg/db"
+	"github.com/ellypaws/inkbunny-sd/entities"
+)
+
+// Fact resolves a named value from a submission.
+// Facts prefixed with "metadata." are read from the JSON form of [db.Metadata], e.g. "metadata.ai_submission".
+// Facts prefixed with "objects." return one value per parsed [entities.TextToImageRequest],
+// with nil standing in for a missing value, so they can be used with [Condition.Each].
+type Fact func(submission *db.Submission) any
+
+const (
+	metadataPrefix = "metadata."
+	objectsPrefix  = "objects."
+
+	// revisionFact is the ID of the [Revision] in force when the submission was last updated, empty before the first.
+	revisionFact = "revision"
+)
+
+var (
+	factsMu sync.RWMutex
+	facts   = map[string]Fact{
+		"id":          func(s *db.Submission) any { return s.ID },
+		"user_id":     func(s *db.Submission) any { return s.UserID },
+		"username":    func(s *db.Submission) any { return s.Username },
+		"title":       func(s *db.Submission) any { return s.Title },
+		"description": func(s *db.Submission) any { return s.Description },
+		"updated":     func(s *db.Submission) any { return s.Updated },
+		"keywords": func(s *db.Submission) any {
+			keywords := make([]any, len(s.Keywords))
+			for i, keyword := range s.Keywords {
+				keywords[i] = keyword.KeywordName
+			}
+			return keywords
+		},
+		"keyword_ids": func(s *db.Submission) any {
+			keywords := make([]any, len(s.Keywords))
+			for i, keyword := range s.Keywords {
+				keywords[i] = keyword.KeywordID
+			}
+			return keywords
+		},
+		"ratings": func(s *db.Submission) any {
+			ratings := make([]any, len(s.Ratings))
+			for i, rating := range s.Ratings {
+				ratings[i] = rating.Name
+			}
+			return ratings
+		},
+		"files.mime_type": func(s *db.Submission) any {
+			files := make([]any, len(s.Files))
+			for i, f := range s.Files {
+				files[i] = f.File.MimeType
+			}
+			return files
+		},
+	}
+
+	objectFacts = map[string]func(obj entities.TextToImageRequest) any{
+		"prompt":          func(obj entities.TextToImageRequest) any { return obj.Prompt },
+		"negative_prompt": func(obj entities.TextToImageRequest) any { return obj.NegativePrompt },
+		"model": func(obj entities.TextToImageRequest) any {
+			if obj.OverrideSettings.SDModelCheckpoint != nil {
+				return *obj.OverrideSettings.SDModelCheckpoint
+			}
+			if obj.OverrideSettings.SDCheckpointHash != "" {
+				return obj.OverrideSettings.SDCheckpointHash
+			}
+			return nil
+		},
+		"seed": func(obj entities.TextToImageRequest) any {
+			if obj.Seed == 0 || obj.Seed == -1 {
+				return nil
+			}
+			return obj.Seed
+		},
+		"steps": func(obj entities.TextToImageRequest) any {
+			if obj.Steps <= 0 {
+				return nil
+			}
+			return obj.Steps
+		},
+		"cfg_scale": func(obj entities.TextToImageRequest) any {
+			if obj.CFGScale == 0 {
+				return nil
+			}
+			return obj.CFGScale
+		},
+		"sampler":            func(obj entities.TextToImageRequest) any { return obj.SamplerName },
+		"width":              func(obj entities.TextToImageRequest) any { return obj.Width },
+		"height":             func(obj entities.TextToImageRequest) any { return obj.Height },
+		"denoising_strength": func(obj entities.TextToImageRequest) any { return obj.DenoisingStrength },
+		"lora_hashes": func(obj entities.TextToImageRequest) any {
+			if len(obj.LoraHashes) == 0 {
+				return nil
+			}
+			return obj.LoraHashes
+		},
+	}
+)
+
+// metadataFields are the JSON names of the fields of [db.Metadata], the facts available under "metadata.".
+var metadataFields = func() map[string]bool {
+	fields := make(map[string]bool)
+	t := reflect.TypeFor[db.Metadata]()
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			fields[name] = true
+		}
+	}
+	return fields
+}()
+
+// RegisterFact makes a computed value available to rule conditions under name.
+// Rule files referencing unknown facts are rejected by [Parse], so facts must be registered before loading rules.
+func RegisterFact(name string, fact Fact) {
+	factsMu.Lock()
+	defer factsMu.Unlock()
+	facts[name] = fact
+}
+
+// Facts returns the names of every registered fact, including the "metadata." and "objects." facts.
+func Facts() []string {
+	factsMu.RLock()
+	defer factsMu.RUnlock()
+	names := make([]string, 0, 1+len(facts)+len(objectFacts)+len(metadataFields))
+	names = append(names, revisionFact)
+	for name := range facts {
+		names = append(names, name)
+	}
+	for name := range objectFacts {
+		names = append(names, objectsPrefix+name)
+	}
+	for name := range metadataFields {
+		names = append(names, metadataPrefix+name)
+	}
+	return names
+}
+
+// ObjectFact returns the value of an "objects." fact for a single object, nil if the object is missing it.
+func ObjectFact(name string, obj entities.TextToImageRequest) any {
+	get, ok := objectFacts[strings.TrimPrefix(name, objectsPrefix)]
+	if !ok {
+		return nil
+	}
+	return get(obj)
+}
+
+func knownFact(name string) bool {
+	if name == "objects" || name == revisionFact {
+		return true
+	}
+	if field, ok := strings.CutPrefix(name, metadataPrefix); ok {
+		return metadataFields[field]
+	}
+	if field, ok := strings.CutPrefix(name, objectsPrefix); ok {
+		_, ok := objectFacts[field]
+		return ok
+	}
+	factsMu.RLock()
+	defer factsMu.RUnlock()
+	_, ok := facts[name]
+	return ok
+}
+
+// input memoizes facts for a single evaluation
+type input struct {
+	submission *db.Submission
+	revision   *Revision
+	metadata   map[string]any
+	values     map[string]any
+}
+
+func newInput(submission *db.Submission, revision *Revision) *input {
+	return &input{submission: submission, revision: revision, values: make(map[string]any)}
+}
+
+func (in *input) fact(name string) any {
+	if v, ok := in.values[name]; ok {
+		return v
+	}
+	v := in.resolve(name)
+	in.values[name] = v
+	return v
+}
+
+func (in *input) resolve(name string) any {
+	if name == revisionFact {
+		if in.revision == nil {
+			return ""
+		}
+		return in.revision.ID
+	}
+	if name == "objects" {
+		objects := make([]any, 0, len(in.submission.Metadata.Objects))
+		for key := range in.submission.Metadata.Objects {
+			objects = append(objects, key)
+		}
+		return objects
+	}
+	if field, ok := strings.CutPrefix(name, metadataPrefix); ok {
+		if in.metadata == nil {
+			in.metadata = make(map[string]any)
+			b, err := json.Marshal(in.submission.Metadata)
+			if err == nil {
+				_ = json.Unmarshal(b, &in.metadata)
+			}
+		}
+		return in.metadata[field]
+	}
+	if field, ok := strings.CutPrefix(name, objectsPrefix); ok {
+		get, ok := objectFacts[field]
+		if !ok {
+			return nil
+		}
+		values := make([]any, 0, len(in.submission.Metadata.Objects))
+		for _, obj := range in.submission.Metadata.Objects {
+			values = append(values, get(obj))
+		}
+		return values
+	}
+	factsMu.RLock()
+	fact, ok := facts[name]
+	factsMu.RUnlock()
+	if !ok {
+		return nil
+	}
+	return fact(in.submission)
+}
@@ -0,0 +1,105 @@
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ellypaws/inkbunny-app/pkg/db"
+)
+
+// Revision is a dated revision of the ACP.
+// The rules it lists were introduced by it, so they only count against submissions posted from Date on.
+// Rules that no revision lists apply to every submission.
+type Revision struct {
+	ID    string    `json:"id" yaml:"id"`
+	Date  time.Time `json:"date" yaml:"date"`
+	URL   string    `json:"url,omitempty" yaml:"url,omitempty"`
+	Rules []string  `json:"rules,omitempty" yaml:"rules,omitempty"`
+}
+
+// RevisionAt returns the revision in force at t, or nil if t is before the first revision.
+// A zero t is taken as now.
+func (s *Set) RevisionAt(t time.Time) *Revision {
+	if t.IsZero() {
+		t = time.Now()
+	}
+	for i := len(s.Revisions) - 1; i >= 0; i-- {
+		if !s.Revisions[i].Date.After(t) {
+			return &s.Revisions[i]
+		}
+	}
+	return nil
+}
+
+// introducedBy returns the revision that introduced rule, or nil if it applies to every submission.
+func (s *Set) introducedBy(rule *Rule) *Revision {
+	for i := range s.Revisions {
+		if slices.Contains(s.Revisions[i].Rules, rule.Name) {
+			return &s.Revisions[i]
+		}
+	}
+	return nil
+}
+
+// introducedAfter reports whether rule was introduced by a revision later than the one in force.
+func (s *Set) introducedAfter(rule *Rule, revision *Revision) bool {
+	introduced := s.introducedBy(rule)
+	if introduced == nil {
+		return false
+	}
+	return revision == nil || introduced.Date.After(revision.Date)
+}
+
+// RevisionLabel returns the [db.LabelACPRevision] naming revision, e.g. "acp_revision:2022-11-21".
+func RevisionLabel(revision *Revision) db.TicketLabel {
+	return db.TicketLabel(fmt.Sprintf("%s:%s", db.LabelACPRevision, revision.ID))
+}
+
+// Informational returns label downgraded with the [db.LabelInformational] prefix, e.g. "info:missing_prompt".
+func Informational(label db.TicketLabel) db.TicketLabel {
+	return db.TicketLabel(fmt.Sprintf("%s:%s", db.LabelInformational, label))
+}
+
+// IsInformational reports whether label doesn't count against the submission,
+// either because it was downgraded or because it names the ACP revision.
+func IsInformational(label db.TicketLabel) bool {
+	return strings.HasPrefix(string(label), string(db.LabelInformational)+":") ||
+		strings.HasPrefix(string(label), string(db.LabelACPRevision)+":")
+}
+
+// compileRevisions validates the revisions and sorts them by date.
+func (s *Set) compileRevisions() error {
+	var errs []error
+	ids := make(map[string]bool)
+	names := make(map[string]bool)
+	for _, rule := range s.Rules {
+		names[rule.Name] = true
+	}
+	introduced := make(map[string]string)
+	for i, revision := range s.Revisions {
+		if revision.ID == "" {
+			errs = append(errs, fmt.Errorf("revision %d: missing id", i))
+		}
+		if ids[revision.ID] {
+			errs = append(errs, fmt.Errorf("revision %s: duplicate id", revision.ID))
+		}
+		ids[revision.ID] = true
+		if revision.Date.IsZero() {
+			errs = append(errs, fmt.Errorf("revision %s: missing date", revision.ID))
+		}
+		for _, name := range revision.Rules {
+			if !names[name] {
+				errs = append(errs, fmt.Errorf("revision %s: unknown rule %q", revision.ID, name))
+			}
+			if previous, ok := introduced[name]; ok {
+				errs = append(errs, fmt.Errorf("revision %s: rule %s was already introduced by %s", revision.ID, name, previous))
+			}
+			introduced[name] = revision.ID
+		}
+	}
+	slices.SortStableFunc(s.Revisions, func(a, b Revision) int { return a.Date.Compare(b.Date) })
+	return errors.Join(errs...)
+}
@@ -0,0 +1,355 @@
+// Package rules evaluates the ACP rules that turn a reviewed [db.Submission] into [db.TicketLabel]s.
+// Rules are declared in a versioned YAML or JSON file so wording and conditions can change without a release.
+package rules
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/ellypaws/inkbunny-app/pkg/db"
+)
+
+//go:embed default.yaml
+var defaultRules []byte
+
+const (
+	defaultEmptySubject = "needs to be reviewed"
+	defaultSubject      = "is not following AI ACP"
+)
+
+// Set is a versioned collection of rules.
+// Rules are evaluated in Priority order, the first matching rule with a Subject names the ticket.
+type Set struct {
+	Version      string     `json:"version" yaml:"version"`
+	EmptySubject string     `json:"empty_subject,omitempty" yaml:"empty_subject,omitempty"` // Used when no labels are emitted
+	Subject      string     `json:"default_subject,omitempty" yaml:"default_subject,omitempty"`
+	Keywords     []Keyword  `json:"keywords,omitempty" yaml:"keywords,omitempty"`
+	Revisions    []Revision `json:"revisions,omitempty" yaml:"revisions,omitempty"` // Sorted by date
+	Rules        []Rule     `json:"rules" yaml:"rules"`
+}
+
+// Keyword maps Inkbunny keywords to [db.Metadata] flags.
+// If AI is set, the keyword is recorded in [db.Metadata.AIKeywords] and marks the submission as AI.
+type Keyword struct {
+	Names []string `json:"names,omitempty" yaml:"names,omitempty"`
+	IDs   []string `json:"ids,omitempty" yaml:"ids,omitempty"`
+	Set   []string `json:"set,omitempty" yaml:"set,omitempty"`
+	AI    bool     `json:"ai,omitempty" yaml:"ai,omitempty"`
+}
+
+// Rule emits Label when When holds.
+// Label may reference ${match} for the text captured by a "matches" condition,
+// or ${fact} for the value of any fact, e.g. "private_tool:${metadata.generator}".
+// If ForEach names a list fact, the rule emits Label once per element, with ${item} set to the element,
+// e.g. "missing_tool_tag:${item}".
+type Rule struct {
+	Name     string    `json:"name" yaml:"name"`
+	Label    string    `json:"label" yaml:"label"`
+	Subject  string    `json:"subject,omitempty" yaml:"subject,omitempty"`
+	Priority int       `json:"priority,omitempty" yaml:"priority,omitempty"`
+	ForEach  string    `json:"for_each,omitempty" yaml:"for_each,omitempty"`
+	When     Condition `json:"when" yaml:"when"`
+}
+
+// Match is a label emitted by a rule.
+// Informational is set when the rule was introduced by an ACP revision after the submission was posted.
+// Captured is the text captured by a "matches" condition, if any.
+type Match struct {
+	Rule          *Rule          `json:"rule"`
+	Label         db.TicketLabel `json:"label"`
+	Informational bool           `json:"informational,omitempty"`
+	Captured      string         `json:"captured,omitempty"`
+}
+
+var active atomic.Pointer[Set]
+
+func init() {
+	set, err := Parse(defaultRules)
+	if err != nil {
+		panic(fmt.Errorf("error: parsing default rules: %w", err))
+	}
+	active.Store(set)
+}
+
+// Active returns the rule set currently used by the review pipeline.
+func Active() *Set {
+	return active.Load()
+}
+
+// SetActive replaces the active rule set. It is safe to call while reviews are running.
+func SetActive(set *Set) {
+	if set == nil {
+		return
+	}
+	active.Store(set)
+}
+
+// Default returns the rule set that ships with the server.
+func Default() *Set {
+	set, _ := Parse(defaultRules)
+	return set
+}
+
+// Load reads and validates a YAML or JSON rule file.
+func Load(path string) (*Set, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error: reading rules %s: %w", path, err)
+	}
+	return Parse(b)
+}
+
+// Parse decodes a YAML or JSON rule set and validates every rule.
+func Parse(b []byte) (*Set, error) {
+	var set Set
+	if err := yaml.Unmarshal(b, &set); err != nil {
+		return nil, fmt.Errorf("error: decoding rules: %w", err)
+	}
+	if err := set.compile(); err != nil {
+		return nil, err
+	}
+	return &set, nil
+}
+
+func (s *Set) compile() error {
+	if s.Version == "" {
+		return errors.New("error: rules are missing a version")
+	}
+	if len(s.Rules) == 0 {
+		return errors.New("error: rule set is empty")
+	}
+	if s.EmptySubject == "" {
+		s.EmptySubject = defaultEmptySubject
+	}
+	if s.Subject == "" {
+		s.Subject = defaultSubject
+	}
+
+	var errs []error
+	for i, keyword := range s.Keywords {
+		for _, flag := range keyword.Set {
+			if _, ok := metadataFlags[flag]; !ok {
+				errs = append(errs, fmt.Errorf("keyword %d: unknown flag %q", i, flag))
+			}
+		}
+	}
+	names := make(map[string]bool)
+	for i := range s.Rules {
+		rule := &s.Rules[i]
+		if rule.Name == "" {
+			rule.Name = rule.Label
+		}
+		if rule.Label == "" {
+			errs = append(errs, fmt.Errorf("rule %d: missing label", i))
+		}
+		if names[rule.Name] {
+			errs = append(errs, fmt.Errorf("rule %s: duplicate name", rule.Name))
+		}
+		names[rule.Name] = true
+		if err := rule.When.compile(); err != nil {
+			errs = append(errs, fmt.Errorf("rule %s: %w", rule.Name, err))
+		}
+		if rule.ForEach != "" && !knownFact(rule.ForEach) {
+			errs = append(errs, fmt.Errorf("rule %s: unknown fact %q", rule.Name, rule.ForEach))
+		}
+	}
+	if err := s.compileRevisions(); err != nil {
+		errs = append(errs, err)
+	}
+	slices.SortStableFunc(s.Rules, func(a, b Rule) int { return a.Priority - b.Priority })
+	return errors.Join(errs...)
+}
+
+// Evaluate returns every rule that matched the submission, in priority order.
+// Rules are evaluated against the revision in force when the submission was last updated, see [Set.RevisionAt].
+func (s *Set) Evaluate(submission *db.Submission) []Match {
+	revision := s.RevisionAt(submission.Updated)
+	input := newInput(submission, revision)
+	var matches []Match
+	seen := make(map[db.TicketLabel]bool)
+	for i := range s.Rules {
+		rule := &s.Rules[i]
+		captures := make(map[string]string)
+		if !rule.When.evaluate(input, captures) {
+			continue
+		}
+		items := []any{nil}
+		if rule.ForEach != "" {
+			items, _ = input.fact(rule.ForEach).([]any)
+		}
+		for _, item := range items {
+			if rule.ForEach != "" {
+				captures["item"] = format(item)
+			}
+			label := db.TicketLabel(os.Expand(rule.Label, func(key string) string {
+				if v, ok := captures[key]; ok {
+					return v
+				}
+				return format(input.fact(key))
+			}))
+			if seen[label] {
+				continue
+			}
+			seen[label] = true
+			matches = append(matches, Match{
+				Rule:          rule,
+				Label:         label,
+				Informational: s.introducedAfter(rule, revision),
+				Captured:      captures["match"],
+			})
+		}
+	}
+	return matches
+}
+
+// Labels returns the labels emitted for the submission, in priority order.
+// Informational matches are downgraded with [Informational]. If a rule introduced by a revision matched,
+// the revision in force is named last.
+func (s *Set) Labels(submission *db.Submission) []db.TicketLabel {
+	matches := s.Evaluate(submission)
+	labels := make([]db.TicketLabel, len(matches))
+	var revised bool
+	for i, match := range matches {
+		labels[i] = match.Label
+		if match.Informational {
+			labels[i] = Informational(match.Label)
+		}
+		if s.introducedBy(match.Rule) != nil {
+			revised = true
+		}
+	}
+	if revision := s.RevisionAt(submission.Updated); revision != nil && revised {
+		labels = append(labels, RevisionLabel(revision))
+	}
+	return labels
+}
+
+// Rule returns the rule that would emit label, or nil if none does.
+func (s *Set) Rule(label db.TicketLabel) *Rule {
+	for i := range s.Rules {
+		if s.Rules[i].emits(label) {
+			return &s.Rules[i]
+		}
+	}
+	return nil
+}
+
+// SubjectFor returns the ticket subject for the given labels. Informational labels are ignored.
+func (s *Set) SubjectFor(labels []db.TicketLabel) string {
+	labels = slices.DeleteFunc(slices.Clone(labels), IsInformational)
+	if len(labels) == 0 {
+		return s.EmptySubject
+	}
+	for i := range s.Rules {
+		rule := &s.Rules[i]
+		if rule.Subject == "" {
+			continue
+		}
+		if slices.ContainsFunc(labels, rule.emits) {
+			return rule.Subject
+		}
+	}
+	return s.Subject
+}
+
+// emits reports whether label could have been produced by the rule's label template.
+func (r *Rule) emits(label db.TicketLabel) bool {
+	if i := strings.Index(r.Label, "${"); i >= 0 {
+		return strings.HasPrefix(string(label), r.Label[:i])
+	}
+	return string(label) == r.Label
+}
+
+// ApplyKeywords sets the [db.Metadata] flags mapped from the submission's keywords.
+func (s *Set) ApplyKeywords(submission *db.Submission) {
+	for _, keyword := range submission.Keywords {
+		for _, mapping := range s.Keywords {
+			if !slices.Contains(mapping.IDs, keyword.KeywordID) && !slices.ContainsFunc(mapping.Names, func(name string) bool {
+				return strings.EqualFold(name, keyword.KeywordName)
+			}) {
+				continue
+			}
+			for _, flag := range mapping.Set {
+				metadataFlags[flag](&submission.Metadata)
+			}
+			if mapping.AI {
+				submission.Metadata.AISubmission = true
+				if !slices.Contains(submission.Metadata.AIKeywords, keyword.KeywordName) {
+					submission.Metadata.AIKeywords = append(submission.Metadata.AIKeywords, keyword.KeywordName)
+				}
+			}
+		}
+	}
+}
+
+var metadataFlags = map[string]func(*db.Metadata){
+	"generated":        func(m *db.Metadata) { m.Generated = true },
+	"assisted":         func(m *db.Metadata) { m.Assisted = true },
+	"img2img":          func(m *db.Metadata) { m.Img2Img = true },
+	"stable_diffusion": func(m *db.Metadata) { m.StableDiffusion = true },
+	"comfy_ui":         func(m *db.Metadata) { m.ComfyUI = true },
+	"tagged_human":     func(m *db.Metadata) { m.TaggedHuman = true },
+}
+
+// compile validates the condition tree and compiles any regular expressions.
+func (c *Condition) compile() error {
+	var set int
+	for _, b := range []bool{len(c.All) > 0, len(c.Any) > 0, c.Not != nil, c.Fact != ""} {
+		if b {
+			set++
+		}
+	}
+	if set != 1 {
+		return errors.New("condition must have exactly one of all, any, not or fact")
+	}
+	for i := range c.All {
+		if err := c.All[i].compile(); err != nil {
+			return err
+		}
+	}
+	for i := range c.Any {
+		if err := c.Any[i].compile(); err != nil {
+			return err
+		}
+	}
+	if c.Not != nil {
+		return c.Not.compile()
+	}
+	if c.Fact == "" {
+		return nil
+	}
+	if !knownFact(c.Fact) {
+		return fmt.Errorf("unknown fact %q", c.Fact)
+	}
+	if c.Op == "" {
+		c.Op = OpTrue
+	}
+	if !slices.Contains(operators, c.Op) {
+		return fmt.Errorf("unknown operator %q", c.Op)
+	}
+	switch c.Each {
+	case "", EachAny, EachAll, EachNone:
+	default:
+		return fmt.Errorf("unknown quantifier %q", c.Each)
+	}
+	if c.Op == OpMatches {
+		pattern, ok := c.Value.(string)
+		if !ok {
+			return fmt.Errorf("fact %s: matches requires a string pattern", c.Fact)
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("fact %s: %w", c.Fact, err)
+		}
+		c.re = re
+	}
+	return nil
+}
@@ -0,0 +1,364 @@
+package rules
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ellypaws/inkbunny-sd/entities"
+	"github.com/ellypaws/inkbunny/api"
+
+	"github.com/ellypaws/inkbunny-app/pkg/db"
+)
+
+func TestDefault(t *testing.T) {
+	set := Default()
+	if set == nil {
+		t.Fatal("default rules failed to parse")
+	}
+	if set.Version == "" {
+		t.Error("default rules are missing a version")
+	}
+}
+
+func TestSet_Labels(t *testing.T) {
+	checkpoint := "yiffymix"
+	const currentRevision db.TicketLabel = "acp_revision:2022-11-21"
+	tests := []struct {
+		name       string
+		submission db.Submission
+		want       []db.TicketLabel
+		subject    string
+	}{
+		{
+			name:       "not an AI submission",
+			submission: db.Submission{Metadata: db.Metadata{TaggedHuman: true}},
+			want:       []db.TicketLabel{db.LabelTaggedHuman},
+			subject:    "is not following AI ACP",
+		},
+		{
+			name:       "no labels",
+			submission: db.Submission{},
+			want:       []db.TicketLabel{},
+			subject:    "needs to be reviewed",
+		},
+		{
+			name: "missing params",
+			submission: db.Submission{
+				Updated:     time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
+				Description: "support me on Ko-fi",
+				Metadata:    db.Metadata{AISubmission: true, MissingTags: true},
+			},
+			want:    []db.TicketLabel{db.LabelMissingParams, db.LabelMissingTags, "payment_mention:Ko-fi", currentRevision},
+			subject: "does not have any parameters",
+		},
+		{
+			name: "cannot parse before revision",
+			submission: db.Submission{
+				Updated:  time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC),
+				Metadata: db.Metadata{AISubmission: true, HasTxt: true},
+			},
+			want:    []db.TicketLabel{db.LabelCannotParse, db.LabelBeforeRuleRevision},
+			subject: "is not following AI ACP",
+		},
+		{
+			name: "missing prompt after revision",
+			submission: db.Submission{
+				Updated: time.Date(2022, time.November, 21, 0, 0, 0, 0, time.UTC),
+				Metadata: db.Metadata{
+					AISubmission:  true,
+					MissingPrompt: true,
+					Objects:       map[string]entities.TextToImageRequest{"a.txt": {Seed: 1, Steps: 20, CFGScale: 7, SamplerName: "Euler", OverrideSettings: entities.OverrideSettings{SDModelCheckpoint: &checkpoint}}},
+				},
+			},
+			want:    []db.TicketLabel{db.LabelMissingPrompt, currentRevision},
+			subject: "is missing the prompt",
+		},
+		{
+			name: "missing prompt before revision",
+			submission: db.Submission{
+				Updated: time.Date(2022, time.November, 20, 0, 0, 0, 0, time.UTC),
+				Metadata: db.Metadata{
+					AISubmission:  true,
+					MissingPrompt: true,
+					MissingTags:   true,
+					Objects:       map[string]entities.TextToImageRequest{"a.txt": {Seed: 1, Steps: 20, CFGScale: 7, SamplerName: "Euler", OverrideSettings: entities.OverrideSettings{SDModelCheckpoint: &checkpoint}}},
+				},
+			},
+			want:    []db.TicketLabel{"info:missing_prompt", db.LabelMissingTags, db.LabelBeforeRuleRevision},
+			subject: "is missing the AI tags",
+		},
+		{
+			name: "partial and missing hints",
+			submission: db.Submission{
+				Updated: time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
+				Metadata: db.Metadata{
+					AISubmission: true,
+					Objects: map[string]entities.TextToImageRequest{
+						"a.txt": {Prompt: "a cat", Seed: -1, Steps: 20, CFGScale: 7, SamplerName: "Euler"},
+						"b.txt": {Prompt: "", Seed: -1, Steps: 20, CFGScale: 7, SamplerName: "Euler",
+							OverrideSettings: entities.OverrideSettings{SDModelCheckpoint: &checkpoint}},
+					},
+				},
+			},
+			want:    []db.TicketLabel{db.LabelMissingSeed, "partial_prompt", "partial_model", currentRevision},
+			subject: "is missing the generation seed",
+		},
+		{
+			name: "too many",
+			submission: db.Submission{
+				Updated: time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
+				Metadata: db.Metadata{
+					AISubmission: true,
+					TooMany:      true,
+					Objects: map[string]entities.TextToImageRequest{
+						"a.txt": {Prompt: "a cat", Seed: 1, Steps: 20, CFGScale: 7, SamplerName: "Euler",
+							OverrideSettings: entities.OverrideSettings{SDCheckpointHash: "abcdef"}},
+					},
+				},
+			},
+			want:    []db.TicketLabel{db.LabelTooMany},
+			subject: "has more than six images with the same prompt",
+		},
+		{
+			name: "private tool",
+			submission: db.Submission{
+				Updated: time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
+				Metadata: db.Metadata{
+					AISubmission: true,
+					PrivateTool:  true,
+					Generator:    "midjourney",
+					ArtistUsed:   []db.Artist{{Username: "artist"}},
+					Objects: map[string]entities.TextToImageRequest{
+						"a.txt": {Prompt: "by artist", Seed: 1, Steps: 20, CFGScale: 7, SamplerName: "Euler",
+							OverrideSettings: entities.OverrideSettings{SDCheckpointHash: "abcdef"}},
+					},
+				},
+			},
+			want:    []db.TicketLabel{db.LabelArtistUsed, "private_tool:midjourney"},
+			subject: "has used an artist in the prompt",
+		},
+		{
+			name: "character used",
+			submission: db.Submission{
+				Updated: time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
+				Metadata: db.Metadata{
+					AISubmission:  true,
+					CharacterUsed: []db.Character{{Name: "sunny", Owner: "owner"}},
+					Objects: map[string]entities.TextToImageRequest{
+						"a.txt": {Prompt: "sunny, solo", Seed: 1, Steps: 20, CFGScale: 7, SamplerName: "Euler",
+							OverrideSettings: entities.OverrideSettings{SDCheckpointHash: "abcdef"}},
+					},
+				},
+			},
+			want:    []db.TicketLabel{db.LabelCharacterUsed},
+			subject: "has used a character in the prompt",
+		},
+		{
+			name: "private models",
+			submission: db.Submission{
+				Updated: time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
+				Metadata: db.Metadata{
+					AISubmission:  true,
+					PrivateLora:   true,
+					PrivateLoras:  []string{"0123456789ab", "ba9876543210"},
+					PrivateModel:  true,
+					PrivateModels: []string{"abcdef"},
+					Objects: map[string]entities.TextToImageRequest{
+						"a.txt": {Prompt: "a cat", Seed: 1, Steps: 20, CFGScale: 7, SamplerName: "Euler",
+							LoraHashes:       map[string]string{"0123456789ab": "one", "ba9876543210": "two"},
+							OverrideSettings: entities.OverrideSettings{SDCheckpointHash: "abcdef"}},
+					},
+				},
+			},
+			want:    []db.TicketLabel{"private_lora:0123456789ab,ba9876543210", "private_model:abcdef"},
+			subject: "was generated using a private Lora model",
+		},
+		{
+			name: "missing tool and model tags",
+			submission: db.Submission{
+				Updated: time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
+				Metadata: db.Metadata{
+					AISubmission:      true,
+					Generated:         true,
+					MissingToolTags:   []string{"comfyui", "img2img"},
+					MissingModelTags:  []string{"yiffymix"},
+					SuggestedKeywords: []string{"comfyui", "img2img", "yiffymix"},
+					Objects: map[string]entities.TextToImageRequest{
+						"a.txt": {Prompt: "a cat", Seed: 1, Steps: 20, CFGScale: 7, SamplerName: "Euler",
+							OverrideSettings: entities.OverrideSettings{SDCheckpointHash: "abcdef"}},
+					},
+				},
+			},
+			want:    []db.TicketLabel{"missing_tool_tag:comfyui", "missing_tool_tag:img2img", "missing_model_tag:yiffymix"},
+			subject: "is missing the tool tags",
+		},
+	}
+	set := Default()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := set.Labels(&tt.submission)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Labels() = %v, want %v", got, tt.want)
+			}
+			if subject := set.SubjectFor(got); subject != tt.subject {
+				t.Errorf("SubjectFor() = %q, want %q", subject, tt.subject)
+			}
+		})
+	}
+}
+
+func TestSet_Revisions(t *testing.T) {
+	set, err := Load(filepath.Join("testdata", "revisions.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata := db.Metadata{MissingPrompt: true, TooMany: true, MissingTags: true}
+
+	tests := []struct {
+		name     string
+		updated  time.Time
+		revision string
+		want     []db.TicketLabel
+		subject  string
+	}{
+		{
+			name:    "before both revisions",
+			updated: time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC),
+			want:    []db.TicketLabel{"info:missing_prompt", "info:too_many", db.LabelMissingTags, db.LabelBeforeRuleRevision},
+			subject: "is missing the AI tags",
+		},
+		{
+			name:     "on the first revision",
+			updated:  time.Date(2022, time.November, 21, 0, 0, 0, 0, time.UTC),
+			revision: "2022-11-21",
+			want:     []db.TicketLabel{db.LabelMissingPrompt, "info:too_many", db.LabelMissingTags, "acp_revision:2022-11-21"},
+			subject:  "is missing the prompt",
+		},
+		{
+			name:     "between the revisions",
+			updated:  time.Date(2023, time.May, 31, 0, 0, 0, 0, time.UTC),
+			revision: "2022-11-21",
+			want:     []db.TicketLabel{db.LabelMissingPrompt, "info:too_many", db.LabelMissingTags, "acp_revision:2022-11-21"},
+			subject:  "is missing the prompt",
+		},
+		{
+			name:     "after the second revision",
+			updated:  time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
+			revision: "2023-06-01",
+			want:     []db.TicketLabel{db.LabelMissingPrompt, db.LabelTooMany, db.LabelMissingTags, "acp_revision:2023-06-01"},
+			subject:  "is missing the prompt",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			revision := set.RevisionAt(tt.updated)
+			switch {
+			case tt.revision == "" && revision != nil:
+				t.Errorf("RevisionAt() = %s, want none", revision.ID)
+			case tt.revision != "" && (revision == nil || revision.ID != tt.revision):
+				t.Errorf("RevisionAt() = %+v, want %s", revision, tt.revision)
+			}
+
+			submission := db.Submission{Updated: tt.updated, Metadata: metadata}
+			labels := set.Labels(&submission)
+			if !slices.Equal(labels, tt.want) {
+				t.Errorf("Labels() = %v, want %v", labels, tt.want)
+			}
+			if subject := set.SubjectFor(labels); subject != tt.subject {
+				t.Errorf("SubjectFor() = %q, want %q", subject, tt.subject)
+			}
+		})
+	}
+}
+
+func TestSet_ApplyKeywords(t *testing.T) {
+	submission := db.Submission{
+		Keywords: []api.Keyword{
+			{KeywordID: db.AIGeneratedID, KeywordName: "ai generated"},
+			{KeywordID: db.ComfyUIID, KeywordName: "comfyui"},
+			{KeywordID: "1", KeywordName: "human"},
+		},
+	}
+	Default().ApplyKeywords(&submission)
+
+	metadata := submission.Metadata
+	if !metadata.Generated || !metadata.ComfyUI || !metadata.TaggedHuman || !metadata.AISubmission {
+		t.Errorf("ApplyKeywords() did not set the expected flags: %+v", metadata)
+	}
+	if !slices.Equal(metadata.AIKeywords, []string{"ai generated", "comfyui"}) {
+		t.Errorf("ApplyKeywords() AIKeywords = %v", metadata.AIKeywords)
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   string
+		wantErr bool
+	}{
+		{
+			name:  "json",
+			rules: `{"version":"1","rules":[{"label":"json","when":{"fact":"metadata.has_json"}}]}`,
+		},
+		{
+			name:    "missing version",
+			rules:   `{"rules":[{"label":"json","when":{"fact":"metadata.has_json"}}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown fact",
+			rules:   `{"version":"1","rules":[{"label":"json","when":{"fact":"unknown"}}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown metadata fact",
+			rules:   `{"version":"1","rules":[{"label":"json","when":{"fact":"metadata.has_jsn"}}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown for_each fact",
+			rules:   `{"version":"1","rules":[{"label":"json:${item}","for_each":"unknown","when":{"fact":"title"}}]}`,
+			wantErr: true,
+		},
+		{
+			name:  "revision",
+			rules: `{"version":"1","revisions":[{"id":"1","date":"2024-01-01T00:00:00Z","rules":["json"]}],"rules":[{"label":"json","when":{"fact":"title"}}]}`,
+		},
+		{
+			name:    "revision of an unknown rule",
+			rules:   `{"version":"1","revisions":[{"id":"1","date":"2024-01-01T00:00:00Z","rules":["txt"]}],"rules":[{"label":"json","when":{"fact":"title"}}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "revision without a date",
+			rules:   `{"version":"1","revisions":[{"id":"1","rules":["json"]}],"rules":[{"label":"json","when":{"fact":"title"}}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown operator",
+			rules:   `{"version":"1","rules":[{"label":"json","when":{"fact":"title","op":"like"}}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid pattern",
+			rules:   `{"version":"1","rules":[{"label":"json","when":{"fact":"title","op":"matches","value":"("}}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "ambiguous condition",
+			rules:   `{"version":"1","rules":[{"label":"json","when":{"fact":"title","not":{"fact":"title"}}}]}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.rules))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -2,36 +2,59 @@ package api
 
 import (
 	"fmt"
+	"net/http"
 	"net/url"
+	"sync"
+	"time"
 
+	"github.com/go-errors/errors"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	logger "github.com/labstack/gommon/log"
 
+	"github.com/ellypaws/inkbunny-app/pkg/api/cache"
+	"github.com/ellypaws/inkbunny-app/pkg/api/rules"
+	"github.com/ellypaws/inkbunny-app/pkg/api/service"
 	"github.com/ellypaws/inkbunny-app/pkg/db"
 	sd "github.com/ellypaws/inkbunny-sd/stable_diffusion"
 )
 
 var (
-	Database   *db.Sqlite
+	Database   db.Store
 	SDHost     = sd.DefaultHost
 	ServerHost *url.URL
+	// Queue stores reviewed submissions in Database without holding up the review
+	Queue *service.SubmissionQueue
+	// CorpusDir is where cases added through /corpus/:id are written, see service.CorpusCase
+	CorpusDir = "corpus"
 )
 
 type RunConfig struct {
-	Database    *db.Sqlite
+	Database    db.Store
 	SDHost      *sd.Host
 	ServerHost  *url.URL
 	Port        uint
 	LogLevel    logger.Lvl
 	Middlewares []echo.MiddlewareFunc
 	Extra       []func(e *echo.Echo)
+	CorpusDir   string
 }
 
 func Run(config RunConfig) {
 	Database = config.Database
 	SDHost = config.SDHost
 	ServerHost = config.ServerHost
+	if config.CorpusDir != "" {
+		CorpusDir = config.CorpusDir
+	}
+	if Database != nil {
+		Queue = service.NewSubmissionQueue(Database, 256)
+		if err := service.RegisterParserDefinitions(Database.AllParserDefinitions()); err != nil {
+			logger.Errorf("error registering parser definitions: %v", err)
+		}
+		loadRules()
+		service.UpdateListsRevision(service.ReadLists(Database))
+	}
 
 	e := echo.New()
 
@@ -53,9 +76,34 @@ func Run(config RunConfig) {
 		f(e)
 	}
 
+	if Database != nil {
+		go reevaluateStale(e)
+	}
+
 	e.Logger.Fatal(e.Start(fmt.Sprintf(":%d", config.Port)))
 }
 
+// loadRules activates the rule set last activated through PUT /rules, keeping the active rules if there is none.
+// A stored rule set takes precedence over the default rules and the ones loaded from RULES, the replaced set is logged.
+func loadRules() {
+	stored, err := Database.GetActiveRuleSet()
+	if errors.Is(err, db.ErrMissingRuleSet) {
+		return
+	}
+	if err != nil {
+		logger.Errorf("error loading the active rule set: %v", err)
+		return
+	}
+	set, err := rules.Parse([]byte(stored.Source))
+	if err != nil {
+		logger.Errorf("error parsing the active rule set %d: %v", stored.ID, err)
+		return
+	}
+	replaced := rules.Active()
+	rules.SetActive(set)
+	logger.Infof("activated rules %s from %s, replacing rules %s", set.Version, stored.Created.Format(time.DateOnly), replaced.Version)
+}
+
 type route = func(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route
 
 type handler struct {
@@ -70,3 +118,89 @@ func registerAs(route route, pathHandler pathHandler) {
 		route(path, handler.handler, handler.middleware...)
 	}
 }
+
+// reevaluation is the state of the background re-evaluation of stored submissions, see reevaluate.
+var reevaluation struct {
+	sync.Mutex
+	running bool
+	pending bool                // the version or the lists changed while running
+	changes service.ListChanges // the lists that changed while running
+	last    *service.ReevaluationReport
+}
+
+// reevaluatePause is the time between pages of stored submissions, so a re-evaluation doesn't compete with reviews.
+const reevaluatePause = 2 * time.Second
+
+// reevaluateStale starts reevaluate if the last finished run was under another service.Version.
+func reevaluateStale(e *echo.Echo) {
+	last, err := Database.GetLastReevaluation()
+	if err == nil && last.Version == service.Version() {
+		e.Logger.Infof("stored submissions were re-evaluated under %s on %s", last.Version, last.Finished.Format(time.DateTime))
+		return
+	}
+	if err != nil && !errors.Is(err, db.ErrMissingReevaluation) {
+		e.Logger.Errorf("error reading the last re-evaluation: %v", err)
+	}
+	reevaluate(e, service.ListChanges{})
+}
+
+// reevaluate evaluates the stored submissions of an older service.Version, or affected by changes, again
+// and logs the labels that changed. It's started when the server starts with another version than the last run,
+// when the rules change and when staff change the artists, characters or parser bindings.
+// If a run is in progress, another follows it.
+func reevaluate(e *echo.Echo, changes service.ListChanges) {
+	reevaluation.Lock()
+	if reevaluation.running {
+		reevaluation.pending = true
+		reevaluation.changes = reevaluation.changes.Merge(changes)
+		reevaluation.Unlock()
+		return
+	}
+	reevaluation.running = true
+	reevaluation.Unlock()
+
+	for {
+		report := reevaluateStored(e, changes)
+
+		reevaluation.Lock()
+		reevaluation.last = &report
+		if !reevaluation.pending {
+			reevaluation.running = false
+			reevaluation.Unlock()
+			return
+		}
+		changes = reevaluation.changes
+		reevaluation.pending = false
+		reevaluation.changes = service.ListChanges{}
+		reevaluation.Unlock()
+	}
+}
+
+func reevaluateStored(e *echo.Echo, changes service.ListChanges) service.ReevaluationReport {
+	req, _ := http.NewRequestWithContext(Database.Context(), http.MethodGet, "/", nil)
+	c := e.NewContext(req, nil)
+	if cache.Initialized {
+		c.Set("redis", cache.RedisClient())
+	}
+
+	report, err := service.ReevaluateStored(c, Database, cache.SwitchCache(c), reevaluatePause, changes)
+	if err != nil {
+		e.Logger.Errorf("error re-evaluating stored submissions: %v", err)
+	}
+	err = Database.InsertReevaluation(db.Reevaluation{
+		Version:   report.Version,
+		Started:   report.Started,
+		Finished:  report.Finished,
+		Evaluated: report.Evaluated,
+		Changed:   len(report.Changed),
+		Error:     report.Error,
+	})
+	if err != nil {
+		e.Logger.Errorf("error recording the re-evaluation: %v", err)
+	}
+	for _, change := range report.Changed {
+		e.Logger.Infof("re-evaluated submission %d (%s): added %v, removed %v", change.SubmissionID, change.From, change.Added, change.Removed)
+	}
+	e.Logger.Infof("re-evaluated %d stored submissions under %s, %d changed", report.Evaluated, report.Version, len(report.Changed))
+	return report
+}
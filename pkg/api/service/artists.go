@@ -0,0 +1,127 @@
+package service
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ellypaws/inkbunny-app/pkg/db"
+)
+
+var artistMatchers nameMatchers
+
+// artistMatcherFor returns the matcher for artists, compiled once per version of the artist list.
+// The patterns line up with artists, so consents are always read from the current list.
+func artistMatcherFor(artists []db.Artist) *nameMatcher {
+	names := make([][]string, len(artists))
+	for i, artist := range artists {
+		names[i] = append([]string{artist.Username}, artist.Aliases...)
+	}
+	return artistMatchers.get(names)
+}
+
+// artistHighlights returns the matches of artists to highlight, linking registered artists.
+// Artists stored before matches were recorded are searched for in the objects of sub.
+func artistHighlights(sub *db.Submission, artists []db.Artist) []promptHighlight {
+	var highlights []promptHighlight
+	for _, artist := range artists {
+		matches := artist.Matches
+		if len(matches) == 0 {
+			matches = newNamePattern(append([]string{artist.Username}, artist.Aliases...)...).findAll(sub.Metadata.Objects)
+		}
+		var account string
+		if artist.UserID != nil {
+			account = artist.Username
+		}
+		for _, match := range matches {
+			highlights = append(highlights, promptHighlight{PromptMatch: match, Account: account})
+		}
+	}
+	return highlights
+}
+
+// additionalArtists matches "by artist" tags in a normalized prompt
+var additionalArtists = regexp.MustCompile(`(?:^|, )by ([^,]+)`)
+
+// findArtists adds the artists found in the prompts of the submission to ArtistUsed or ArtistConsented.
+// Registered artists are matched by username and aliases, other artists by "by artist" tags.
+// Artists only found in negative prompts are ignored, but the negative matches of used artists are kept.
+func findArtists(submission *db.Submission, artists []db.Artist) {
+	// consents are checked against the time the submission was last updated
+	at := submission.Updated
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	matcher := artistMatcherFor(artists)
+	for name, obj := range submission.Metadata.Objects {
+		prompt := normalizePrompt(obj.Prompt)
+		negative := normalizePrompt(obj.NegativePrompt)
+		for i, pattern := range matcher.patterns {
+			matches := pattern.find(name, prompt, false)
+			if len(matches) == 0 {
+				continue
+			}
+			artist := artists[i]
+			artist.Matches = append(matches, pattern.find(name, negative, true)...)
+			useArtist(submission, artist, obj.Prompt, at)
+		}
+
+		for _, loc := range additionalArtists.FindAllStringSubmatchIndex(prompt.text, -1) {
+			normalized := prompt.text[loc[2]:loc[3]]
+			if slices.ContainsFunc(matcher.patterns, func(pattern namePattern) bool {
+				_, ok := pattern.names[normalized]
+				return ok
+			}) {
+				continue
+			}
+			start, end := prompt.span(loc[2], loc[3])
+			username := obj.Prompt[start:end]
+			useArtist(submission, db.Artist{
+				Username: username,
+				Matches:  []db.PromptMatch{{Alias: username, Object: name, Start: start, End: end}},
+			}, obj.Prompt, at)
+		}
+	}
+
+	for _, artists := range [][]db.Artist{submission.Metadata.ArtistUsed, submission.Metadata.ArtistConsented} {
+		for i := range artists {
+			sortPromptMatches(artists[i].Matches)
+		}
+	}
+}
+
+// useArtist adds artist to ArtistConsented if one of its consents covers the prompt, otherwise to ArtistUsed.
+// A use that isn't covered in any of the prompts takes precedence over a consented one.
+func useArtist(submission *db.Submission, artist db.Artist, prompt string, at time.Time) {
+	var covering []db.ArtistConsent
+	for _, consent := range artist.Consents {
+		if consent.Covers(submission.Username, prompt, at) {
+			covering = append(covering, consent)
+		}
+	}
+	artist.Consents = covering
+
+	same := func(stored db.Artist) bool {
+		return strings.EqualFold(stored.Username, artist.Username)
+	}
+	if i := slices.IndexFunc(submission.Metadata.ArtistUsed, same); i >= 0 {
+		submission.Metadata.ArtistUsed[i].Matches = append(submission.Metadata.ArtistUsed[i].Matches, artist.Matches...)
+		return
+	}
+	i := slices.IndexFunc(submission.Metadata.ArtistConsented, same)
+	if len(covering) == 0 {
+		if i >= 0 {
+			artist.Matches = append(submission.Metadata.ArtistConsented[i].Matches, artist.Matches...)
+			submission.Metadata.ArtistConsented = slices.Delete(submission.Metadata.ArtistConsented, i, i+1)
+		}
+		submission.Metadata.ArtistUsed = append(submission.Metadata.ArtistUsed, artist)
+		return
+	}
+	if i >= 0 {
+		submission.Metadata.ArtistConsented[i].Matches = append(submission.Metadata.ArtistConsented[i].Matches, artist.Matches...)
+		return
+	}
+	submission.Metadata.ArtistConsented = append(submission.Metadata.ArtistConsented, artist)
+}
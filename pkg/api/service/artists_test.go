@@ -0,0 +1,107 @@
+package service
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/ellypaws/inkbunny-sd/entities"
+
+	"github.com/ellypaws/inkbunny-app/pkg/db"
+)
+
+func TestNormalizePrompt(t *testing.T) {
+	tests := []struct {
+		prompt string
+		want   string
+	}{
+		{`(by_some_body:1.3), 1girl`, `by some body, 1girl`},
+		{`[Some Body|other]`, `some body, other`},
+		{`some_body_\(artist\), solo`, `some body, artist, solo`},
+		{`<lora:some_body:0.8>`, `lora, some body`},
+		{"a  cat\nby  somebody", `a cat, by somebody`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.prompt, func(t *testing.T) {
+			if got := normalizePrompt(tt.prompt).text; got != tt.want {
+				t.Errorf("normalizePrompt() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindArtists(t *testing.T) {
+	id := int64(1)
+	artists := []db.Artist{
+		{Username: "Some_Body", UserID: &id, Aliases: []string{"sb_artist"}},
+		{Username: "nobody"},
+	}
+	prompt := `masterpiece, (some body:1.2), [sb artist|cat], by_Unknown_Person`
+	submission := db.Submission{
+		Username: "user",
+		Metadata: db.Metadata{
+			Objects: map[string]entities.TextToImageRequest{
+				"image.png": {Prompt: prompt, NegativePrompt: `nobody, some_body`},
+			},
+		},
+	}
+
+	findArtists(&submission, artists)
+
+	used := submission.Metadata.ArtistUsed
+	if len(used) != 2 {
+		t.Fatalf("ArtistUsed = %+v, want Some_Body and Unknown_Person", used)
+	}
+	if used[0].Username != "Some_Body" || used[1].Username != "Unknown_Person" {
+		t.Fatalf("ArtistUsed = %s, %s, want Some_Body, Unknown_Person", used[0].Username, used[1].Username)
+	}
+
+	want := []db.PromptMatch{
+		{Alias: "Some_Body", Object: "image.png", Start: 14, End: 23},
+		{Alias: "sb_artist", Object: "image.png", Start: 31, End: 40},
+		{Alias: "Some_Body", Object: "image.png", Negative: true, Start: 8, End: 17},
+	}
+	if len(used[0].Matches) != len(want) {
+		t.Fatalf("Matches = %+v, want %+v", used[0].Matches, want)
+	}
+	for i, match := range used[0].Matches {
+		if match != want[i] {
+			t.Errorf("Matches[%d] = %+v, want %+v", i, match, want[i])
+		}
+	}
+	if got := prompt[used[1].Matches[0].Start:used[1].Matches[0].End]; got != "Unknown_Person" {
+		t.Errorf("additional artist span = %q, want %q", got, "Unknown_Person")
+	}
+
+	if artistMatcherFor(artists) != artistMatcherFor(artists) {
+		t.Errorf("artistMatcherFor() compiled the same artists twice")
+	}
+}
+
+func TestFindCharacters(t *testing.T) {
+	characters := []db.Character{
+		{ID: 1, Name: "Sunny", Aliases: []string{"sunny_the_fox"}, Owner: "owner"},
+		{ID: 2, Name: "Moon", Owner: "other"},
+	}
+	submission := db.Submission{
+		Metadata: db.Metadata{
+			Objects: map[string]entities.TextToImageRequest{
+				"a.png": {Prompt: `(sunny the fox:1.2), beach`, NegativePrompt: `moon`},
+				"b.png": {Prompt: `sunny, night`},
+			},
+		},
+	}
+
+	findCharacters(&submission, characters)
+
+	used := submission.Metadata.CharacterUsed
+	if len(used) != 1 || used[0].Name != "Sunny" {
+		t.Fatalf("CharacterUsed = %+v, want only Sunny", used)
+	}
+	want := []db.PromptMatch{
+		{Alias: "sunny_the_fox", Object: "a.png", Start: 1, End: 14},
+		{Alias: "Sunny", Object: "b.png", Start: 0, End: 5},
+	}
+	if !slices.Equal(used[0].Matches, want) {
+		t.Errorf("Matches = %+v, want %+v", used[0].Matches, want)
+	}
+}
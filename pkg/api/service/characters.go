@@ -0,0 +1,82 @@
+package service
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/ellypaws/inkbunny-app/pkg/db"
+)
+
+var characterMatchers nameMatchers
+
+// characterMatcherFor returns the matcher for characters, compiled once per version of the character list.
+func characterMatcherFor(characters []db.Character) *nameMatcher {
+	names := make([][]string, len(characters))
+	for i, character := range characters {
+		names[i] = append([]string{character.Name}, character.Aliases...)
+	}
+	return characterMatchers.get(names)
+}
+
+// findCharacters adds the registered characters found in the prompts of the submission to CharacterUsed.
+// Characters only found in negative prompts are ignored, but the negative matches of used characters are kept.
+func findCharacters(submission *db.Submission, characters []db.Character) {
+	matcher := characterMatcherFor(characters)
+	for name, obj := range submission.Metadata.Objects {
+		prompt := normalizePrompt(obj.Prompt)
+		negative := normalizePrompt(obj.NegativePrompt)
+		for i, pattern := range matcher.patterns {
+			matches := pattern.find(name, prompt, false)
+			if len(matches) == 0 {
+				continue
+			}
+			matches = append(matches, pattern.find(name, negative, true)...)
+
+			character := characters[i]
+			if j := slices.IndexFunc(submission.Metadata.CharacterUsed, func(stored db.Character) bool {
+				return strings.EqualFold(stored.Name, character.Name) && strings.EqualFold(stored.Owner, character.Owner)
+			}); j >= 0 {
+				submission.Metadata.CharacterUsed[j].Matches = append(submission.Metadata.CharacterUsed[j].Matches, matches...)
+				continue
+			}
+			character.Matches = matches
+			submission.Metadata.CharacterUsed = append(submission.Metadata.CharacterUsed, character)
+		}
+	}
+
+	for i := range submission.Metadata.CharacterUsed {
+		sortPromptMatches(submission.Metadata.CharacterUsed[i].Matches)
+	}
+}
+
+// writeCharacterUsed names the characters in CharacterUsed with their owners and quotes the prompts they were found in.
+func writeCharacterUsed(sub *db.Submission) string {
+	sb := NewChunkedWriter(10000, "\n--------✂️--------")
+	if len(sub.Metadata.CharacterUsed) == 0 {
+		return ""
+	}
+
+	var highlights []promptHighlight
+	for i, character := range sub.Metadata.CharacterUsed {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(fmt.Sprintf("[b]%s[/b] owned by ib!%s", character.Name, character.Owner))
+		if i == len(sub.Metadata.CharacterUsed)-1 {
+			sb.WriteString("\n")
+		}
+
+		matches := character.Matches
+		if len(matches) == 0 {
+			matches = newNamePattern(append([]string{character.Name}, character.Aliases...)...).findAll(sub.Metadata.Objects)
+		}
+		for _, match := range matches {
+			highlights = append(highlights, promptHighlight{PromptMatch: match, Account: character.Owner})
+		}
+	}
+
+	writePromptHighlights(&sb, sub, highlights)
+
+	return sb.String()
+}
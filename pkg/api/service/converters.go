@@ -0,0 +1,322 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ellypaws/inkbunny-sd/entities"
+)
+
+// recognizer is implemented by converters for formats that share field names with other formats.
+// preferBest skips objects that don't recognize the blob they were read from.
+type recognizer interface {
+	Recognized() bool
+}
+
+// flexibleInt reads a number that some frontends write as a string.
+type flexibleInt int64
+
+func (i *flexibleInt) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+	if s == "" || s == "null" {
+		return nil
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return fmt.Errorf("error parsing number %s: %w", b, err)
+	}
+	*i = flexibleInt(n)
+	return nil
+}
+
+var resolution = regexp.MustCompile(`(\d+)\s*[x×,]\s*(\d+)`)
+
+// parseResolution reads sizes written as "(1024, 1024)" or "1024x1024".
+func parseResolution(s string) (width, height int) {
+	match := resolution.FindStringSubmatch(s)
+	if match == nil {
+		return 0, 0
+	}
+	width, _ = strconv.Atoi(match[1])
+	height, _ = strconv.Atoi(match[2])
+	return width, height
+}
+
+// Fooocus is the log entry Fooocus writes for each image, also embedded with metadata_scheme "fooocus".
+type Fooocus struct {
+	Prompt         string      `json:"prompt"`
+	NegativePrompt string      `json:"negative_prompt"`
+	Resolution     string      `json:"resolution"`
+	GuidanceScale  float64     `json:"guidance_scale"`
+	Steps          int         `json:"steps"`
+	Sampler        string      `json:"sampler"`
+	Scheduler      string      `json:"scheduler"`
+	BaseModel      string      `json:"base_model"`
+	BaseModelHash  string      `json:"base_model_hash"`
+	Loras          [][]any     `json:"loras"` // [name, weight] or [name, weight, hash]
+	Seed           flexibleInt `json:"seed"`
+	MetadataScheme string      `json:"metadata_scheme"`
+	Version        string      `json:"version"`
+}
+
+func (f *Fooocus) Recognized() bool {
+	return f.MetadataScheme == "fooocus" || strings.HasPrefix(f.Version, "Fooocus")
+}
+
+func (f *Fooocus) Convert() *entities.TextToImageRequest {
+	width, height := parseResolution(f.Resolution)
+	request := &entities.TextToImageRequest{
+		Prompt:         f.Prompt,
+		NegativePrompt: f.NegativePrompt,
+		Seed:           int64(f.Seed),
+		Steps:          f.Steps,
+		CFGScale:       f.GuidanceScale,
+		SamplerName:    f.Sampler,
+		Width:          width,
+		Height:         height,
+		OverrideSettings: entities.OverrideSettings{
+			SDCheckpointHash: f.BaseModelHash,
+		},
+	}
+	if f.Scheduler != "" {
+		request.Scheduler = &f.Scheduler
+	}
+	if f.BaseModel != "" {
+		request.OverrideSettings.SDModelCheckpoint = &f.BaseModel
+	}
+	for _, lora := range f.Loras {
+		if len(lora) < 3 {
+			continue
+		}
+		name, _ := lora[0].(string)
+		hash, _ := lora[2].(string)
+		if name != "" && hash != "" {
+			if request.LoraHashes == nil {
+				request.LoraHashes = make(map[string]string)
+			}
+			request.LoraHashes[hash] = name
+		}
+	}
+	return request
+}
+
+// SwarmUI is the sui_image_params metadata SwarmUI embeds in its images.
+type SwarmUI struct {
+	Params *struct {
+		Prompt         string      `json:"prompt"`
+		NegativePrompt string      `json:"negativeprompt"`
+		Model          string      `json:"model"`
+		Seed           flexibleInt `json:"seed"`
+		Steps          int         `json:"steps"`
+		CFGScale       float64     `json:"cfgscale"`
+		Width          int         `json:"width"`
+		Height         int         `json:"height"`
+		Sampler        string      `json:"sampler"`
+		Scheduler      string      `json:"scheduler"`
+		InitStrength   float64     `json:"initimagecreativity"`
+	} `json:"sui_image_params"`
+}
+
+func (s *SwarmUI) Recognized() bool {
+	return s.Params != nil
+}
+
+func (s *SwarmUI) Convert() *entities.TextToImageRequest {
+	if s.Params == nil {
+		return &entities.TextToImageRequest{}
+	}
+	p := s.Params
+	request := &entities.TextToImageRequest{
+		Prompt:            p.Prompt,
+		NegativePrompt:    p.NegativePrompt,
+		Seed:              int64(p.Seed),
+		Steps:             p.Steps,
+		CFGScale:          p.CFGScale,
+		SamplerName:       p.Sampler,
+		Width:             p.Width,
+		Height:            p.Height,
+		DenoisingStrength: p.InitStrength,
+	}
+	if p.Scheduler != "" {
+		request.Scheduler = &p.Scheduler
+	}
+	if p.Model != "" {
+		request.OverrideSettings.SDModelCheckpoint = &p.Model
+	}
+	return request
+}
+
+// Forge is the generation JSON of Stable Diffusion WebUI Forge and reForge,
+// which extends the A1111 format with a forge version and Flux's distilled CFG.
+type Forge struct {
+	Prompt                string         `json:"prompt"`
+	NegativePrompt        string         `json:"negative_prompt"`
+	Seed                  int64          `json:"seed"`
+	Steps                 int            `json:"steps"`
+	CFGScale              float64        `json:"cfg_scale"`
+	DistilledCFGScale     float64        `json:"distilled_cfg_scale"`
+	SamplerName           string         `json:"sampler_name"`
+	Scheduler             string         `json:"scheduler"`
+	Width                 int            `json:"width"`
+	Height                int            `json:"height"`
+	DenoisingStrength     float64        `json:"denoising_strength"`
+	SDModelName           string         `json:"sd_model_name"`
+	SDModelHash           string         `json:"sd_model_hash"`
+	Version               string         `json:"version"`
+	ExtraGenerationParams map[string]any `json:"extra_generation_params"`
+}
+
+var forgeVersion = regexp.MustCompile(`^(f\d|classic|neo)|forge`)
+
+func (f *Forge) Recognized() bool {
+	return f.Prompt != "" && (forgeVersion.MatchString(f.Version) || f.DistilledCFGScale != 0)
+}
+
+func (f *Forge) Convert() *entities.TextToImageRequest {
+	request := &entities.TextToImageRequest{
+		Prompt:            f.Prompt,
+		NegativePrompt:    f.NegativePrompt,
+		Seed:              f.Seed,
+		Steps:             f.Steps,
+		CFGScale:          f.CFGScale,
+		SamplerName:       f.SamplerName,
+		Width:             f.Width,
+		Height:            f.Height,
+		DenoisingStrength: f.DenoisingStrength,
+		OverrideSettings: entities.OverrideSettings{
+			SDCheckpointHash: f.SDModelHash,
+		},
+	}
+	if request.CFGScale == 0 {
+		request.CFGScale = f.DistilledCFGScale
+	}
+	scheduler := f.Scheduler
+	if s, ok := f.ExtraGenerationParams["Schedule type"].(string); ok && scheduler == "" {
+		scheduler = s
+	}
+	if scheduler != "" {
+		request.Scheduler = &scheduler
+	}
+	if f.SDModelName != "" {
+		request.OverrideSettings.SDModelCheckpoint = &f.SDModelName
+	}
+	// "Lora hashes": "name: hash, name: hash"
+	if hashes, ok := f.ExtraGenerationParams["Lora hashes"].(string); ok {
+		for _, pair := range strings.Split(hashes, ",") {
+			name, hash, ok := strings.Cut(pair, ":")
+			if !ok {
+				continue
+			}
+			if request.LoraHashes == nil {
+				request.LoraHashes = make(map[string]string)
+			}
+			request.LoraHashes[strings.TrimSpace(hash)] = strings.TrimSpace(name)
+		}
+	}
+	return request
+}
+
+// DrawThings is the configuration Draw Things exports and embeds in its images.
+type DrawThings struct {
+	Prompt         string      `json:"c"`
+	NegativePrompt string      `json:"uc"`
+	Seed           flexibleInt `json:"seed"`
+	Steps          int         `json:"steps"`
+	Scale          float64     `json:"scale"`
+	Sampler        string      `json:"sampler"`
+	Model          string      `json:"model"`
+	Size           string      `json:"size"`
+	Strength       float64     `json:"strength"`
+}
+
+func (d *DrawThings) Recognized() bool {
+	return d.Prompt != "" && (d.Size != "" || d.Model != "")
+}
+
+func (d *DrawThings) Convert() *entities.TextToImageRequest {
+	width, height := parseResolution(d.Size)
+	request := &entities.TextToImageRequest{
+		Prompt:            d.Prompt,
+		NegativePrompt:    d.NegativePrompt,
+		Seed:              int64(d.Seed),
+		Steps:             d.Steps,
+		CFGScale:          d.Scale,
+		SamplerName:       d.Sampler,
+		Width:             width,
+		Height:            height,
+		DenoisingStrength: d.Strength,
+	}
+	if d.Model != "" {
+		request.OverrideSettings.SDModelCheckpoint = &d.Model
+	}
+	return request
+}
+
+// NovelAI is the metadata NovelAI writes in the Comment of its images,
+// either on its own or within the image metadata with Software "NovelAI".
+type NovelAI struct {
+	Prompt         string      `json:"prompt"`
+	NegativePrompt *string     `json:"uc"`
+	Seed           flexibleInt `json:"seed"`
+	Steps          int         `json:"steps"`
+	Scale          float64     `json:"scale"`
+	Sampler        string      `json:"sampler"`
+	NoiseSchedule  string      `json:"noise_schedule"`
+	Width          int         `json:"width"`
+	Height         int         `json:"height"`
+	Strength       float64     `json:"strength"`
+	SignedHash     string      `json:"signed_hash"`
+	Software       string      `json:"Software"`
+	Source         string      `json:"Source"`
+	Comment        string      `json:"Comment"`
+}
+
+func (n *NovelAI) UnmarshalJSON(b []byte) error {
+	type novelAI NovelAI
+	var metadata novelAI
+	if err := json.Unmarshal(b, &metadata); err != nil {
+		return err
+	}
+	if metadata.Comment != "" {
+		comment := novelAI{Software: metadata.Software, Source: metadata.Source}
+		if err := json.Unmarshal([]byte(metadata.Comment), &comment); err != nil {
+			return fmt.Errorf("error parsing NovelAI comment: %w", err)
+		}
+		metadata = comment
+	}
+	*n = NovelAI(metadata)
+	return nil
+}
+
+func (n *NovelAI) Recognized() bool {
+	if n.Software == "NovelAI" {
+		return true
+	}
+	return n.Prompt != "" && n.NegativePrompt != nil && (n.SignedHash != "" || n.NoiseSchedule != "" || strings.HasPrefix(n.Sampler, "k_"))
+}
+
+func (n *NovelAI) Convert() *entities.TextToImageRequest {
+	request := &entities.TextToImageRequest{
+		Prompt:            n.Prompt,
+		Seed:              int64(n.Seed),
+		Steps:             n.Steps,
+		CFGScale:          n.Scale,
+		SamplerName:       n.Sampler,
+		Width:             n.Width,
+		Height:            n.Height,
+		DenoisingStrength: n.Strength,
+	}
+	if n.NegativePrompt != nil {
+		request.NegativePrompt = *n.NegativePrompt
+	}
+	if n.NoiseSchedule != "" {
+		request.Scheduler = &n.NoiseSchedule
+	}
+	if n.Source != "" {
+		request.OverrideSettings.SDModelCheckpoint = &n.Source
+	}
+	return request
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestPreferBestConverters(t *testing.T) {
+	tests := []struct {
+		fixture    string
+		label      string
+		prompt     string
+		seed       int64
+		width      int
+		checkpoint string
+		loras      int
+	}{
+		{fixture: "fooocus.json", label: "fooocus", prompt: "a red fox sitting in a snowy forest", seed: 1928374650, width: 1152, checkpoint: "juggernautXL_v8Rundiffusion.safetensors", loras: 1},
+		{fixture: "swarm_ui.json", label: "swarm_ui", prompt: "a red fox sitting in a snowy forest", seed: 1928374650, width: 1024, checkpoint: "OfficialStableDiffusion/sd_xl_base_1.0"},
+		{fixture: "forge.json", label: "forge", prompt: "a red fox sitting in a snowy forest", seed: 1928374650, width: 896, checkpoint: "flux1-dev-bnb-nf4-v2", loras: 2},
+		{fixture: "draw_things.json", label: "draw_things", prompt: "a red fox sitting in a snowy forest", seed: 1928374650, width: 1024, checkpoint: "sd_xl_base_1.0_f16.ckpt"},
+		{fixture: "novelai.json", label: "novelai", prompt: "a red fox sitting in a snowy forest", seed: 1928374650, width: 832, checkpoint: "NovelAI Diffusion V3 4BDE2A90"},
+	}
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	for _, tt := range tests {
+		t.Run(tt.label, func(t *testing.T) {
+			blob, err := os.ReadFile(filepath.Join("testdata", "converters", tt.fixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+			best := preferBest(c, blob, jsonConverters)
+			if best == nil {
+				t.Fatal("preferBest() = nil")
+			}
+			if best.label != tt.label {
+				t.Fatalf("preferBest() = %s, want %s", best.label, tt.label)
+			}
+			if best.Prompt != tt.prompt || best.Seed != tt.seed || best.Width != tt.width {
+				t.Errorf("Convert() = %+v", best.TextToImageRequest)
+			}
+			if checkpoint := best.OverrideSettings.SDModelCheckpoint; checkpoint == nil || *checkpoint != tt.checkpoint {
+				t.Errorf("checkpoint = %v, want %s", checkpoint, tt.checkpoint)
+			}
+			if len(best.LoraHashes) != tt.loras {
+				t.Errorf("lora hashes = %v, want %d", best.LoraHashes, tt.loras)
+			}
+		})
+	}
+}
+
+func TestNovelAIPrivateTool(t *testing.T) {
+	if !PrivateTools.MatchString("novelai") {
+		t.Error("the novelai generator isn't a private tool")
+	}
+	for label := range jsonConverters {
+		if label != "novelai" && PrivateTools.MatchString(label) {
+			t.Errorf("%s is marked as a private tool", label)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/ellypaws/inkbunny-app/pkg/api/cache"
+	"github.com/ellypaws/inkbunny-app/pkg/db"
+
+	"github.com/ellypaws/inkbunny-sd/entities"
+)
+
+// CorpusCase is a reviewed submission kept to catch changes in the labels the heuristics give it.
+// A corpus is a directory with a directory per case, holding case.json and the attachments of the submission by file name.
+//
+// The submission is anonymized and its metadata reduced to the facts that needed the network or the database
+// when it was reviewed, see [CorpusCase.Run]. Its IDs are kept, as parser bindings are by user.
+type CorpusCase struct {
+	Name       string         `json:"name"`
+	Submission db.Submission  `json:"submission"`
+	Artists    []db.Artist    `json:"artists,omitempty"`    // the known artists found in the submission
+	Characters []db.Character `json:"characters,omitempty"` // the known characters found in the submission
+
+	// Objects and Labels are the expected results
+	Objects map[string]entities.TextToImageRequest `json:"objects,omitempty"`
+	Labels  []db.TicketLabel                       `json:"labels"`
+
+	attachments map[string][]byte
+}
+
+const corpusCaseFile = "case.json"
+
+// corpusURL is the FileURLFull of an attachment within the corpus, the key it's seeded under.
+func corpusURL(name, fileName string) string {
+	return path.Join("corpus", name, fileName)
+}
+
+// NewCorpusCase anonymizes a reviewed submission into a case expecting its current objects and labels.
+// attachment returns the cached content of a file URL, files that aren't cached are left out of the case.
+func NewCorpusCase(name string, sub db.Submission, labels []db.TicketLabel, artists []db.Artist, characters []db.Character, attachment func(url string) ([]byte, bool)) CorpusCase {
+	corpusCase := CorpusCase{
+		Name:        name,
+		Objects:     sub.Metadata.Objects,
+		Labels:      labels,
+		attachments: make(map[string][]byte),
+	}
+
+	for _, artist := range artists {
+		if slices.ContainsFunc(slices.Concat(sub.Metadata.ArtistUsed, sub.Metadata.ArtistConsented), func(used db.Artist) bool {
+			return strings.EqualFold(used.Username, artist.Username)
+		}) {
+			corpusCase.Artists = append(corpusCase.Artists, artist)
+		}
+	}
+	for _, character := range characters {
+		if slices.ContainsFunc(sub.Metadata.CharacterUsed, func(used db.Character) bool {
+			return strings.EqualFold(used.Name, character.Name)
+		}) {
+			corpusCase.Characters = append(corpusCase.Characters, character)
+		}
+	}
+
+	sub.Username = ""
+	sub.URL = ""
+	sub.AuditID = nil
+	sub.Metadata = recordedMetadata(sub.Metadata)
+	sub.Files = slices.Clone(sub.Files)
+	for i, file := range sub.Files {
+		if blob, ok := attachment(file.File.FileURLFull); ok {
+			corpusCase.attachments[file.File.FileName] = blob
+		}
+		sub.Files[i].File.FileURLFull = corpusURL(name, file.File.FileName)
+		sub.Files[i].File.FileURLScreen = ""
+		sub.Files[i].File.FileURLPreview = ""
+		sub.Files[i].Caption = nil
+	}
+	corpusCase.Submission = sub
+
+	return corpusCase
+}
+
+// recordedMetadata keeps the facts that can't be derived again offline,
+// or from the submission alone, like TooMany which is set by FlagTooMany across a user's submissions.
+func recordedMetadata(metadata db.Metadata) db.Metadata {
+	return db.Metadata{
+		TooMany:         metadata.TooMany,
+		DetectedHuman:   metadata.DetectedHuman,
+		HumanConfidence: metadata.HumanConfidence,
+		PrivateModel:    metadata.PrivateModel,
+		PrivateLora:     metadata.PrivateLora,
+		PrivateModels:   metadata.PrivateModels,
+		PrivateLoras:    metadata.PrivateLoras,
+		ForSale:         metadata.ForSale,
+		ContentRepost:   metadata.ContentRepost,
+		Reposts:         metadata.Reposts,
+	}
+}
+
+// LoadCorpus reads every case in dir, sorted by name.
+func LoadCorpus(dir string) ([]CorpusCase, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var cases []CorpusCase
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		corpusCase, err := loadCorpusCase(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("error loading case %s: %w", entry.Name(), err)
+		}
+		cases = append(cases, corpusCase)
+	}
+	return cases, nil
+}
+
+func loadCorpusCase(dir string) (CorpusCase, error) {
+	var corpusCase CorpusCase
+	b, err := os.ReadFile(filepath.Join(dir, corpusCaseFile))
+	if err != nil {
+		return corpusCase, err
+	}
+	if err := json.Unmarshal(b, &corpusCase); err != nil {
+		return corpusCase, err
+	}
+	if corpusCase.Name == "" {
+		corpusCase.Name = filepath.Base(dir)
+	}
+
+	corpusCase.attachments = make(map[string][]byte)
+	for _, file := range corpusCase.Submission.Files {
+		blob, err := os.ReadFile(filepath.Join(dir, filepath.Base(file.File.FileName)))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return corpusCase, err
+		}
+		corpusCase.attachments[file.File.FileName] = blob
+	}
+	return corpusCase, nil
+}
+
+// Write stores the case and its attachments in a directory named after it within dir, replacing an earlier version.
+func (cc CorpusCase) Write(dir string) error {
+	if cc.Name == "" || cc.Name != filepath.Base(cc.Name) || strings.HasPrefix(cc.Name, ".") {
+		return fmt.Errorf("error: invalid case name %q", cc.Name)
+	}
+	dir = filepath.Join(dir, cc.Name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(cc, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, corpusCaseFile), append(b, '\n'), 0644); err != nil {
+		return err
+	}
+	for fileName, blob := range cc.attachments {
+		if err := os.WriteFile(filepath.Join(dir, filepath.Base(fileName)), blob, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run derives the metadata of the submission again as processSubmission does, using only cacheToUse,
+// and returns the objects and labels it gets compared to the expected ones.
+// The models aren't looked up and reposts aren't searched, the recorded results are used instead.
+func (cc CorpusCase) Run(c echo.Context, cacheToUse cache.Cache) CorpusResult {
+	sub := cc.Submission
+	sub.Files = slices.Clone(cc.Submission.Files)
+	rederive(c, &sub, cacheToUse, nil, ParserBindings(nil), cc.Artists, cc.Characters)
+
+	result := CorpusResult{
+		Name:    cc.Name,
+		Labels:  TicketLabels(sub),
+		Objects: sub.Metadata.Objects,
+	}
+	result.Added, result.Removed = diffLabels(cc.Labels, result.Labels)
+	names := slices.Concat(slices.Collect(maps.Keys(cc.Objects)), slices.Collect(maps.Keys(result.Objects)))
+	slices.Sort(names)
+	for _, name := range slices.Compact(names) {
+		// compared as JSON, the way the expected objects were read
+		want, _ := json.Marshal(cc.Objects[name])
+		got, _ := json.Marshal(result.Objects[name])
+		if _, found := result.Objects[name]; !found || string(want) != string(got) {
+			result.ChangedObjects = append(result.ChangedObjects, name)
+		}
+	}
+	return result
+}
+
+// Seed stores the attachments of the case in cacheToUse under the keys processParams reads.
+func (cc CorpusCase) Seed(cacheToUse cache.Cache) error {
+	for _, file := range cc.Submission.Files {
+		blob, ok := cc.attachments[file.File.FileName]
+		if !ok {
+			continue
+		}
+		key := fmt.Sprintf("%s:%s", file.File.MimeType, file.File.FileURLFull)
+		if err := cacheToUse.Set(key, &cache.Item{Blob: blob, MimeType: file.File.MimeType}, cache.Week); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CorpusResult is the outcome of a [CorpusCase] compared to its expected objects and labels.
+type CorpusResult struct {
+	Name           string                                 `json:"name"`
+	Labels         []db.TicketLabel                       `json:"labels"`
+	Objects        map[string]entities.TextToImageRequest `json:"objects,omitempty"`
+	Added          []db.TicketLabel                       `json:"added,omitempty"`
+	Removed        []db.TicketLabel                       `json:"removed,omitempty"`
+	ChangedObjects []string                               `json:"changed_objects,omitempty"`
+}
+
+// Changed reports whether the labels or objects differ from the expected ones.
+func (r CorpusResult) Changed() bool {
+	return len(r.Added) > 0 || len(r.Removed) > 0 || len(r.ChangedObjects) > 0
+}
+
+// RunCorpus seeds an offline cache with the attachments of every case and runs them.
+func RunCorpus(c echo.Context, cases []CorpusCase) ([]CorpusResult, error) {
+	corpusCache := NewCorpusCache()
+	for _, corpusCase := range cases {
+		if err := corpusCase.Seed(corpusCache); err != nil {
+			return nil, fmt.Errorf("error seeding case %s: %w", corpusCase.Name, err)
+		}
+	}
+
+	results := make([]CorpusResult, len(cases))
+	for i, corpusCase := range cases {
+		results[i] = corpusCase.Run(c, corpusCache)
+	}
+	return results, nil
+}
+
+// Update sets the expected objects and labels of the case to the result.
+func (cc *CorpusCase) Update(result CorpusResult) {
+	cc.Objects = result.Objects
+	cc.Labels = result.Labels
+}
+
+// WriteCorpusDiff writes the changed labels and objects of each result, and returns how many cases changed.
+func WriteCorpusDiff(w io.Writer, results []CorpusResult) int {
+	var changed int
+	for _, result := range results {
+		if !result.Changed() {
+			continue
+		}
+		changed++
+		fmt.Fprintf(w, "%s\n", result.Name)
+		for _, label := range result.Added {
+			fmt.Fprintf(w, "\t+ %s\n", label)
+		}
+		for _, label := range result.Removed {
+			fmt.Fprintf(w, "\t- %s\n", label)
+		}
+		for _, name := range result.ChangedObjects {
+			fmt.Fprintf(w, "\t~ object %s\n", name)
+		}
+	}
+	fmt.Fprintf(w, "%d of %d cases changed\n", changed, len(results))
+	return changed
+}
+
+// CorpusCache is a [cache.Cache] holding the attachments of a corpus, so cases run without fetching anything.
+// Keys that weren't seeded return an empty item instead of a miss.
+type CorpusCache struct {
+	mu    sync.Mutex
+	items map[string]*cache.Item
+}
+
+func NewCorpusCache() *CorpusCache {
+	return &CorpusCache{items: make(map[string]*cache.Item)}
+}
+
+func (c *CorpusCache) Get(key string) (*cache.Item, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if item, ok := c.items[key]; ok {
+		return item, nil
+	}
+	mimeType, _, _ := strings.Cut(key, ":")
+	return &cache.Item{MimeType: mimeType}, nil
+}
+
+func (c *CorpusCache) MGet(keys ...string) (map[string]*cache.Item, error) {
+	items := make(map[string]*cache.Item, len(keys))
+	for _, key := range keys {
+		items[key], _ = c.Get(key)
+	}
+	return items, nil
+}
+
+func (c *CorpusCache) Set(key string, item *cache.Item, _ time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.items[key] = item
+	return nil
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+
+	"github.com/ellypaws/inkbunny/api"
+
+	"github.com/ellypaws/inkbunny-app/pkg/db"
+)
+
+var updateCorpus = flag.Bool("update", false, "replace the expected results in testdata/corpus with the current ones")
+
+func offlineContext() echo.Context {
+	e := echo.New()
+	e.Logger.SetLevel(log.OFF)
+	return e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+}
+
+// TestCorpus runs the heuristics over the golden corpus. Run with -update after an intended change.
+func TestCorpus(t *testing.T) {
+	dir := filepath.Join("testdata", "corpus")
+	cases, err := LoadCorpus(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := RunCorpus(offlineContext(), cases)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *updateCorpus {
+		for i := range cases {
+			cases[i].Update(results[i])
+			if err := cases[i].Write(dir); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return
+	}
+
+	var diff strings.Builder
+	if WriteCorpusDiff(&diff, results) > 0 {
+		t.Errorf("the corpus results changed:\n%s", diff.String())
+	}
+}
+
+func TestNewCorpusCase(t *testing.T) {
+	sub := db.Submission{
+		ID:       1,
+		UserID:   42,
+		Username: "someone",
+		URL:      "https://inkbunny.net/s/1",
+		Metadata: db.Metadata{AISubmission: true, PrivateModels: []string{"abc"}},
+		Files: []db.File{
+			{File: api.File{FileName: "a.txt", MimeType: "text/plain", FileURLFull: "https://example.com/a.txt"}},
+			{File: api.File{FileName: "a.png", MimeType: "image/png", FileURLFull: "https://example.com/a.png"}},
+		},
+	}
+	attachment := func(url string) ([]byte, bool) {
+		if url == "https://example.com/a.txt" {
+			return []byte("Steps: 20"), true
+		}
+		return nil, false
+	}
+
+	corpusCase := NewCorpusCase("case", sub, []db.TicketLabel{"ai_generated"}, nil, nil, attachment)
+	if corpusCase.Submission.Username != "" || corpusCase.Submission.URL != "" {
+		t.Errorf("submission wasn't anonymized: %+v", corpusCase.Submission)
+	}
+	if corpusCase.Submission.Metadata.AISubmission || !slices.Equal(corpusCase.Submission.Metadata.PrivateModels, []string{"abc"}) {
+		t.Errorf("metadata = %+v, want only the recorded facts", corpusCase.Submission.Metadata)
+	}
+	if sub.Files[0].File.FileURLFull != "https://example.com/a.txt" {
+		t.Error("NewCorpusCase() modified the files of the submission")
+	}
+
+	dir := t.TempDir()
+	if err := corpusCase.Write(dir); err != nil {
+		t.Fatal(err)
+	}
+	cases, err := LoadCorpus(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cases) != 1 || cases[0].Name != "case" || len(cases[0].attachments) != 1 {
+		t.Fatalf("LoadCorpus() = %+v", cases)
+	}
+	if got := string(cases[0].attachments["a.txt"]); got != "Steps: 20" {
+		t.Errorf("attachment a.txt = %q", got)
+	}
+
+	if err := (CorpusCase{Name: "../escape"}).Write(dir); err == nil {
+		t.Error("Write() with a path as the name, want error")
+	}
+}
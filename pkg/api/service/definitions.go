@@ -0,0 +1,305 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+	"github.com/lu4p/cat/rtftxt"
+
+	"github.com/ellypaws/inkbunny-app/pkg/api/cache"
+	"github.com/ellypaws/inkbunny-app/pkg/db"
+
+	"github.com/ellypaws/inkbunny-sd/entities"
+	"github.com/ellypaws/inkbunny-sd/utils"
+)
+
+// definitionFields are the [entities.TextToImageRequest] fields a [db.ParserDefinition] can fill, by JSON name.
+// Numeric fields are decoded as numbers, the rest as strings.
+var definitionFields = map[string]bool{
+	"prompt":              false,
+	"negative_prompt":     false,
+	"sampler_name":        false,
+	"scheduler":           false,
+	"hr_upscaler":         false,
+	"sd_model_checkpoint": false,
+	"sd_checkpoint_hash":  false,
+	"seed":                true,
+	"steps":               true,
+	"cfg_scale":           true,
+	"width":               true,
+	"height":              true,
+	"denoising_strength":  true,
+	"hr_scale":            true,
+}
+
+// overrideFields are read into [entities.OverrideSettings]
+var overrideFields = []string{"sd_model_checkpoint", "sd_checkpoint_hash"}
+
+// DefinitionParser compiles a staff-written definition into a ParserText parser.
+// Each block of the text found by the key and split patterns becomes an object,
+// named by the key line or by the file name and its position.
+func DefinitionParser(definition db.ParserDefinition) (Parser, error) {
+	if err := definition.Validate(); err != nil {
+		return Parser{}, err
+	}
+	if _, ok := LookupParser(definition.Name); ok && !isDefinition(definition.Name) {
+		return Parser{}, fmt.Errorf("error: %s is a built-in parser", definition.Name)
+	}
+
+	var key, split *regexp.Regexp
+	if definition.KeyPattern != "" {
+		key = regexp.MustCompile(definition.KeyPattern)
+	}
+	if definition.SplitPattern != "" {
+		split = regexp.MustCompile(definition.SplitPattern)
+	}
+	fields := make(map[string]*regexp.Regexp, len(definition.Fields))
+	for field, pattern := range definition.Fields {
+		if _, ok := definitionFields[field]; !ok {
+			return Parser{}, fmt.Errorf("error: unknown field %q", field)
+		}
+		fields[field] = regexp.MustCompile(pattern)
+	}
+
+	return Parser{
+		Name: definition.Name,
+		Kind: ParserText,
+		Parse: func(text []byte, fileName string) (utils.Params, map[string]entities.TextToImageRequest, error) {
+			blocks := splitBlocks(string(text), fileName, key, split)
+			var errs []error
+			params := make(utils.Params)
+			objects := make(map[string]entities.TextToImageRequest)
+			for _, block := range blocks {
+				obj, ok, err := readFields(block.text, fields)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s: %w", block.name, err))
+					continue
+				}
+				if !ok {
+					continue
+				}
+				objects[block.name] = obj
+				params[block.name] = utils.PNGChunk{utils.Parameters: block.text}
+			}
+			return params, objects, errors.Join(errs...)
+		},
+	}, nil
+}
+
+var (
+	definitionsMu   sync.Mutex
+	definitionNames = make(map[string]bool)
+)
+
+func isDefinition(name string) bool {
+	definitionsMu.Lock()
+	defer definitionsMu.Unlock()
+	return definitionNames[name]
+}
+
+// RegisterParserDefinitions compiles and registers the active definitions.
+// Definitions that don't compile are skipped and reported in the returned error.
+func RegisterParserDefinitions(definitions []db.ParserDefinition) error {
+	var errs []error
+	for _, definition := range definitions {
+		if !definition.Active {
+			continue
+		}
+		if err := RegisterParserDefinition(definition); err != nil {
+			errs = append(errs, fmt.Errorf("parser %s: %w", definition.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RegisterParserDefinition compiles the definition and registers it, replacing an earlier version.
+func RegisterParserDefinition(definition db.ParserDefinition) error {
+	parser, err := DefinitionParser(definition)
+	if err != nil {
+		return err
+	}
+	definitionsMu.Lock()
+	definitionNames[definition.Name] = true
+	definitionsMu.Unlock()
+	RegisterParser(parser)
+	return nil
+}
+
+type block struct {
+	name string
+	text string
+}
+
+// splitBlocks splits text on lines matching key or split.
+// Lines matching key start a new block named by its first group, or by the whole line.
+func splitBlocks(text, fileName string, key, split *regexp.Regexp) []block {
+	var (
+		blocks  []block
+		current block
+		lines   []string
+	)
+	flush := func() {
+		current.text = strings.TrimSpace(strings.Join(lines, "\n"))
+		if current.text != "" {
+			blocks = append(blocks, current)
+		}
+		current, lines = block{}, nil
+	}
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		switch {
+		case key != nil && key.MatchString(line):
+			flush()
+			current.name = strings.TrimSpace(line)
+			if match := key.FindStringSubmatch(line); len(match) > 1 && match[1] != "" {
+				current.name = strings.TrimSpace(match[1])
+			}
+		case split != nil && split.MatchString(line):
+			flush()
+			continue
+		}
+		lines = append(lines, line)
+	}
+	flush()
+
+	for i := range blocks {
+		if blocks[i].name != "" {
+			continue
+		}
+		blocks[i].name = fileName
+		if len(blocks) > 1 {
+			blocks[i].name = fmt.Sprintf("%s (%d)", fileName, i+1)
+		}
+	}
+	return blocks
+}
+
+// readFields fills a request with the first group, or the whole match, of each field pattern.
+// ok is false if no field matched.
+func readFields(text string, fields map[string]*regexp.Regexp) (entities.TextToImageRequest, bool, error) {
+	values := make(map[string]any)
+	overrides := make(map[string]any)
+	for field, re := range fields {
+		match := re.FindStringSubmatch(text)
+		if match == nil {
+			continue
+		}
+		value := strings.TrimSpace(match[0])
+		if len(match) > 1 {
+			value = strings.TrimSpace(match[1])
+		}
+		var decoded any = value
+		if definitionFields[field] {
+			if _, err := strconv.ParseFloat(value, 64); err != nil {
+				return entities.TextToImageRequest{}, false, fmt.Errorf("%s: %q is not a number", field, value)
+			}
+			decoded = json.Number(value)
+		}
+		if slices.Contains(overrideFields, field) {
+			overrides[field] = decoded
+		} else {
+			values[field] = decoded
+		}
+	}
+	if len(values) == 0 && len(overrides) == 0 {
+		return entities.TextToImageRequest{}, false, nil
+	}
+	values["override_settings"] = overrides
+
+	b, err := json.Marshal(values)
+	if err != nil {
+		return entities.TextToImageRequest{}, false, err
+	}
+	var obj entities.TextToImageRequest
+	if err := json.Unmarshal(b, &obj); err != nil {
+		return entities.TextToImageRequest{}, false, err
+	}
+	return obj, true, nil
+}
+
+// ParserTest is the result of running a parser over a sample attachment.
+type ParserTest struct {
+	Parser  string                                 `json:"parser"`
+	Objects map[string]entities.TextToImageRequest `json:"objects,omitempty"`
+	Params  utils.Params                           `json:"params,omitempty"`
+	Error   string                                 `json:"error,omitempty"`
+}
+
+// TestParser runs parser over text as if it was the attachment fileName.
+func TestParser(parser Parser, text []byte, fileName string) ParserTest {
+	params, objects, err := parser.Parse(text, fileName)
+	test := ParserTest{Parser: parser.Name, Objects: objects, Params: params}
+	if err != nil {
+		test.Error = err.Error()
+	}
+	return test
+}
+
+// Reparse runs parser over the cached text attachments of a submission that has no objects yet.
+// It doesn't fetch missing attachments. If objects are found, the metadata is updated as in RetrieveParams
+// and the cached parameters are replaced, so the next review uses them.
+func Reparse(sub *db.Submission, parser Parser, cacheToUse cache.Cache, database db.Store, artists []db.Artist, characters []db.Character) (bool, error) {
+	if len(sub.Metadata.Objects) > 0 {
+		return false, nil
+	}
+
+	var errs []error
+	for _, file := range sub.Files {
+		switch file.File.MimeType {
+		case echo.MIMETextPlain, MIMETextRTF:
+		default:
+			continue
+		}
+		item, err := cacheToUse.Get(fmt.Sprintf("%s:%s", file.File.MimeType, file.File.FileURLFull))
+		if err != nil {
+			continue
+		}
+		text := item.Blob
+		if file.File.MimeType == MIMETextRTF {
+			plain, err := rtftxt.Text(bytes.NewReader(text))
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", file.File.FileName, err))
+				continue
+			}
+			text = plain.Bytes()
+		}
+		params, objects, err := parser.Parse(text, file.File.FileName)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", file.File.FileName, err))
+		}
+		if len(objects) == 0 {
+			continue
+		}
+		insertOrInitalize(&sub.Metadata.Objects, objects)
+		insertOrInitalize(&sub.Metadata.Params, params)
+		sub.Metadata.Parser = parser.Name
+	}
+	if len(sub.Metadata.Objects) == 0 {
+		return false, errors.Join(errs...)
+	}
+
+	processObjectMetadata(sub, artists, characters)
+	checkKeywords(sub, database)
+	checkImg2ImgInput(sub)
+
+	sub.Metadata.Version = Version()
+	bin, err := json.Marshal(sub.Metadata)
+	if err != nil {
+		return true, fmt.Errorf("error marshaling params: %w", err)
+	}
+	err = cacheToUse.Set(parametersKey(sub.ID), &cache.Item{
+		Blob:     bin,
+		MimeType: echo.MIMEApplicationJSON,
+	}, cache.Week)
+	if err != nil {
+		return true, fmt.Errorf("error caching params: %w", err)
+	}
+	return true, errors.Join(errs...)
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/ellypaws/inkbunny-sd/utils"
+
+	"github.com/ellypaws/inkbunny-app/pkg/db"
+)
+
+func TestDefinitionParser(t *testing.T) {
+	definition := db.ParserDefinition{
+		Name:         "test_definition",
+		KeyPattern:   `^Image (\d+)`,
+		SplitPattern: `^-{3,}$`,
+		Fields: map[string]string{
+			"prompt":              `(?m)^Prompt: (.*)$`,
+			"negative_prompt":     `(?m)^Negative: (.*)$`,
+			"seed":                `(?m)^Seed: (\S+)`,
+			"cfg_scale":           `(?m)^CFG: ([\d.]+)`,
+			"sd_model_checkpoint": `(?m)^Model: (.*)$`,
+		},
+	}
+	parser, err := DefinitionParser(definition)
+	if err != nil {
+		t.Fatalf("DefinitionParser() error = %v", err)
+	}
+
+	text := "Image 1\r\nPrompt: a fox\r\nSeed: 1234\r\nCFG: 7.5\r\nModel: fluffyrock\r\n---\r\n" +
+		"Image 2\nPrompt: a wolf\nNegative: blurry\n---\nnotes without parameters\n"
+	params, objects, err := parser.Parse([]byte(text), "params.txt")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(objects) != 2 {
+		t.Fatalf("Parse() objects = %+v, want 2", objects)
+	}
+
+	first := objects["1"]
+	if first.Prompt != "a fox" || first.Seed != 1234 || first.CFGScale != 7.5 {
+		t.Errorf("object 1 = %+v", first)
+	}
+	if first.OverrideSettings.SDModelCheckpoint == nil || *first.OverrideSettings.SDModelCheckpoint != "fluffyrock" {
+		t.Errorf("object 1 checkpoint = %v, want fluffyrock", first.OverrideSettings.SDModelCheckpoint)
+	}
+	if second := objects["2"]; second.Prompt != "a wolf" || second.NegativePrompt != "blurry" {
+		t.Errorf("object 2 = %+v", second)
+	}
+	if got := params["2"][utils.Parameters]; got != "Image 2\nPrompt: a wolf\nNegative: blurry" {
+		t.Errorf("params of object 2 = %q", got)
+	}
+
+	_, _, err = parser.Parse([]byte("Image 3\nSeed: random"), "params.txt")
+	if err == nil {
+		t.Error("Parse() with a non-numeric seed, want error")
+	}
+
+	_, objects, err = parser.Parse([]byte("Prompt: a cat\n---\nPrompt: a dog"), "params.txt")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if _, ok := objects["params.txt (2)"]; !ok || len(objects) != 2 {
+		t.Errorf("Parse() without keys = %+v, want objects named after the file", objects)
+	}
+}
+
+func TestDefinitionParserInvalid(t *testing.T) {
+	tests := []struct {
+		name       string
+		definition db.ParserDefinition
+	}{
+		{name: "unknown field", definition: db.ParserDefinition{Name: "invalid", Fields: map[string]string{"prompts": `.*`}}},
+		{name: "invalid pattern", definition: db.ParserDefinition{Name: "invalid", Fields: map[string]string{"prompt": `(`}}},
+		{name: "no fields", definition: db.ParserDefinition{Name: "invalid"}},
+		{name: "built-in", definition: db.ParserDefinition{Name: defaultTextParser, Fields: map[string]string{"prompt": `.*`}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DefinitionParser(tt.definition); err == nil {
+				t.Error("DefinitionParser() error = nil, want error")
+			}
+		})
+	}
+}
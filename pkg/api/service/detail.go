@@ -17,6 +17,7 @@ import (
 	units "github.com/labstack/gommon/bytes"
 
 	"github.com/ellypaws/inkbunny-app/pkg/api/cache"
+	"github.com/ellypaws/inkbunny-app/pkg/api/rules"
 	"github.com/ellypaws/inkbunny-app/pkg/db"
 	sd "github.com/ellypaws/inkbunny-sd/stable_diffusion"
 )
@@ -29,6 +30,7 @@ type Detail struct {
 	Inkbunny   *api.Submission `json:"inkbunny,omitempty"`
 	Ticket     *db.Ticket      `json:"ticket,omitempty"`
 	Images     []*db.File      `json:"images,omitempty"`
+	Evidence   []Evidence      `json:"evidence,omitempty"` // why each label was emitted, see LabelEvidence
 
 	Extra
 }
@@ -55,7 +57,10 @@ type OutputType = string
 type Config struct {
 	SubmissionDetails api.SubmissionDetailsResponse
 	Artists           []db.Artist
+	Characters        []db.Character
 	Cache             cache.Cache
+	Database          db.Store
+	Queue             *SubmissionQueue // Stores every reviewed submission, can be nil
 	Host              *sd.Host
 	Output            OutputType
 	Parameters        bool
@@ -109,25 +114,8 @@ func processSubmission(c echo.Context, submission *api.Submission, config *Confi
 		parseFiles(c, &sub, config)
 	}
 
-	// config.mutex.Lock()
-	// defer config.mutex.Unlock()
-
-	// for _, obj := range sub.Metadata.Objects {
-	//	for hash, model := range obj.LoraHashes {
-	//		config.Database.Wait()
-	//		err := config.Database.UpsertModel(db.ModelHashes{
-	//			hash: []string{model},
-	//		})
-	//		if err != nil {
-	//			c.Logger().Errorf("error inserting model %s: %s", hash, err)
-	//		}
-	//	}
-	// }
-
-	// err := config.Database.InsertSubmission(sub)
-	// if err != nil {
-	//	c.Logger().Errorf("error inserting submission %v: %v", sub.ID, err)
-	// }
+	checkReposts(c, &sub, config)
+	sub.Metadata.Version = Version()
 
 	user := api.UsernameID{UserID: strconv.FormatInt(sub.UserID, 10), Username: sub.Username}
 
@@ -194,6 +182,17 @@ func processSubmission(c echo.Context, submission *api.Submission, config *Confi
 		}
 	}
 
+	switch config.Output {
+	case OutputFull, OutputSubmissions, OutputBadges:
+		detail.Evidence = LabelEvidence(sub)
+	}
+
+	if detail.Ticket != nil {
+		config.Queue.Push(sub, detail.Ticket.Labels)
+	} else {
+		config.Queue.Push(sub, TicketLabels(sub))
+	}
+
 	return detail
 }
 
@@ -204,13 +203,7 @@ func setCache(c echo.Context, config *Config, detail *Detail) {
 		return
 	}
 
-	key := fmt.Sprintf(
-		"%s:review:%s:%d?%s",
-		echo.MIMEApplicationJSON,
-		config.Output,
-		detail.ID,
-		config.Query.Encode(),
-	)
+	key := ReviewKey(config.Output, strconv.FormatInt(int64(detail.ID), 10), config.Query)
 	err = config.Cache.Set(key, &cache.Item{
 		Blob:     bin,
 		MimeType: echo.MIMEApplicationJSON,
@@ -252,7 +245,7 @@ func parseFiles(c echo.Context, sub *db.Submission, config *Config) {
 	var wg sync.WaitGroup
 	if config.Parameters {
 		wg.Add(1)
-		go RetrieveParams(c, &wg, sub, config.Cache, config.Artists)
+		go RetrieveParams(c, &wg, sub, config.Cache, config.Database, config.Artists, config.Characters)
 	}
 	if config.Interrogate {
 		for i := range sub.Files {
@@ -265,34 +258,18 @@ func parseFiles(c echo.Context, sub *db.Submission, config *Config) {
 
 // ticketSubject returns the subject of the ticket based on the flags detected in the submission.
 func ticketSubject(flags []db.TicketLabel) string {
-	if len(flags) == 0 {
-		return "needs to be reviewed"
-	} else {
-		switch {
-		case slices.Contains(flags, db.LabelArtistUsed):
-			return "has used an artist in the prompt"
-		case slices.Contains(flags, db.LabelMissingParams):
-			return "does not have any parameters"
-		case slices.Contains(flags, db.LabelMissingPrompt):
-			return "is missing the prompt"
-		case slices.Contains(flags, db.LabelMissingModel):
-			return "does not include the model information"
-		case slices.Contains(flags, db.LabelMissingSeed):
-			return "is missing the generation seed"
-		case slices.Contains(flags, db.LabelSoldArt):
-			return "is selling content"
-		case slices.Contains(flags, db.LabelPrivateTool):
-			return "was generated using a private tool"
-		case slices.Contains(flags, db.LabelPrivateLora):
-			return "was generated using a private Lora model"
-		case slices.Contains(flags, db.LabelPrivateModel):
-			return "was generated using a private checkpoint model"
-		case slices.Contains(flags, db.LabelMissingTags):
-			return "is missing the AI tags"
-		default:
-			return "is not following AI ACP"
-		}
+	return rules.Active().SubjectFor(flags)
+}
+
+// RelabeledSubject returns subject with the part derived from the before labels replaced by the one for the after labels,
+// e.g. "AI Submission #1 by @user needs to be reviewed" becomes "AI Submission #1 by @user has used an artist in the prompt".
+// A subject that doesn't end with the derived part was written by staff and is returned as is.
+func RelabeledSubject(subject string, before, after []db.TicketLabel) string {
+	prefix, ok := strings.CutSuffix(subject, ticketSubject(before))
+	if !ok {
+		return subject
 	}
+	return prefix + ticketSubject(after)
 }
 
 func ticketFlagSummary(flags []db.TicketLabel, colors map[string]string) string {
@@ -320,6 +297,11 @@ func submissionMessage(sub *db.Submission) string {
 	colors := make(map[string]string)
 	sb.WriteString(ticketFlagSummary(flags, colors))
 
+	if evidence := LabelEvidence(*sub); len(evidence) > 0 {
+		sb.WriteString("\n\n[u]Evidence[/u]:")
+		sb.WriteString(writeEvidence(evidence))
+	}
+
 	sb.WriteString(fmt.Sprintf("\n%s by @%s\n#M%d", sub.URL, sub.Username, sub.ID))
 
 	if len(sub.Metadata.ArtistUsed) > 0 {
@@ -328,11 +310,46 @@ func submissionMessage(sub *db.Submission) string {
 		sb.WriteString(writeArtistUsed(sub))
 	}
 
+	if len(sub.Metadata.ArtistConsented) > 0 {
+		sb.WriteString("\n\n")
+		sb.WriteString("These artists allowed the use of their name:")
+		sb.WriteString(writeArtistConsented(sub))
+	}
+
+	if len(sub.Metadata.CharacterUsed) > 0 {
+		sb.WriteString("\n\n")
+		sb.WriteString("The prompt may have used these characters: ")
+		sb.WriteString(writeCharacterUsed(sub))
+	}
+
+	if sub.Metadata.SoldArt {
+		sb.WriteString("\n\n")
+		sb.WriteString("The submission appears to be sold:")
+		sb.WriteString(writeSoldArt(sub))
+	}
+
+	if len(sub.Metadata.Reposts) > 0 {
+		sb.WriteString("\n\n")
+		sb.WriteString("The same work was posted earlier in:")
+		sb.WriteString(writeReposts(sub))
+	}
+
+	if len(sub.Metadata.SuggestedKeywords) > 0 {
+		sb.WriteString("\n\n")
+		sb.WriteString("Suggested keywords: ")
+		sb.WriteString(strings.Join(sub.Metadata.SuggestedKeywords, ", "))
+	}
+
 	if sub.Metadata.MissingPrompt {
 		sb.WriteString("\n")
 		sb.WriteString("The submission is missing the prompt")
 	}
 
+	if sub.Metadata.MissingImg2ImgInput {
+		sb.WriteString("\n")
+		sb.WriteString("The submission used img2img, but does not include the input")
+	}
+
 	if len(sub.Metadata.AIKeywords) == 0 {
 		if sub.Metadata.AISubmission {
 			sb.WriteString("\n")
@@ -398,54 +415,33 @@ func writeArtistUsed(sub *db.Submission) string {
 		}
 	}
 
-	highlight := make(map[string]string)
-	for name, obj := range sub.Metadata.Objects {
-		var replaced bool
-		for _, artist := range sub.Metadata.ArtistUsed {
-			re, err := regexp.Compile(fmt.Sprintf(`(?i)\b(%s)\b`, artist.Username))
-			if err != nil {
-				continue
-			}
+	writePromptHighlights(&sb, sub, artistHighlights(sub, sub.Metadata.ArtistUsed))
+
+	return sb.String()
+}
 
-			if !replaced {
-				if re.MatchString(obj.Prompt) {
-					replaced = true
-					highlight[name] = obj.Prompt
-				}
-				if re.MatchString(obj.NegativePrompt) {
-					replaced = true
-					highlight[name] = fmt.Sprintf("%s\n(Found in negative prompt)\n%s", highlight[name], obj.NegativePrompt)
-				}
+// writeArtistConsented cites the consents covering each artist in ArtistConsented
+func writeArtistConsented(sub *db.Submission) string {
+	var sb strings.Builder
+	for _, artist := range sub.Metadata.ArtistConsented {
+		for _, consent := range artist.Consents {
+			sb.WriteString(fmt.Sprintf("\n[b]%s[/b]: granted by @%s", artist.Username, consent.GrantedBy))
+			if len(consent.Users) > 0 {
+				sb.WriteString(fmt.Sprintf(" to @%s", strings.Join(consent.Users, ", @")))
+			} else {
+				sb.WriteString(" to everyone")
 			}
-			if replaced {
-				highlight[name] = re.ReplaceAllStringFunc(highlight[name], func(s string) string {
-					if artist.UserID != nil {
-						return fmt.Sprintf("[b]>>> [u][name]%s[/name][/u] <<<[/b]", s)
-					}
-					return fmt.Sprintf("[b] >>> [color=#F78C6C][u]%s[/u][/color] <<< [/b]", s)
-				})
+			if len(consent.Characters) > 0 {
+				sb.WriteString(fmt.Sprintf(" for %s", strings.Join(consent.Characters, ", ")))
 			}
-		}
-	}
-
-	for title, prompt := range highlight {
-		var file *db.File
-		if slices.ContainsFunc(sub.Files, func(f db.File) bool {
-			if strings.HasPrefix(title, f.File.FileName) {
-				file = &f
-				return true
+			if consent.Expires != nil {
+				sb.WriteString(fmt.Sprintf(" until %s", consent.Expires.Format(db.TicketDateLayout)))
+			}
+			if consent.Source != "" {
+				sb.WriteString(fmt.Sprintf(" ([url=%s]source[/url])", consent.Source))
 			}
-			return false
-		}) {
-			sb.WriteString(fmt.Sprintf("\nFile %d: [url=%s]%s[/url] ([url=https://inkbunny.net/submissionsviewall.php?text=%s&md5=yes&mode=search]%s[/url]) https://inkbunny.net/s/%s",
-				file.File.SubmissionFileOrder+1, file.File.FileURLFull, file.File.FileName, file.File.FullFileMD5, file.File.FullFileMD5, file.File.SubmissionID))
-		} else {
-			sb.WriteString(fmt.Sprintf("\nFrom description: [url=%s]%s[/url] %s", sub.URL, title, sub.URL))
 		}
-		sb.WriteString(fmt.Sprintf("\n[q=%s]%s[/q]", title, prompt))
-		sb.Split()
 	}
-
 	return sb.String()
 }
 
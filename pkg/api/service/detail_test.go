@@ -0,0 +1,44 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/ellypaws/inkbunny-app/pkg/db"
+)
+
+func TestRelabeledSubject(t *testing.T) {
+	const prefix = "AI Submission #1 by @user "
+	before := []db.TicketLabel{db.LabelCannotParse}
+
+	tests := []struct {
+		name    string
+		subject string
+		after   []db.TicketLabel
+		want    string
+	}{
+		{
+			name:    "new violation",
+			subject: prefix + ticketSubject(before),
+			after:   []db.TicketLabel{db.LabelArtistUsed},
+			want:    prefix + "has used an artist in the prompt",
+		},
+		{
+			name:    "no labels left",
+			subject: prefix + ticketSubject(before),
+			want:    prefix + "needs to be reviewed",
+		},
+		{
+			name:    "written by staff",
+			subject: "please check the attached file",
+			after:   []db.TicketLabel{db.LabelArtistUsed},
+			want:    "please check the attached file",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := RelabeledSubject(test.subject, before, test.after); got != test.want {
+				t.Errorf("RelabeledSubject() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,344 @@
+package service
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/labstack/echo/v4"
+	units "github.com/labstack/gommon/bytes"
+
+	"github.com/ellypaws/inkbunny-app/pkg/api/cache"
+	"github.com/ellypaws/inkbunny-app/pkg/db"
+
+	"github.com/ellypaws/inkbunny-sd/utils"
+)
+
+const (
+	MIMEImagePNG  = "image/png"
+	MIMEImageJPEG = "image/jpeg"
+	MIMEImageWebP = "image/webp"
+)
+
+var (
+	pngSignature  = []byte("\x89PNG\r\n\x1a\n")
+	exifHeader    = []byte("Exif\x00\x00")
+	errNoMetadata = errors.New("no embedded metadata found")
+)
+
+// maxEmbeddedText limits how much a single decompressed zTXt/iTXt chunk can inflate to
+const maxEmbeddedText = 8 << 20
+
+// embeddedChunks returns the text metadata embedded inside an image.
+// PNG files return their tEXt, zTXt and iTXt chunks keyed by keyword (e.g. "parameters" for A1111,
+// "prompt" and "workflow" for ComfyUI).
+// JPEG and WebP files return the EXIF UserComment as utils.Parameters, which is where A1111 stores its infotext.
+func embeddedChunks(blob []byte) (utils.PNGChunk, error) {
+	switch {
+	case bytes.HasPrefix(blob, pngSignature):
+		return pngChunks(blob[len(pngSignature):])
+	case bytes.HasPrefix(blob, []byte{0xFF, 0xD8}):
+		return jpegChunks(blob[2:])
+	case len(blob) >= 12 && bytes.Equal(blob[:4], []byte("RIFF")) && bytes.Equal(blob[8:12], []byte("WEBP")):
+		return webpChunks(blob[12:])
+	default:
+		return nil, errors.New("unsupported image format")
+	}
+}
+
+// embeddedKey is the cache key of the chunks read from the image at url.
+func embeddedKey(url string) string {
+	return fmt.Sprintf("%s:embedded:%s", echo.MIMEApplicationJSON, url)
+}
+
+// retrieveChunks returns the metadata embedded in an image file.
+// The chunks are cached for three months, while the image itself is only kept for an hour.
+// Images without metadata are cached as empty chunks, so they aren't downloaded again.
+func retrieveChunks(c echo.Context, cacheToUse cache.Cache, imageFile *db.File) (utils.PNGChunk, error) {
+	key := embeddedKey(imageFile.File.FileURLFull)
+	if c.Request().Header.Get(echo.HeaderCacheControl) != "no-cache" {
+		if item, err := cacheToUse.Get(key); err == nil {
+			var chunks utils.PNGChunk
+			if err := json.Unmarshal(item.Blob, &chunks); err == nil {
+				c.Logger().Debugf("Cache hit for %s", key)
+				return chunks, nil
+			}
+		}
+	}
+
+	hour := cache.Hour
+	b, errFunc := cache.Retrieve(c, cacheToUse, cache.Fetch{
+		Key:      fmt.Sprintf("%s:%s", imageFile.File.MimeType, imageFile.File.FileURLFull),
+		URL:      imageFile.File.FileURLFull,
+		MimeType: imageFile.File.MimeType,
+		Duration: &hour,
+	})
+	if errFunc != nil {
+		return nil, fmt.Errorf("could not fetch %s", imageFile.File.FileURLFull)
+	}
+
+	chunks, err := embeddedChunks(b.Blob)
+	if err != nil && !errors.Is(err, errNoMetadata) {
+		c.Logger().Warnf("error reading embedded metadata from %s: %v", imageFile.File.FileURLFull, err)
+	}
+	if chunks == nil {
+		chunks = make(utils.PNGChunk)
+	}
+
+	bin, _ := json.Marshal(chunks)
+	err = cacheToUse.Set(key, &cache.Item{Blob: bin, MimeType: echo.MIMEApplicationJSON}, 3*cache.Month)
+	if err != nil {
+		c.Logger().Errorf("error caching embedded metadata: %v", err)
+	} else {
+		c.Logger().Infof("Cached %s %dKiB", key, len(bin)/units.KiB)
+	}
+	return chunks, nil
+}
+
+func pngChunks(b []byte) (utils.PNGChunk, error) {
+	chunks := make(utils.PNGChunk)
+	for len(b) >= 12 {
+		length := binary.BigEndian.Uint32(b[:4])
+		chunkType := string(b[4:8])
+		if uint64(length)+12 > uint64(len(b)) {
+			return chunks, fmt.Errorf("png chunk %s is truncated", chunkType)
+		}
+		data := b[8 : 8+length]
+		b = b[12+length:]
+
+		var (
+			keyword, text string
+			err           error
+		)
+		switch chunkType {
+		case "tEXt":
+			keyword, text, err = pngText(data)
+		case "zTXt":
+			keyword, text, err = pngCompressedText(data)
+		case "iTXt":
+			keyword, text, err = pngInternationalText(data)
+		case "IEND":
+			return chunks, nil
+		default:
+			continue
+		}
+		if err != nil {
+			return chunks, fmt.Errorf("error parsing png %s chunk: %w", chunkType, err)
+		}
+		chunks[keyword] = text
+	}
+	return chunks, nil
+}
+
+// pngText parses keyword\0text where text is Latin-1
+func pngText(data []byte) (string, string, error) {
+	keyword, text, found := bytes.Cut(data, []byte{0})
+	if !found {
+		return "", "", errors.New("missing keyword separator")
+	}
+	return string(keyword), latin1(text), nil
+}
+
+// pngCompressedText parses keyword\0 compression method, followed by zlib compressed Latin-1 text
+func pngCompressedText(data []byte) (string, string, error) {
+	keyword, rest, found := bytes.Cut(data, []byte{0})
+	if !found || len(rest) < 1 {
+		return "", "", errors.New("missing keyword separator")
+	}
+	text, err := inflate(rest[1:])
+	if err != nil {
+		return "", "", err
+	}
+	return string(keyword), latin1(text), nil
+}
+
+// pngInternationalText parses keyword\0 compression flag, compression method,
+// language tag\0 translated keyword\0 followed by UTF-8 text
+func pngInternationalText(data []byte) (string, string, error) {
+	keyword, rest, found := bytes.Cut(data, []byte{0})
+	if !found || len(rest) < 2 {
+		return "", "", errors.New("missing keyword separator")
+	}
+	compressed := rest[0] == 1
+	rest = rest[2:]
+	for range 2 {
+		_, rest, found = bytes.Cut(rest, []byte{0})
+		if !found {
+			return "", "", errors.New("missing language tag separator")
+		}
+	}
+	if !compressed {
+		return string(keyword), string(rest), nil
+	}
+	text, err := inflate(rest)
+	if err != nil {
+		return "", "", err
+	}
+	return string(keyword), string(text), nil
+}
+
+func inflate(data []byte) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(io.LimitReader(r, maxEmbeddedText))
+}
+
+func latin1(b []byte) string {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+func jpegChunks(b []byte) (utils.PNGChunk, error) {
+	for len(b) >= 4 {
+		if b[0] != 0xFF {
+			return nil, errors.New("invalid jpeg marker")
+		}
+		marker := b[1]
+		switch {
+		case marker == 0xFF:
+			b = b[1:]
+			continue
+		case marker == 0xD9, marker == 0xDA:
+			// end of image or start of scan, no more metadata segments
+			return nil, errNoMetadata
+		case marker == 0x01, marker >= 0xD0 && marker <= 0xD7:
+			b = b[2:]
+			continue
+		}
+		length := int(binary.BigEndian.Uint16(b[2:4]))
+		if length < 2 || length+2 > len(b) {
+			return nil, errors.New("jpeg segment is truncated")
+		}
+		data := b[4 : 2+length]
+		b = b[2+length:]
+		if marker == 0xE1 && bytes.HasPrefix(data, exifHeader) {
+			return exifChunks(data[len(exifHeader):])
+		}
+	}
+	return nil, errNoMetadata
+}
+
+func webpChunks(b []byte) (utils.PNGChunk, error) {
+	for len(b) >= 8 {
+		fourCC := string(b[:4])
+		length := int(binary.LittleEndian.Uint32(b[4:8]))
+		// chunks are padded to an even length
+		if 8+length+length%2 > len(b) {
+			return nil, fmt.Errorf("webp chunk %s is truncated", fourCC)
+		}
+		data := b[8 : 8+length]
+		b = b[8+length+length%2:]
+		if fourCC == "EXIF" {
+			return exifChunks(bytes.TrimPrefix(data, exifHeader))
+		}
+	}
+	return nil, errNoMetadata
+}
+
+const (
+	tagExifIFD     = 0x8769
+	tagUserComment = 0x9286
+)
+
+// exifChunks reads the UserComment from the Exif IFD of a TIFF structure
+func exifChunks(tiff []byte) (utils.PNGChunk, error) {
+	if len(tiff) < 8 {
+		return nil, errors.New("exif data is truncated")
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, errors.New("invalid exif byte order")
+	}
+
+	offset, ok := ifdEntry(tiff, order, order.Uint32(tiff[4:8]), tagExifIFD)
+	if !ok {
+		return nil, errNoMetadata
+	}
+	value, ok := ifdEntry(tiff, order, offset, tagUserComment)
+	if !ok {
+		return nil, errNoMetadata
+	}
+
+	entry := tiff[value:]
+	count := order.Uint32(entry[4:8])
+	if count <= 4 {
+		return nil, errNoMetadata
+	}
+	start := order.Uint32(entry[8:12])
+	if uint64(start)+uint64(count) > uint64(len(tiff)) {
+		return nil, errors.New("exif user comment is truncated")
+	}
+
+	comment := userComment(tiff[start:start+count], order)
+	if comment == "" {
+		return nil, errNoMetadata
+	}
+	return utils.PNGChunk{utils.Parameters: comment}, nil
+}
+
+// ifdEntry looks for tag in the IFD at offset.
+// It returns the value offset for tagExifIFD, otherwise the offset of the entry itself.
+func ifdEntry(tiff []byte, order binary.ByteOrder, offset uint32, tag uint16) (uint32, bool) {
+	if uint64(offset)+2 > uint64(len(tiff)) {
+		return 0, false
+	}
+	entries := int(order.Uint16(tiff[offset:]))
+	for i := range entries {
+		start := int(offset) + 2 + i*12
+		if start+12 > len(tiff) {
+			return 0, false
+		}
+		if order.Uint16(tiff[start:]) != tag {
+			continue
+		}
+		if tag == tagExifIFD {
+			return order.Uint32(tiff[start+8:]), true
+		}
+		return uint32(start), true
+	}
+	return 0, false
+}
+
+// userComment decodes the 8 byte character code prefix used by the EXIF UserComment tag
+func userComment(b []byte, order binary.ByteOrder) string {
+	if len(b) < 8 {
+		return ""
+	}
+	prefix, text := b[:8], b[8:]
+	switch {
+	case bytes.HasPrefix(prefix, []byte("UNICODE")):
+		if len(text) >= 2 {
+			// Most writers (piexif, used by A1111) encode as big endian regardless of the TIFF byte order
+			switch {
+			case text[0] == 0 && text[1] != 0:
+				order = binary.BigEndian
+			case text[0] != 0 && text[1] == 0:
+				order = binary.LittleEndian
+			}
+		}
+		codeUnits := make([]uint16, len(text)/2)
+		for i := range codeUnits {
+			codeUnits[i] = order.Uint16(text[i*2:])
+		}
+		return strings.TrimRight(string(utf16.Decode(codeUnits)), "\x00")
+	default:
+		return strings.TrimRight(string(text), "\x00 ")
+	}
+}
@@ -0,0 +1,204 @@
+package service
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/ellypaws/inkbunny-sd/utils"
+)
+
+func pngChunk(chunkType string, data []byte) []byte {
+	b := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	b = append(b, chunkType...)
+	b = append(b, data...)
+	return append(b, 0, 0, 0, 0) // the CRC isn't checked
+}
+
+func compress(t *testing.T, text string) []byte {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	if _, err := w.Write([]byte(text)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// exifTIFF is a little endian TIFF structure with an Exif IFD holding comment as the UserComment.
+func exifTIFF(comment []byte) []byte {
+	le := binary.LittleEndian
+	b := []byte("II\x2a\x00")
+	b = le.AppendUint32(b, 8)
+	// IFD0 with the Exif IFD pointer
+	b = le.AppendUint16(b, 1)
+	b = le.AppendUint16(b, tagExifIFD)
+	b = le.AppendUint16(b, 4)
+	b = le.AppendUint32(b, 1)
+	b = le.AppendUint32(b, 26)
+	b = le.AppendUint32(b, 0)
+	// Exif IFD with the UserComment
+	b = le.AppendUint16(b, 1)
+	b = le.AppendUint16(b, tagUserComment)
+	b = le.AppendUint16(b, 7)
+	b = le.AppendUint32(b, uint32(len(comment)))
+	b = le.AppendUint32(b, 44)
+	b = le.AppendUint32(b, 0)
+	return append(b, comment...)
+}
+
+func unicodeComment(text string) []byte {
+	b := []byte("UNICODE\x00")
+	for _, unit := range utf16.Encode([]rune(text)) {
+		b = binary.BigEndian.AppendUint16(b, unit)
+	}
+	return b
+}
+
+func jpegWithExif(tiff []byte) []byte {
+	data := append([]byte("Exif\x00\x00"), tiff...)
+	b := []byte{0xFF, 0xD8, 0xFF, 0xE1}
+	b = binary.BigEndian.AppendUint16(b, uint16(len(data)+2))
+	return append(append(b, data...), 0xFF, 0xD9)
+}
+
+func webpChunk(fourCC string, data []byte, pad bool) []byte {
+	b := append([]byte(fourCC), binary.LittleEndian.AppendUint32(nil, uint32(len(data)))...)
+	b = append(b, data...)
+	if pad && len(data)%2 == 1 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+func webp(chunks ...[]byte) []byte {
+	body := []byte("WEBP")
+	for _, chunk := range chunks {
+		body = append(body, chunk...)
+	}
+	return append(append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(len(body)))...), body...)
+}
+
+func TestEmbeddedChunks(t *testing.T) {
+	const parameters = "a red fox\nSteps: 20, Seed: 1234"
+	asciiComment := append([]byte("ASCII\x00\x00\x00"), "Steps: 20"...) // odd length
+	png := func(chunks ...[]byte) []byte {
+		return bytes.Join(append([][]byte{pngSignature}, chunks...), nil)
+	}
+
+	tests := []struct {
+		name    string
+		blob    []byte
+		want    utils.PNGChunk
+		wantErr bool
+	}{
+		{
+			name: "png tEXt",
+			blob: png(pngChunk("IHDR", make([]byte, 13)), pngChunk("tEXt", []byte("parameters\x00"+parameters)), pngChunk("IEND", nil)),
+			want: utils.PNGChunk{"parameters": parameters},
+		},
+		{
+			name: "png tEXt latin-1",
+			blob: png(pngChunk("tEXt", []byte("parameters\x00caf\xe9")), pngChunk("IEND", nil)),
+			want: utils.PNGChunk{"parameters": "café"},
+		},
+		{
+			name: "png iTXt",
+			blob: png(pngChunk("iTXt", []byte("prompt\x00\x00\x00en\x00\x00{\"1\":{}}")), pngChunk("IEND", nil)),
+			want: utils.PNGChunk{"prompt": `{"1":{}}`},
+		},
+		{
+			name: "png compressed iTXt",
+			blob: png(pngChunk("iTXt", append([]byte("workflow\x00\x01\x00\x00\x00"), compress(t, `{"nodes":[]}`)...)), pngChunk("IEND", nil)),
+			want: utils.PNGChunk{"workflow": `{"nodes":[]}`},
+		},
+		{
+			name: "png zTXt",
+			blob: png(pngChunk("zTXt", append([]byte("parameters\x00\x00"), compress(t, parameters)...)), pngChunk("IEND", nil)),
+			want: utils.PNGChunk{"parameters": parameters},
+		},
+		{
+			name:    "png truncated chunk",
+			blob:    png(pngChunk("tEXt", []byte("parameters\x00"+parameters))[:20]),
+			wantErr: true,
+		},
+		{
+			name:    "png tEXt without keyword",
+			blob:    png(pngChunk("tEXt", []byte("parameters")), pngChunk("IEND", nil)),
+			wantErr: true,
+		},
+		{
+			name: "png without text",
+			blob: png(pngChunk("IHDR", make([]byte, 13)), pngChunk("IEND", nil)),
+			want: utils.PNGChunk{},
+		},
+		{
+			name: "jpeg exif user comment",
+			blob: jpegWithExif(exifTIFF(unicodeComment(parameters))),
+			want: utils.PNGChunk{utils.Parameters: parameters},
+		},
+		{
+			name:    "jpeg truncated segment",
+			blob:    jpegWithExif(exifTIFF(unicodeComment(parameters)))[:12],
+			wantErr: true,
+		},
+		{
+			name:    "jpeg truncated user comment",
+			blob:    jpegWithExif(exifTIFF(unicodeComment(parameters))[:50]),
+			wantErr: true,
+		},
+		{
+			name:    "jpeg without exif",
+			blob:    []byte{0xFF, 0xD8, 0xFF, 0xD9},
+			wantErr: true,
+		},
+		{
+			name: "webp exif",
+			blob: webp(webpChunk("VP8X", make([]byte, 10), true), webpChunk("EXIF", exifTIFF(unicodeComment(parameters)), true)),
+			want: utils.PNGChunk{utils.Parameters: parameters},
+		},
+		{
+			name: "webp odd-length chunks",
+			blob: webp(webpChunk("ICCP", make([]byte, 3), true), webpChunk("EXIF", exifTIFF(asciiComment), true)),
+			want: utils.PNGChunk{utils.Parameters: "Steps: 20"},
+		},
+		{
+			name:    "webp odd-length final chunk without padding",
+			blob:    webp(webpChunk("VP8X", make([]byte, 10), true), webpChunk("XMP ", make([]byte, 5), false)),
+			wantErr: true,
+		},
+		{
+			name:    "webp truncated chunk",
+			blob:    webp(webpChunk("EXIF", exifTIFF(asciiComment), true))[:30],
+			wantErr: true,
+		},
+		{
+			name:    "unsupported format",
+			blob:    []byte("GIF89a"),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := embeddedChunks(tt.blob)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("embeddedChunks() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("embeddedChunks() = %q, want %q", got, tt.want)
+			}
+			for key, want := range tt.want {
+				if got[key] != want {
+					t.Errorf("chunk %s = %q, want %q", key, got[key], want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,325 @@
+package service
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/ellypaws/inkbunny-app/pkg/api/rules"
+	"github.com/ellypaws/inkbunny-app/pkg/db"
+)
+
+// Evidence explains why a label was emitted for a submission.
+// A label can have more than one piece of evidence, e.g. one per artist found in the prompt.
+type Evidence struct {
+	Label      db.TicketLabel `json:"label"`
+	Rule       string         `json:"rule"`
+	Confidence float64        `json:"confidence"`        // 0 to 1, how likely the label is not a false positive
+	Source     string         `json:"source"`            // where the evidence was found, see sourceFile, sourceDescription and sourceKeyword
+	Snippet    string         `json:"snippet,omitempty"` // the text around the evidence
+}
+
+// Sources are the file name, the byte offset in the description, the keyword or the metadata field
+func sourceFile(name string) string       { return "file:" + name }
+func sourceDescription(offset int) string { return fmt.Sprintf("description:%d", offset) }
+func sourceKeyword(name string) string    { return "keyword:" + name }
+func sourceMetadata(field string) string  { return "metadata:" + field }
+
+// evidenceCollector returns the evidence for a match of the rule it's registered for.
+type evidenceCollector func(sub *db.Submission, match rules.Match) []Evidence
+
+// evidenceCollectors are keyed by rule name.
+// Rules without a collector are explained by the text they captured, or by their metadata flag.
+var evidenceCollectors = map[string]evidenceCollector{
+	"artist_used":           artistEvidence,
+	"character_used":        characterEvidence,
+	"missing_params":        fileEvidence(1, "image"),
+	"cannot_parse":          fileEvidence(0.9, echo.MIMETextPlain, echo.MIMEApplicationJSON),
+	"missing_prompt":        objectEvidence("prompt", true),
+	"missing_model":         objectEvidence("model", true),
+	"missing_seed":          objectEvidence("seed", true),
+	"missing_steps":         objectEvidence("steps", true),
+	"missing_cfg":           objectEvidence("cfg_scale", true),
+	"missing_sampler":       objectEvidence("sampler", true),
+	"partial_prompt":        objectEvidence("prompt", false),
+	"partial_model":         objectEvidence("model", false),
+	"partial_seed":          objectEvidence("seed", false),
+	"partial_steps":         objectEvidence("steps", false),
+	"partial_cfg":           objectEvidence("cfg_scale", false),
+	"partial_sampler":       objectEvidence("sampler", false),
+	"sold_art":              soldArtEvidence,
+	"content_repost":        repostEvidence,
+	"private_tool":          privateToolEvidence,
+	"private_lora":          privateModelEvidence,
+	"private_model":         privateModelEvidence,
+	"missing_tags":          missingTagsEvidence,
+	"missing_tool_tag":      missingKeywordEvidence,
+	"missing_model_tag":     missingKeywordEvidence,
+	"missing_img2img_input": img2imgEvidence,
+	"before_rule_revision":  updatedEvidence,
+	"detected_human":        humanEvidence,
+}
+
+// LabelEvidence returns the evidence for every label [TicketLabels] emits for the submission, in the same order.
+// Labels are named as in [TicketLabels], with informational labels keeping their prefix.
+func LabelEvidence(submission db.Submission) []Evidence {
+	var evidence []Evidence
+	for _, match := range rules.Active().Evaluate(&submission) {
+		collect, ok := evidenceCollectors[match.Rule.Name]
+		if !ok {
+			collect = capturedEvidence
+		}
+		found := collect(&submission, match)
+		if len(found) == 0 {
+			found = capturedEvidence(&submission, match)
+		}
+		label := match.Label
+		if match.Informational {
+			label = rules.Informational(label)
+		}
+		for i := range found {
+			found[i].Label = label
+			found[i].Rule = match.Rule.Name
+		}
+		evidence = append(evidence, found...)
+	}
+	return evidence
+}
+
+// capturedEvidence finds the text captured by a "matches" condition in the description,
+// falling back to the metadata flag named by the rule.
+func capturedEvidence(sub *db.Submission, match rules.Match) []Evidence {
+	if match.Captured != "" {
+		if i := strings.Index(sub.Description, match.Captured); i >= 0 {
+			return []Evidence{{
+				Confidence: 0.5,
+				Source:     sourceDescription(i),
+				Snippet:    snippetAround(sub.Description, i, i+len(match.Captured)),
+			}}
+		}
+		return []Evidence{{Confidence: 0.5, Source: sourceMetadata(match.Rule.Name), Snippet: match.Captured}}
+	}
+	return []Evidence{{Confidence: 1, Source: sourceMetadata(match.Rule.Name)}}
+}
+
+func artistEvidence(sub *db.Submission, _ rules.Match) []Evidence {
+	var evidence []Evidence
+	for _, artist := range sub.Metadata.ArtistUsed {
+		// artists found by a "by <name>" phrase aren't registered, so they may be a common word
+		confidence := 0.6
+		if artist.UserID != nil || len(artist.Aliases) > 0 {
+			confidence = 0.9
+		}
+		evidence = append(evidence, promptEvidence(sub, artist.Username, artist.Matches, confidence)...)
+	}
+	return evidence
+}
+
+func characterEvidence(sub *db.Submission, _ rules.Match) []Evidence {
+	var evidence []Evidence
+	for _, character := range sub.Metadata.CharacterUsed {
+		evidence = append(evidence, promptEvidence(sub, character.Name, character.Matches, 0.8)...)
+	}
+	return evidence
+}
+
+// promptEvidence quotes each match in the prompt it was found in.
+// Matches in the negative prompt are half as likely to be a use.
+func promptEvidence(sub *db.Submission, name string, matches []db.PromptMatch, confidence float64) []Evidence {
+	if len(matches) == 0 {
+		return []Evidence{{Confidence: confidence, Source: sourceMetadata("prompt"), Snippet: name}}
+	}
+	evidence := make([]Evidence, 0, len(matches))
+	for _, match := range matches {
+		obj := sub.Metadata.Objects[match.Object]
+		prompt := obj.Prompt
+		found := Evidence{Confidence: confidence, Source: sourceFile(match.Object), Snippet: match.Alias}
+		if match.Negative {
+			prompt = obj.NegativePrompt
+			found.Confidence /= 2
+		}
+		if match.Start >= 0 && match.Start <= match.End && match.End <= len(prompt) {
+			found.Snippet = snippetAround(prompt, match.Start, match.End)
+		}
+		evidence = append(evidence, found)
+	}
+	return evidence
+}
+
+// fileEvidence lists the files with one of the MIME type prefixes as the source.
+func fileEvidence(confidence float64, mimeTypes ...string) evidenceCollector {
+	return func(sub *db.Submission, _ rules.Match) []Evidence {
+		var evidence []Evidence
+		for _, file := range sub.Files {
+			if !slices.ContainsFunc(mimeTypes, func(mimeType string) bool {
+				return strings.HasPrefix(file.File.MimeType, mimeType)
+			}) {
+				continue
+			}
+			evidence = append(evidence, Evidence{Confidence: confidence, Source: sourceFile(file.File.FileName)})
+		}
+		return evidence
+	}
+}
+
+// objectEvidence lists the objects missing fact.
+// Partial labels also quote an object that has it.
+func objectEvidence(fact string, missing bool) evidenceCollector {
+	return func(sub *db.Submission, _ rules.Match) []Evidence {
+		var evidence []Evidence
+		var example *Evidence
+		for _, name := range slices.Sorted(maps.Keys(sub.Metadata.Objects)) {
+			value := rules.ObjectFact(fact, sub.Metadata.Objects[name])
+			if value != nil && value != "" {
+				if example == nil && !missing {
+					example = &Evidence{Confidence: 1, Source: sourceFile(name), Snippet: fmt.Sprintf("%s: %v", fact, value)}
+				}
+				continue
+			}
+			evidence = append(evidence, Evidence{Confidence: 1, Source: sourceFile(name), Snippet: fmt.Sprintf("no %s", fact)})
+		}
+		if example != nil {
+			evidence = append(evidence, *example)
+		}
+		return evidence
+	}
+}
+
+// soldArtEvidence quotes the sale signals, a listing is certain while offers in the text may be commissions.
+func soldArtEvidence(sub *db.Submission, _ rules.Match) []Evidence {
+	evidence := make([]Evidence, 0, len(sub.Metadata.SoldArtEvidence))
+	for _, sale := range sub.Metadata.SoldArtEvidence {
+		found := Evidence{Confidence: 0.7, Source: sale.Source, Snippet: sale.Snippet}
+		switch sale.Source {
+		case db.SaleListing:
+			found.Confidence = 1
+		case db.SaleDescription:
+			if i := strings.Index(sub.Description, sale.Signal); i >= 0 {
+				found.Source = sourceDescription(i)
+			}
+		case db.SaleKeyword:
+			found.Source = sourceKeyword(sale.Signal)
+		}
+		evidence = append(evidence, found)
+	}
+	return evidence
+}
+
+// repostEvidence names the earlier submissions, identical files are certain and near-identical ones less so.
+func repostEvidence(sub *db.Submission, _ rules.Match) []Evidence {
+	evidence := make([]Evidence, 0, len(sub.Metadata.Reposts))
+	for _, repost := range sub.Metadata.Reposts {
+		confidence := 1.0
+		if repost.Distance > 0 {
+			confidence = 0.8
+		}
+		evidence = append(evidence, Evidence{
+			Confidence: confidence,
+			Source:     fmt.Sprintf("submission:%d", repost.SubmissionID),
+			Snippet:    fmt.Sprintf("md5 %s, distance %d", repost.MD5, repost.Distance),
+		})
+	}
+	return evidence
+}
+
+// privateToolEvidence quotes the private tool in the description or the prompts.
+func privateToolEvidence(sub *db.Submission, _ rules.Match) []Evidence {
+	if loc := PrivateTools.FindStringIndex(sub.Description); loc != nil {
+		return []Evidence{{
+			Confidence: 0.7,
+			Source:     sourceDescription(loc[0]),
+			Snippet:    snippetAround(sub.Description, loc[0], loc[1]),
+		}}
+	}
+	for _, name := range slices.Sorted(maps.Keys(sub.Metadata.Objects)) {
+		prompt := sub.Metadata.Objects[name].Prompt
+		if loc := PrivateTools.FindStringIndex(prompt); loc != nil {
+			return []Evidence{{Confidence: 0.8, Source: sourceFile(name), Snippet: snippetAround(prompt, loc[0], loc[1])}}
+		}
+	}
+	return []Evidence{{Confidence: 0.9, Source: sourceMetadata("generator"), Snippet: sub.Metadata.Generator}}
+}
+
+// privateModelEvidence names the objects using the hashes found neither in the models table nor on CivitAI.
+func privateModelEvidence(sub *db.Submission, match rules.Match) []Evidence {
+	private := sub.Metadata.PrivateLoras
+	if match.Rule.Name == "private_model" {
+		private = sub.Metadata.PrivateModels
+	}
+	var evidence []Evidence
+	for _, name := range slices.Sorted(maps.Keys(sub.Metadata.Objects)) {
+		obj := sub.Metadata.Objects[name]
+		hashes := slices.Sorted(maps.Keys(obj.LoraHashes))
+		if match.Rule.Name == "private_model" {
+			hashes = []string{checkpointHash(obj.OverrideSettings.SDCheckpointHash)}
+		}
+		for _, hash := range hashes {
+			if hash != "" && slices.Contains(private, hash) {
+				evidence = append(evidence, Evidence{Confidence: 0.8, Source: sourceFile(name), Snippet: hash})
+			}
+		}
+	}
+	return evidence
+}
+
+// missingTagsEvidence suggests the AI keyword that is missing.
+func missingTagsEvidence(sub *db.Submission, _ rules.Match) []Evidence {
+	keyword := aiGeneratedKeyword
+	if slices.Contains(sub.Metadata.SuggestedKeywords, aiAssistedKeyword) {
+		keyword = aiAssistedKeyword
+	}
+	return []Evidence{{Confidence: 0.9, Source: sourceKeyword(keyword), Snippet: "not tagged with " + keyword}}
+}
+
+// missingKeywordEvidence names the keyword the label is about, the ${item} of missing_tool_tag and missing_model_tag.
+func missingKeywordEvidence(_ *db.Submission, match rules.Match) []Evidence {
+	_, keyword, _ := strings.Cut(string(match.Label), ":")
+	return []Evidence{{Confidence: 0.7, Source: sourceKeyword(keyword), Snippet: "not tagged with " + keyword}}
+}
+
+// img2imgEvidence lists the generated pages, the input is only guessed from the aspect ratio.
+func img2imgEvidence(sub *db.Submission, _ rules.Match) []Evidence {
+	var evidence []Evidence
+	for name, obj := range sub.Metadata.Objects {
+		if usedImg2Img(obj) {
+			evidence = append(evidence, Evidence{
+				Confidence: 0.6,
+				Source:     sourceFile(name),
+				Snippet:    fmt.Sprintf("denoising strength %v", obj.DenoisingStrength),
+			})
+		}
+	}
+	slices.SortFunc(evidence, func(a, b Evidence) int { return strings.Compare(a.Source, b.Source) })
+	if len(evidence) == 0 && sub.Metadata.Img2Img {
+		evidence = append(evidence, Evidence{Confidence: 0.6, Source: sourceKeyword(img2imgKeyword)})
+	}
+	return evidence
+}
+
+func updatedEvidence(sub *db.Submission, _ rules.Match) []Evidence {
+	return []Evidence{{Confidence: 1, Source: sourceMetadata("updated"), Snippet: sub.Updated.Format(time.DateOnly)}}
+}
+
+func humanEvidence(sub *db.Submission, _ rules.Match) []Evidence {
+	return []Evidence{{
+		Confidence: sub.Metadata.HumanConfidence,
+		Source:     sourceMetadata("human_confidence"),
+		Snippet:    fmt.Sprintf("%.0f%%", sub.Metadata.HumanConfidence*100),
+	}}
+}
+
+// writeEvidence lists the evidence for each label, so false positives can be spotted in the ticket.
+func writeEvidence(evidence []Evidence) string {
+	var sb strings.Builder
+	for _, found := range evidence {
+		sb.WriteString(fmt.Sprintf("\n[b]%s[/b] (%.0f%%) %s", found.Label, found.Confidence*100, found.Source))
+		if found.Snippet != "" {
+			sb.WriteString(fmt.Sprintf(": [i]%s[/i]", found.Snippet))
+		}
+	}
+	return sb.String()
+}
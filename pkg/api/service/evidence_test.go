@@ -0,0 +1,96 @@
+package service
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ellypaws/inkbunny-sd/entities"
+
+	"github.com/ellypaws/inkbunny-app/pkg/db"
+)
+
+func TestLabelEvidence(t *testing.T) {
+	userID := int64(42)
+	prompt := "a fox in the forest, by some_artist, highly detailed"
+	sub := db.Submission{
+		Description: "Support me on patreon for more!",
+		Updated:     time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Metadata: db.Metadata{
+			AISubmission: true,
+			Generated:    true,
+			ArtistUsed: []db.Artist{{
+				Username: "some_artist",
+				UserID:   &userID,
+				Matches:  []db.PromptMatch{{Alias: "some_artist", Object: "a.png", Start: 23, End: 34}},
+			}},
+			Objects: map[string]entities.TextToImageRequest{
+				"a.png": {Prompt: prompt, Seed: 1234, Steps: 20, CFGScale: 7, SamplerName: "Euler a"},
+				"b.png": {Prompt: prompt, Steps: 20, CFGScale: 7, SamplerName: "Euler a"},
+			},
+		},
+	}
+
+	evidence := LabelEvidence(sub)
+	find := func(label db.TicketLabel) []Evidence {
+		var found []Evidence
+		for _, e := range evidence {
+			if e.Label == label {
+				found = append(found, e)
+			}
+		}
+		return found
+	}
+
+	artist := find("artist_used")
+	if len(artist) != 1 {
+		t.Fatalf("artist_used evidence = %+v, want 1", artist)
+	}
+	if artist[0].Source != "file:a.png" || artist[0].Confidence != 0.9 || artist[0].Snippet != prompt {
+		t.Errorf("artist_used evidence = %+v", artist[0])
+	}
+
+	seed := find("partial_seed")
+	sources := make([]string, len(seed))
+	for i, e := range seed {
+		sources[i] = e.Source
+	}
+	if want := []string{"file:b.png", "file:a.png"}; !slices.Equal(sources, want) {
+		t.Errorf("partial_seed sources = %v, want %v", sources, want)
+	}
+
+	payment := find("payment_mention:patreon")
+	if len(payment) != 1 || payment[0].Source != "description:14" || payment[0].Snippet != sub.Description {
+		t.Errorf("payment_mention evidence = %+v", payment)
+	}
+
+	for _, e := range evidence {
+		if e.Rule == "" || e.Source == "" {
+			t.Errorf("incomplete evidence %+v", e)
+		}
+	}
+}
+
+func TestLabelEvidenceInformational(t *testing.T) {
+	sub := db.Submission{
+		Updated: time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC),
+		Metadata: db.Metadata{
+			AISubmission: true,
+			Generated:    true,
+			Objects:      map[string]entities.TextToImageRequest{"a.txt": {Prompt: "a cat"}},
+		},
+	}
+	var found bool
+	for _, e := range LabelEvidence(sub) {
+		if e.Rule != "missing_seed" {
+			continue
+		}
+		found = true
+		if e.Label != "info:missing_seed" || e.Source != "file:a.txt" {
+			t.Errorf("missing_seed evidence = %+v", e)
+		}
+	}
+	if !found {
+		t.Error("missing evidence for missing_seed")
+	}
+}
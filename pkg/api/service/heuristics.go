@@ -8,7 +8,6 @@ import (
 	"fmt"
 	"maps"
 	"reflect"
-	"regexp"
 	"slices"
 	"strings"
 	"sync"
@@ -25,10 +24,13 @@ import (
 	"github.com/ellypaws/inkbunny-sd/utils"
 )
 
-func RetrieveParams(c echo.Context, wg *sync.WaitGroup, sub *db.Submission, cacheToUse cache.Cache, artists []db.Artist) {
+func RetrieveParams(c echo.Context, wg *sync.WaitGroup, sub *db.Submission, cacheToUse cache.Cache, database db.Store, artists []db.Artist, characters []db.Character) {
 	defer wg.Done()
+	// keywords and pages can change without the parameters changing, so they are checked after caching
+	defer checkKeywords(sub, database)
+	defer checkImg2ImgInput(sub)
 
-	key := fmt.Sprintf("%s:parameters:%d", echo.MIMEApplicationJSON, sub.ID)
+	key := parametersKey(sub.ID)
 	if c.Request().Header.Get(echo.HeaderCacheControl) != "no-cache" {
 		item, err := cacheToUse.Get(key)
 		if err == nil {
@@ -59,11 +61,15 @@ func RetrieveParams(c echo.Context, wg *sync.WaitGroup, sub *db.Submission, cach
 			sub.Metadata.MissingModel = metadata.MissingModel
 			sub.Metadata.MissingTags = metadata.MissingTags
 			sub.Metadata.ArtistUsed = metadata.ArtistUsed
+			sub.Metadata.ArtistConsented = metadata.ArtistConsented
+			sub.Metadata.CharacterUsed = metadata.CharacterUsed
 			sub.Metadata.PrivateModel = metadata.PrivateModel
 			sub.Metadata.PrivateLora = metadata.PrivateLora
+			sub.Metadata.PrivateModels = metadata.PrivateModels
+			sub.Metadata.PrivateLoras = metadata.PrivateLoras
 			sub.Metadata.PrivateTool = metadata.PrivateTool
-			sub.Metadata.SoldArt = metadata.SoldArt
 			sub.Metadata.Generator = metadata.Generator
+			sub.Metadata.Parser = metadata.Parser
 
 			sub.Metadata.Params = metadata.Params
 			sub.Metadata.Objects = metadata.Objects
@@ -74,8 +80,12 @@ func RetrieveParams(c echo.Context, wg *sync.WaitGroup, sub *db.Submission, cach
 		c.Logger().Debugf("Cache miss for %s retrieving params...", key)
 	}
 
-	processParams(c, sub, cacheToUse)
-	processObjectMetadata(sub, artists)
+	processParams(c, sub, cacheToUse, ParserBindings(database))
+	processObjectMetadata(sub, artists, characters)
+	if !resolveModels(c, sub, cacheToUse, database) {
+		return
+	}
+	sub.Metadata.Version = Version()
 	if sub.Metadata.Objects != nil || sub.Metadata.Params != nil {
 		bin, err := json.Marshal(sub.Metadata)
 		if err != nil {
@@ -97,12 +107,13 @@ func RetrieveParams(c echo.Context, wg *sync.WaitGroup, sub *db.Submission, cach
 
 const MIMETextRTF = "text/rtf"
 
-func processParams(c echo.Context, sub *db.Submission, cacheToUse cache.Cache) {
+func processParams(c echo.Context, sub *db.Submission, cacheToUse cache.Cache, bindings []db.ParserBinding) {
 	if sub.Metadata.Params != nil {
 		return
 	}
 
 	var textFiles []*db.File
+	var imageFiles []*db.File
 
 	for i, f := range sub.Files {
 		switch f.File.MimeType {
@@ -113,11 +124,13 @@ func processParams(c echo.Context, sub *db.Submission, cacheToUse cache.Cache) {
 			textFiles = append(textFiles, &sub.Files[i])
 		case echo.MIMETextPlain, MIMETextRTF:
 			textFiles = append(textFiles, &sub.Files[i])
+		case MIMEImagePNG, MIMEImageJPEG, MIMEImageWebP:
+			imageFiles = append(imageFiles, &sub.Files[i])
 		}
 	}
 
-	if len(textFiles) == 0 {
-		processDescriptionHeuristics(c, sub)
+	if len(textFiles) == 0 && len(imageFiles) == 0 {
+		processDescriptionHeuristics(c, sub, bindings)
 		return
 	}
 
@@ -125,6 +138,19 @@ func processParams(c echo.Context, sub *db.Submission, cacheToUse cache.Cache) {
 		wg sync.WaitGroup
 		mu sync.Mutex
 	)
+	for _, imageFile := range imageFiles {
+		wg.Add(1)
+		go func(imageFile *db.File) {
+			defer wg.Done()
+			chunks, err := retrieveChunks(c, cacheToUse, imageFile)
+			if err != nil {
+				c.Logger().Errorf("error reading embedded metadata from %s: (%s) %v", imageFile.File.FileURLFull, sub.URL, err)
+				return
+			}
+
+			embeddedHeuristics(c, sub, chunks, imageFile, &mu, bindings)
+		}(imageFile)
+	}
 	for _, textFile := range textFiles {
 		wg.Add(1)
 		go func(textFile *db.File) {
@@ -153,12 +179,12 @@ func processParams(c echo.Context, sub *db.Submission, cacheToUse cache.Cache) {
 			}
 
 			if b.MimeType == echo.MIMEApplicationJSON || (bytes.HasPrefix(b.Blob, []byte("{")) && bytes.HasSuffix(b.Blob, []byte("}"))) {
-				if jsonHeuristics(c, sub, b, textFile, &mu) {
+				if jsonHeuristics(c, sub, b, textFile, &mu, bindings) {
 					return
 				}
 			}
 
-			if err := parameterHeuristics(c, sub, textFile, b, &mu); err != nil {
+			if err := parameterHeuristics(c, sub, textFile, b, &mu, bindings); err != nil {
 				c.Logger().Errorf("error processing params for %s: %v", textFile.File.FileName, err)
 				return
 			}
@@ -167,15 +193,13 @@ func processParams(c echo.Context, sub *db.Submission, cacheToUse cache.Cache) {
 	wg.Wait()
 
 	if len(sub.Metadata.Objects) == 0 {
-		processDescriptionHeuristics(c, sub)
+		processDescriptionHeuristics(c, sub, bindings)
 		return
 	}
 }
 
-var additionalArtists = regexp.MustCompile(`(?im)[\[({<|:,]\s*by ([^:,\r\n\])}>]+)|^by ([^:,\r\n\])}>]+)`)
-
 // deferred call to set metadata flags after processing objects
-func processObjectMetadata(submission *db.Submission, artists []db.Artist) {
+func processObjectMetadata(submission *db.Submission, artists []db.Artist, characters []db.Character) {
 	submission.Metadata.MissingPrompt = true
 	submission.Metadata.MissingModel = true
 
@@ -188,28 +212,10 @@ func processObjectMetadata(submission *db.Submission, artists []db.Artist) {
 		sizes[1] = max(sizes[1], int(f.File.FullSizeY))
 		break
 	}
+	findArtists(submission, artists)
+	findCharacters(submission, characters)
 	for _, obj := range submission.Metadata.Objects {
 		submission.Metadata.AISubmission = true
-		for _, artist := range artists {
-			re, err := regexp.Compile(fmt.Sprintf(`(?i)\b%s\b`, strings.ToLower(artist.Username)))
-			if err != nil {
-				continue
-			}
-			if re.MatchString(obj.Prompt) {
-				submission.Metadata.ArtistUsed = append(submission.Metadata.ArtistUsed, artist)
-			}
-		}
-
-		additionalArtists := additionalArtists.FindAllStringSubmatch(obj.Prompt, -1)
-		for _, match := range additionalArtists {
-			for _, artist := range strings.Split(strings.Join(match[1:], ""), "|") {
-				if !slices.ContainsFunc(submission.Metadata.ArtistUsed, func(stored db.Artist) bool {
-					return strings.EqualFold(stored.Username, artist)
-				}) {
-					submission.Metadata.ArtistUsed = append(submission.Metadata.ArtistUsed, db.Artist{Username: artist})
-				}
-			}
-		}
 
 		if tool := PrivateTools.FindString(obj.Prompt); tool != "" {
 			submission.Metadata.PrivateTool = true
@@ -231,14 +237,9 @@ func processObjectMetadata(submission *db.Submission, artists []db.Artist) {
 	}
 }
 
-func jsonHeuristics(c echo.Context, sub *db.Submission, b *cache.Item, textFile *db.File, mu *sync.Mutex) bool {
+func jsonHeuristics(c echo.Context, sub *db.Submission, b *cache.Item, textFile *db.File, mu *sync.Mutex, bindings []db.ParserBinding) bool {
 	b.Blob = bytes.ReplaceAll(b.Blob, []byte("NaN"), []byte("null"))
-	best := preferBest(c, b.Blob, map[string]Converter{
-		"comfy_ui":       &comfyui.Basic{},
-		"comfy_ui_api":   &comfyui.Api{},
-		"invoke_ai":      &entities.InvokeAI{},
-		"easy_diffusion": &entities.EasyDiffusion{},
-	})
+	best := preferBest(c, b.Blob, jsonConverters)
 	if best == nil {
 		c.Logger().Warnf("no suitable type found for %s", sub.URL)
 	} else {
@@ -252,31 +253,29 @@ func jsonHeuristics(c echo.Context, sub *db.Submission, b *cache.Item, textFile
 				best.label: string(b.Blob),
 			},
 		})
-		mu.Unlock()
 		sub.Metadata.Generator = best.label
+		if PrivateTools.MatchString(best.label) {
+			sub.Metadata.PrivateTool = true
+		}
+		mu.Unlock()
 		return true
 	}
 
-	if sub.UserID == 1247248 {
-		cubFestAI, err := comfyui.UnmarshalCubFestAIDate(b.Blob)
+	if parser, ok := parserFor(bindings, ParserJSON, sub.UserID, textFile.File.FileName, b.Blob, ""); ok {
+		params, objects, err := parser.Parse(b.Blob, textFile.File.FileName)
 		if err != nil {
-			c.Logger().Warnf("error parsing comfy ui (CubFestAI) %s: %s", textFile.File.FileURLFull, err)
+			c.Logger().Warnf("error parsing %s with %s: %s", textFile.File.FileURLFull, parser.Name, err)
 		}
-		if err == nil && !reflect.DeepEqual(cubFestAI, comfyui.CubFestAITime{}) {
-			c.Logger().Debugf("comfy ui cub fest ai found for %s", sub.URL)
-			var objects = make(map[string]entities.TextToImageRequest)
-			for key, value := range cubFestAI {
-				objects[key] = value.Convert()
-			}
+		if err == nil && len(objects) > 0 {
+			c.Logger().Debugf("%s found for %s", parser.Name, sub.URL)
 			mu.Lock()
 			insertOrInitalize(&sub.Metadata.Objects, objects)
-			insertOrInitalize(&sub.Metadata.Params, utils.Params{
-				textFile.File.FileName: utils.PNGChunk{
-					"comfy_ui": string(b.Blob),
-				},
-			})
+			insertOrInitalize(&sub.Metadata.Params, params)
+			sub.Metadata.Parser = parser.Name
+			if parser.Generator != "" {
+				sub.Metadata.Generator = parser.Generator
+			}
 			mu.Unlock()
-			sub.Metadata.Generator = "comfy_ui"
 			return true
 		}
 	}
@@ -285,6 +284,19 @@ func jsonHeuristics(c echo.Context, sub *db.Submission, b *cache.Item, textFile
 	return false
 }
 
+// jsonConverters are the JSON formats tried by jsonHeuristics, by the generator they are recorded as.
+var jsonConverters = map[string]Converter{
+	"comfy_ui":       &comfyui.Basic{},
+	"comfy_ui_api":   &comfyui.Api{},
+	"invoke_ai":      &entities.InvokeAI{},
+	"easy_diffusion": &entities.EasyDiffusion{},
+	"fooocus":        &Fooocus{},
+	"swarm_ui":       &SwarmUI{},
+	"forge":          &Forge{},
+	"draw_things":    &DrawThings{},
+	"novelai":        &NovelAI{},
+}
+
 type Converter interface {
 	Convert() *entities.TextToImageRequest
 }
@@ -317,6 +329,16 @@ func preferBest(c echo.Context, blob []byte, types map[string]Converter) *conver
 			object, err = unmarshal[*entities.EasyDiffusion](blob)
 		case *entities.InvokeAI:
 			object, err = unmarshal[*entities.InvokeAI](blob)
+		case *Fooocus:
+			object, err = unmarshal[*Fooocus](blob)
+		case *SwarmUI:
+			object, err = unmarshal[*SwarmUI](blob)
+		case *Forge:
+			object, err = unmarshal[*Forge](blob)
+		case *DrawThings:
+			object, err = unmarshal[*DrawThings](blob)
+		case *NovelAI:
+			object, err = unmarshal[*NovelAI](blob)
 		default:
 			continue
 		}
@@ -341,6 +363,10 @@ func preferBest(c echo.Context, blob []byte, types map[string]Converter) *conver
 			if errors.As(err, &e) {
 				c.Logger().Warnf("parsed %s with some errors. errors/ok: %d/%d", label, e.Len(), len(*object))
 			}
+		case recognizer:
+			if !object.Recognized() {
+				continue
+			}
 		default:
 			if reflect.DeepEqual(object, zero) {
 				continue
@@ -397,65 +423,93 @@ func insertOrInitalize[M interface{ ~map[K]V }, K comparable, V any](m *M, v M)
 	return true
 }
 
-// Because some artists already have standardized txt files, opt to split each file separately
-func parameterHeuristics(c echo.Context, sub *db.Submission, textFile *db.File, b *cache.Item, mu *sync.Mutex) error {
-	var params utils.Params
-	var err error
+// embeddedHeuristics reads the metadata chunks embedded in an image file.
+// Objects and Params are keyed by file name and page, e.g. "image.png (page 2)".
+func embeddedHeuristics(c echo.Context, sub *db.Submission, chunks utils.PNGChunk, imageFile *db.File, mu *sync.Mutex, bindings []db.ParserBinding) {
+	if len(chunks) == 0 {
+		return
+	}
+	c.Logger().Debugf("found embedded metadata in %s", imageFile.File.FileName)
+
+	page := *imageFile
+	page.File.FileName = fmt.Sprintf("%s (page %d)", imageFile.File.FileName, imageFile.File.SubmissionFileOrder+1)
+
+	var found bool
+	for _, key := range []string{"workflow", "prompt"} {
+		blob, ok := chunks[key]
+		if !ok {
+			continue
+		}
+		item := &cache.Item{
+			Blob:     []byte(blob),
+			MimeType: echo.MIMEApplicationJSON,
+		}
+		if jsonHeuristics(c, sub, item, &page, mu, bindings) {
+			found = true
+			break
+		}
+	}
+
+	if p, ok := chunks[utils.Parameters]; ok && !found {
+		heuristics, err := utils.ParameterHeuristics(p)
+		if err != nil {
+			c.Logger().Errorf("error processing embedded parameters for %s: %v", page.File.FileName, err)
+		} else if !reflect.DeepEqual(heuristics, entities.TextToImageRequest{}) {
+			mu.Lock()
+			insertOrInitalize(&sub.Metadata.Objects, map[string]entities.TextToImageRequest{page.File.FileName: heuristics})
+			mu.Unlock()
+		}
+		if tool := PrivateTools.FindString(p); tool != "" {
+			mu.Lock()
+			sub.Metadata.AISubmission = true
+			sub.Metadata.PrivateTool = true
+			sub.Metadata.Generator = tool
+			mu.Unlock()
+		}
+	}
+
+	mu.Lock()
+	if params, ok := sub.Metadata.Params[page.File.FileName]; ok {
+		maps.Copy(params, chunks)
+	} else {
+		insertOrInitalize(&sub.Metadata.Params, utils.Params{page.File.FileName: chunks})
+	}
+	mu.Unlock()
+}
+
+// Because some artists already have standardized txt files, opt to split each file separately.
+// The parser is picked by the bindings, see [parserFor].
+func parameterHeuristics(c echo.Context, sub *db.Submission, textFile *db.File, b *cache.Item, mu *sync.Mutex, bindings []db.ParserBinding) error {
 	f := &textFile.File
 	c.Logger().Debugf("processing params for %s", f.FileName)
 
-	baseConfig := utils.Config{Text: string(b.Blob), Filename: f.FileName}
-	switch sub.UserID {
-	case utils.IDAutoSnep:
-		params, err = utils.AutoSnep(utils.WithConfig(baseConfig))
-	case utils.IDDruge:
-		params, err = utils.Common(utils.WithBytes(b.Blob), utils.UseDruge(), utils.WithFilename(f.FileName))
-	case utils.IDAIBean:
-		params, err = utils.Common(utils.WithBytes(b.Blob), utils.UseAIBean(), utils.WithFilename(f.FileName))
-	case utils.IDArtieDragon:
-		params, err = utils.Common(utils.WithBytes(b.Blob), utils.UseArtie(), utils.WithFilename(f.FileName))
-	case 1125540:
-		hasFileName := func(line string) bool { return strings.HasPrefix(line, "File Name") }
-		params, err = utils.Common(utils.WithConfig(baseConfig), utils.WithKeyCondition(hasFileName))
-	case utils.IDFairyGarden:
-		params, err = utils.Common(utils.WithBytes(b.Blob), utils.UseFairyGarden(), utils.WithFilename(f.FileName))
-	case utils.IDCirn0:
-		params, err = utils.Cirn0(utils.WithConfig(baseConfig))
-	case utils.IDHornybunny:
-		params, err = utils.Common(utils.WithBytes(b.Blob), utils.UseHornybunny(), utils.WithFilename(f.FileName))
-	case utils.IDMethuzalach:
-		params, err = utils.Common(utils.WithBytes(b.Blob), utils.UseMethuzalach(), utils.WithFilename(f.FileName))
-	case utils.IDSoph:
-		if utils.SophStartInvokeAI.Match(b.Blob) {
-			if param, err := utils.Soph(utils.WithConfig(baseConfig)); err == nil {
-				mu.Lock()
-				insertOrInitalize(&sub.Metadata.Objects, param)
-				mu.Unlock()
-				return nil
-			}
-		}
-		params, err = utils.Common(utils.WithConfig(baseConfig), utils.UseSoph())
-	case utils.IDNastAI:
-		params, err = utils.Sequential(utils.WithConfig(baseConfig))
-	default:
-		params, err = utils.Common(
-			utils.WithBytes(bytes.Join([][]byte{[]byte(f.FileName), b.Blob}, []byte("\n"))),
-			utils.WithKeyCondition(func(line string) bool { return strings.HasPrefix(line, f.FileName) }))
+	parser, ok := parserFor(bindings, ParserText, sub.UserID, f.FileName, b.Blob, defaultTextParser)
+	if !ok {
+		return fmt.Errorf("no parser for %s", f.FileName)
 	}
+	params, objects, err := parser.Parse(b.Blob, f.FileName)
 	if err != nil {
 		return err
 	}
+	if len(objects) > 0 {
+		mu.Lock()
+		insertOrInitalize(&sub.Metadata.Objects, objects)
+		sub.Metadata.Parser = parser.Name
+		mu.Unlock()
+		return nil
+	}
 	if len(params) > 0 {
-		c.Logger().Debugf("finished params for %s", f.FileName)
+		c.Logger().Debugf("finished params for %s with %s", f.FileName, parser.Name)
 		mu.Lock()
 		insertOrInitalize(&sub.Metadata.Params, params)
-		paramsToObject(c, sub, textFile)
+		sub.Metadata.Parser = parser.Name
+		paramsToObject(c, sub, textFile, bindings)
 		mu.Unlock()
 	}
 	return nil
 }
 
-func paramsToObject(c echo.Context, sub *db.Submission, textFile *db.File) {
+func paramsToObject(c echo.Context, sub *db.Submission, textFile *db.File, bindings []db.ParserBinding) {
 	if sub.Metadata.Objects != nil {
 		return
 	}
@@ -482,7 +536,7 @@ func paramsToObject(c echo.Context, sub *db.Submission, textFile *db.File) {
 				}
 				textFile := *textFile
 				textFile.File.FileName = fmt.Sprintf("%s (%s)", name, object)
-				if !jsonHeuristics(c, sub, item, &textFile, &mutex) {
+				if !jsonHeuristics(c, sub, item, &textFile, &mutex, bindings) {
 					return
 				}
 				mutex.Lock()
@@ -521,23 +575,21 @@ func paramsToObject(c echo.Context, sub *db.Submission, textFile *db.File) {
 	wg.Wait()
 }
 
-func processDescriptionHeuristics(c echo.Context, sub *db.Submission) {
+func processDescriptionHeuristics(c echo.Context, sub *db.Submission, bindings []db.ParserBinding) {
 	c.Logger().Debugf("processing description heuristics for %s", sub.URL)
-	var heuristics entities.TextToImageRequest
-	var err error
-	switch sub.UserID {
-	case utils.IDRNSDAI:
-		heuristics, err = utils.RNSDAIHeuristics(sub.Description)
-	default:
-		heuristics, err = utils.DescriptionHeuristics(sub.Description)
+	parser, ok := parserFor(bindings, ParserDescription, sub.UserID, sub.Title, []byte(sub.Description), defaultDescriptionParser)
+	if !ok {
+		return
 	}
+	_, objects, err := parser.Parse([]byte(sub.Description), sub.Title)
 	if err != nil {
 		c.Logger().Errorf("error processing description heuristics for %s: %v", sub.URL, err)
 		return
 	}
-	if reflect.DeepEqual(heuristics, entities.TextToImageRequest{}) {
+	if reflect.DeepEqual(objects[sub.Title], entities.TextToImageRequest{}) {
 		c.Logger().Debugf("no heuristics found for %s", sub.URL)
 		return
 	}
-	insertOrInitalize(&sub.Metadata.Objects, map[string]entities.TextToImageRequest{sub.Title: heuristics})
+	insertOrInitalize(&sub.Metadata.Objects, objects)
+	sub.Metadata.Parser = parser.Name
 }
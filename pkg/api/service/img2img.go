@@ -0,0 +1,154 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/ellypaws/inkbunny-sd/entities"
+	"github.com/ellypaws/inkbunny/api"
+
+	"github.com/ellypaws/inkbunny-app/pkg/db"
+)
+
+// maxAspectDifference is how far the aspect ratio of an input page can be from the output, img2img keeps it
+const maxAspectDifference = 0.1
+
+// checkImg2ImgInput sets MissingImg2ImgInput when the submission used img2img but no page looks like the input.
+// Img2img is detected from the img2img keyword, img2img requests in the parameters and the denoising strength.
+// Pages named by init_images, or with the same size as an embedded init image, are taken as the input.
+// Otherwise any page besides the generated ones with a similar aspect ratio is a plausible input.
+func checkImg2ImgInput(sub *db.Submission) {
+	sub.Metadata.MissingImg2ImgInput = false
+	sub.Metadata.Img2ImgInputs = nil
+	if !sub.Metadata.AISubmission {
+		return
+	}
+
+	requests := img2imgRequests(sub)
+	used := sub.Metadata.Img2Img || len(requests) > 0
+	for _, obj := range sub.Metadata.Objects {
+		if usedImg2Img(obj) {
+			used = true
+		}
+	}
+	if !used {
+		return
+	}
+
+	var pages []api.File
+	for _, file := range sub.Files {
+		if strings.HasPrefix(file.File.MimeType, "image") {
+			pages = append(pages, file.File)
+		}
+	}
+
+	for _, request := range requests {
+		for _, reference := range request.Img2Img.InitImages {
+			for _, page := range pages {
+				if initImageMatches(reference, page) {
+					addInput(sub, page.FileName)
+				}
+			}
+		}
+	}
+	if len(sub.Metadata.Img2ImgInputs) > 0 {
+		return
+	}
+
+	outputs := generatedPages(sub, pages)
+	for _, page := range pages {
+		if slices.ContainsFunc(outputs, func(output api.File) bool { return output.FileName == page.FileName }) {
+			continue
+		}
+		if slices.ContainsFunc(outputs, func(output api.File) bool {
+			return similarAspect(page, int64(output.FullSizeX), int64(output.FullSizeY))
+		}) {
+			addInput(sub, page.FileName)
+		}
+	}
+
+	sub.Metadata.MissingImg2ImgInput = len(sub.Metadata.Img2ImgInputs) == 0
+}
+
+// img2imgRequests returns the JSON parameters that decode to an [entities.ImageToImageRequest] with init_images.
+func img2imgRequests(sub *db.Submission) []db.GenerationInfo {
+	var requests []db.GenerationInfo
+	for _, chunks := range sub.Metadata.Params {
+		for _, blob := range chunks {
+			if !strings.Contains(blob, `"init_images"`) {
+				continue
+			}
+			var request entities.ImageToImageRequest
+			if err := json.Unmarshal([]byte(blob), &request); err != nil || len(request.InitImages) == 0 {
+				continue
+			}
+			info := db.GenerationInfo{Generator: sub.Metadata.Generator, Img2Img: &request}
+			if request.OverrideSettings.SDModelCheckpoint != nil {
+				info.Model = *request.OverrideSettings.SDModelCheckpoint
+			}
+			requests = append(requests, info)
+		}
+	}
+	return requests
+}
+
+// initImageMatches reports whether an init_images reference is page.
+// References are either a file name, or base64 image data that must be the same size as the page.
+func initImageMatches(reference string, page api.File) bool {
+	if _, data, ok := strings.Cut(reference, ";base64,"); ok {
+		reference = data
+	} else if len(reference) < 256 {
+		name := path.Base(strings.ReplaceAll(reference, `\`, "/"))
+		return strings.EqualFold(stem(name), stem(page.FileName))
+	}
+
+	config, _, err := image.DecodeConfig(base64.NewDecoder(base64.StdEncoding, strings.NewReader(reference)))
+	if err != nil {
+		return false
+	}
+	return int64(config.Width) == int64(page.FullSizeX) && int64(config.Height) == int64(page.FullSizeY)
+}
+
+func stem(name string) string {
+	return strings.TrimSuffix(name, path.Ext(name))
+}
+
+// generatedPages returns the pages the objects were read from, or the first page if they came from text files.
+func generatedPages(sub *db.Submission, pages []api.File) []api.File {
+	var outputs []api.File
+	for _, page := range pages {
+		for name := range sub.Metadata.Objects {
+			if name == page.FileName || strings.HasPrefix(name, page.FileName+" (page ") {
+				outputs = append(outputs, page)
+				break
+			}
+		}
+	}
+	if len(outputs) == 0 && len(pages) > 0 {
+		outputs = append(outputs, pages[0])
+	}
+	return outputs
+}
+
+// similarAspect reports whether page has about the same aspect ratio as width by height.
+// Pages without dimensions are given the benefit of the doubt.
+func similarAspect(page api.File, width, height int64) bool {
+	if page.FullSizeX == 0 || page.FullSizeY == 0 || width == 0 || height == 0 {
+		return true
+	}
+	aspect := float64(page.FullSizeX) / float64(page.FullSizeY)
+	return math.Abs(aspect-float64(width)/float64(height)) <= maxAspectDifference*aspect
+}
+
+func addInput(sub *db.Submission, name string) {
+	if !slices.Contains(sub.Metadata.Img2ImgInputs, name) {
+		sub.Metadata.Img2ImgInputs = append(sub.Metadata.Img2ImgInputs, name)
+	}
+}
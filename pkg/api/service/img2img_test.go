@@ -0,0 +1,112 @@
+package service
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/png"
+	"slices"
+	"testing"
+
+	"github.com/ellypaws/inkbunny-sd/entities"
+	"github.com/ellypaws/inkbunny-sd/utils"
+	"github.com/ellypaws/inkbunny/api"
+
+	"github.com/ellypaws/inkbunny-app/pkg/db"
+)
+
+func imagePage(name string, width, height int64) db.File {
+	return db.File{File: api.File{FileName: name, MimeType: MIMEImagePNG, FullSizeX: api.IntString(width), FullSizeY: api.IntString(height)}}
+}
+
+func TestCheckImg2ImgInput(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 64, 96))); err != nil {
+		t.Fatal(err)
+	}
+	initImage := base64.StdEncoding.EncodeToString(buf.Bytes())
+
+	tests := []struct {
+		name       string
+		submission db.Submission
+		missing    bool
+		inputs     []string
+	}{
+		{
+			name: "not img2img",
+			submission: db.Submission{
+				Files:    []db.File{imagePage("out.png", 512, 768)},
+				Metadata: db.Metadata{AISubmission: true},
+			},
+		},
+		{
+			name: "hires fix",
+			submission: db.Submission{
+				Files: []db.File{imagePage("out.png", 1024, 1536)},
+				Metadata: db.Metadata{AISubmission: true, Objects: map[string]entities.TextToImageRequest{
+					"out.png (page 1)": {DenoisingStrength: 0.4, EnableHr: true, HrScale: 2},
+				}},
+			},
+		},
+		{
+			name: "tagged without input",
+			submission: db.Submission{
+				Files:    []db.File{imagePage("out.png", 512, 768)},
+				Metadata: db.Metadata{AISubmission: true, Img2Img: true},
+			},
+			missing: true,
+		},
+		{
+			name: "sketch with the same aspect",
+			submission: db.Submission{
+				Files: []db.File{imagePage("out.png", 1024, 1536), imagePage("sketch.jpg", 800, 1200)},
+				Metadata: db.Metadata{AISubmission: true, Objects: map[string]entities.TextToImageRequest{
+					"out.png (page 1)": {DenoisingStrength: 0.6},
+				}},
+			},
+			inputs: []string{"sketch.jpg"},
+		},
+		{
+			name: "unrelated page",
+			submission: db.Submission{
+				Files: []db.File{imagePage("out.png", 1024, 1536), imagePage("banner.png", 1500, 500)},
+				Metadata: db.Metadata{AISubmission: true, Objects: map[string]entities.TextToImageRequest{
+					"out.png (page 1)": {DenoisingStrength: 0.6},
+				}},
+			},
+			missing: true,
+		},
+		{
+			name: "init image by name",
+			submission: db.Submission{
+				Files: []db.File{imagePage("out.png", 1024, 1536), imagePage("lines.png", 1500, 500), imagePage("base.png", 1500, 500)},
+				Metadata: db.Metadata{AISubmission: true, Params: utils.Params{
+					"params.json": {"json": `{"prompt":"a cat","denoising_strength":0.5,"init_images":["C:\\inputs\\base.webp"]}`},
+				}},
+			},
+			inputs: []string{"base.png"},
+		},
+		{
+			name: "embedded init image",
+			submission: db.Submission{
+				Files: []db.File{imagePage("out.png", 128, 192), imagePage("input.png", 64, 96)},
+				Metadata: db.Metadata{AISubmission: true, Params: utils.Params{
+					"params.json": {"json": fmt.Sprintf(`{"prompt":"a cat","init_images":["data:image/png;base64,%s"]}`, initImage)},
+				}},
+			},
+			inputs: []string{"input.png"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkImg2ImgInput(&tt.submission)
+			if got := tt.submission.Metadata.MissingImg2ImgInput; got != tt.missing {
+				t.Errorf("MissingImg2ImgInput = %v, want %v", got, tt.missing)
+			}
+			if got := tt.submission.Metadata.Img2ImgInputs; !slices.Equal(got, tt.inputs) {
+				t.Errorf("Img2ImgInputs = %v, want %v", got, tt.inputs)
+			}
+		})
+	}
+}
@@ -16,7 +16,7 @@ import (
 	sd "github.com/ellypaws/inkbunny-sd/stable_diffusion"
 )
 
-func Inference(c echo.Context, object map[string]entities.TextToImageRequest, host *sd.Host, database *db.Sqlite) (map[string]entities.TextToImageResponse, error) {
+func Inference(c echo.Context, object map[string]entities.TextToImageRequest, host *sd.Host, database db.Store) (map[string]entities.TextToImageResponse, error) {
 	var responses map[string]entities.TextToImageResponse
 	cacheToUse := cache.SwitchCache(c)
 	for key, request := range object {
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"maps"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/ellypaws/inkbunny-sd/entities"
+
+	"github.com/ellypaws/inkbunny-app/pkg/db"
+)
+
+// toolKeywords are the keywords suggested for each generator.
+// Generators missing here, like the private tools, are suggested by their own name.
+var toolKeywords = map[string]string{
+	"comfy_ui":         "comfyui",
+	"comfy_ui_api":     "comfyui",
+	"invoke_ai":        "invokeai",
+	"easy_diffusion":   "easy_diffusion",
+	db.StableDiffusion: "stable_diffusion",
+}
+
+const (
+	aiGeneratedKeyword = "ai_generated"
+	aiAssistedKeyword  = "ai_assisted"
+	img2imgKeyword     = "img2img"
+)
+
+// checkKeywords compares the keywords of the submission with the tool, checkpoints and img2img use found in its objects.
+// It sets MissingToolTags, MissingModelTags and SuggestedKeywords with the keywords to add.
+// MissingTags is also set when the submission is tagged with neither ai_generated nor ai_assisted.
+func checkKeywords(sub *db.Submission, database db.Store) {
+	sub.Metadata.MissingToolTags = nil
+	sub.Metadata.MissingModelTags = nil
+	sub.Metadata.SuggestedKeywords = nil
+	if !sub.Metadata.AISubmission {
+		return
+	}
+
+	tagged := make([]string, len(sub.Keywords))
+	for i, keyword := range sub.Keywords {
+		tagged[i] = compactKeyword(keyword.KeywordName)
+	}
+	missing := func(keyword string) bool {
+		keyword = compactKeyword(keyword)
+		return keyword != "" && !slices.ContainsFunc(tagged, func(tag string) bool {
+			return strings.HasPrefix(tag, keyword)
+		})
+	}
+
+	var img2img bool
+	for _, obj := range sub.Metadata.Objects {
+		if usedImg2Img(obj) {
+			img2img = true
+		}
+	}
+
+	if !sub.Metadata.Generated && !sub.Metadata.Assisted {
+		sub.Metadata.MissingTags = true
+		if img2img {
+			sub.Metadata.SuggestedKeywords = append(sub.Metadata.SuggestedKeywords, aiAssistedKeyword)
+		} else {
+			sub.Metadata.SuggestedKeywords = append(sub.Metadata.SuggestedKeywords, aiGeneratedKeyword)
+		}
+	}
+
+	if len(sub.Metadata.Objects) == 0 {
+		return
+	}
+
+	var tools []string
+	generator := strings.ToLower(sub.Metadata.Generator)
+	if generator == "" {
+		// A1111 parameters are the only objects parsed without setting a generator
+		generator = db.StableDiffusion
+	}
+	if keyword, ok := toolKeywords[generator]; ok {
+		tools = append(tools, keyword)
+	} else {
+		tools = append(tools, keywordFor(generator))
+	}
+	if img2img {
+		tools = append(tools, img2imgKeyword)
+	}
+	for _, keyword := range tools {
+		if missing(keyword) && !slices.Contains(sub.Metadata.MissingToolTags, keyword) {
+			sub.Metadata.MissingToolTags = append(sub.Metadata.MissingToolTags, keyword)
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(sub.Metadata.Objects)) {
+		keyword := checkpointKeyword(sub.Metadata.Objects[name], database)
+		if missing(keyword) && !slices.Contains(sub.Metadata.MissingModelTags, keyword) {
+			sub.Metadata.MissingModelTags = append(sub.Metadata.MissingModelTags, keyword)
+		}
+	}
+
+	sub.Metadata.SuggestedKeywords = append(sub.Metadata.SuggestedKeywords, sub.Metadata.MissingToolTags...)
+	sub.Metadata.SuggestedKeywords = append(sub.Metadata.SuggestedKeywords, sub.Metadata.MissingModelTags...)
+}
+
+// usedImg2Img reports whether obj was generated from an input image.
+// A denoising strength is also recorded for the hires fix, so it only counts without one.
+func usedImg2Img(obj entities.TextToImageRequest) bool {
+	return obj.DenoisingStrength > 0 && obj.DenoisingStrength < 1 &&
+		!obj.EnableHr && obj.HrScale == 0 && obj.HrUpscaler == ""
+}
+
+// checkpointKeyword returns the keyword for the checkpoint of obj, named by the object or by the models table.
+func checkpointKeyword(obj entities.TextToImageRequest, database db.Store) string {
+	var names []string
+	if obj.OverrideSettings.SDModelCheckpoint != nil {
+		names = append(names, *obj.OverrideSettings.SDModelCheckpoint)
+	}
+	if hash := checkpointHash(obj.OverrideSettings.SDCheckpointHash); hash != "" && database != nil {
+		// models recorded from CivitAI are the version name followed by the file name, which is more telling
+		for _, name := range slices.Backward(database.ModelNamesFromHash(hash)) {
+			names = append(names, name)
+		}
+	}
+	for _, name := range names {
+		if keyword := modelKeyword(name); keyword != "" {
+			return keyword
+		}
+	}
+	return ""
+}
+
+// modelVersion matches the version suffix of a model name, e.g. "_v44" in "yiffymix_v44"
+var modelVersion = regexp.MustCompile(`(?i)(?:[\s_.-]+v?|v)\d.*$`)
+
+// modelKeyword returns the keyword for a checkpoint name, dropping its path, hash, extension and version.
+// e.g. "models/yiffymix_v44.safetensors [1a2b3c4d]" is tagged as "yiffymix".
+func modelKeyword(name string) string {
+	name, _, _ = strings.Cut(name, " [")
+	name = name[strings.LastIndexAny(name, `/\`)+1:]
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".safetensors", ".ckpt", ".pt", ".pth", ".bin", ".gguf":
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	return keywordFor(modelVersion.ReplaceAllString(name, ""))
+}
+
+var nonKeyword = regexp.MustCompile(`[^a-z0-9]+`)
+
+// keywordFor returns name as an Inkbunny keyword, lowercase with words joined by underscores.
+func keywordFor(name string) string {
+	return strings.Trim(nonKeyword.ReplaceAllString(strings.ToLower(name), "_"), "_")
+}
+
+// compactKeyword drops the separators of a keyword, so "comfy ui", "comfy_ui" and "comfyui" compare equal.
+func compactKeyword(keyword string) string {
+	return nonKeyword.ReplaceAllString(strings.ToLower(keyword), "")
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/ellypaws/inkbunny-sd/entities"
+	"github.com/ellypaws/inkbunny/api"
+
+	"github.com/ellypaws/inkbunny-app/pkg/db"
+)
+
+func TestModelKeyword(t *testing.T) {
+	tests := map[string]string{
+		"yiffymix_v44": "yiffymix",
+		"models/yiffymix_v44.safetensors [1a2b3c4d]":  "yiffymix",
+		`C:\sd\furtasticv20_furtasticv20.safetensors`: "furtastic",
+		"ponyDiffusionV6XL":                           "ponydiffusion",
+		"indigoFurryMix_v105Hybrid":                   "indigofurrymix",
+		"sd_xl_base_1.0":                              "sd_xl_base",
+		"e621_mix":                                    "e621_mix",
+		"v4.4":                                        "",
+	}
+	for name, want := range tests {
+		if got := modelKeyword(name); got != want {
+			t.Errorf("modelKeyword(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestCheckKeywords(t *testing.T) {
+	checkpoint := "yiffymix_v44.safetensors [1a2b3c4d]"
+	tests := []struct {
+		name       string
+		submission db.Submission
+		database   db.Store
+		tools      []string
+		models     []string
+		suggested  []string
+	}{
+		{
+			name: "tagged",
+			submission: db.Submission{
+				Keywords: []api.Keyword{{KeywordName: "ai generated"}, {KeywordName: "comfy ui"}, {KeywordName: "yiffymix 4.4"}},
+				Metadata: db.Metadata{
+					AISubmission: true,
+					Generated:    true,
+					Generator:    "comfy_ui",
+					Objects: map[string]entities.TextToImageRequest{
+						"a.json": {OverrideSettings: entities.OverrideSettings{SDModelCheckpoint: &checkpoint}},
+					},
+				},
+			},
+		},
+		{
+			name: "missing",
+			submission: db.Submission{
+				Keywords: []api.Keyword{{KeywordName: "stable diffusion"}},
+				Metadata: db.Metadata{
+					AISubmission: true,
+					Objects: map[string]entities.TextToImageRequest{
+						"a.txt": {DenoisingStrength: 0.6, OverrideSettings: entities.OverrideSettings{SDModelCheckpoint: &checkpoint}},
+						"b.txt": {OverrideSettings: entities.OverrideSettings{SDCheckpointHash: "abcdef0123456789"}},
+					},
+				},
+			},
+			database:  modelStore{models: db.ModelHashes{"abcdef0123": {"v2.0", "ponyDiffusionV6XL.safetensors"}}},
+			tools:     []string{"img2img"},
+			models:    []string{"yiffymix", "ponydiffusion"},
+			suggested: []string{"ai_assisted", "img2img", "yiffymix", "ponydiffusion"},
+		},
+		{
+			name: "private tool",
+			submission: db.Submission{
+				Keywords: []api.Keyword{{KeywordName: "ai generated"}},
+				Metadata: db.Metadata{
+					AISubmission: true,
+					Generated:    true,
+					Generator:    "NovelAI",
+					Objects:      map[string]entities.TextToImageRequest{"a.png (page 1)": {Prompt: "a cat"}},
+				},
+			},
+			tools:     []string{"novelai"},
+			suggested: []string{"novelai"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkKeywords(&tt.submission, tt.database)
+			metadata := tt.submission.Metadata
+			if !slices.Equal(metadata.MissingToolTags, tt.tools) {
+				t.Errorf("MissingToolTags = %v, want %v", metadata.MissingToolTags, tt.tools)
+			}
+			if !slices.Equal(metadata.MissingModelTags, tt.models) {
+				t.Errorf("MissingModelTags = %v, want %v", metadata.MissingModelTags, tt.models)
+			}
+			if !slices.Equal(metadata.SuggestedKeywords, tt.suggested) {
+				t.Errorf("SuggestedKeywords = %v, want %v", metadata.SuggestedKeywords, tt.suggested)
+			}
+		})
+	}
+}
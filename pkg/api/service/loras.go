@@ -14,7 +14,7 @@ import (
 	sd "github.com/ellypaws/inkbunny-sd/stable_diffusion"
 )
 
-func QueryHost(c echo.Context, cacheToUse cache.Cache, host *sd.Host, database *db.Sqlite, hash string) (db.ModelHashes, error) {
+func QueryHost(c echo.Context, cacheToUse cache.Cache, host *sd.Host, database db.Store, hash string) (db.ModelHashes, error) {
 	var knownModels []entities.Lora
 	knownLorasKey := fmt.Sprintf("%v:loras", echo.MIMEApplicationJSON)
 	item, err := cacheToUse.Get(knownLorasKey)
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"errors"
+	"slices"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/ellypaws/inkbunny-app/pkg/api/cache"
+	"github.com/ellypaws/inkbunny-app/pkg/api/civitai"
+	"github.com/ellypaws/inkbunny-app/pkg/crashy"
+	"github.com/ellypaws/inkbunny-app/pkg/db"
+)
+
+// resolveModels looks up every LoRA and checkpoint hash of the parsed objects in the models table,
+// then on CivitAI for the ones missing there. Public models found on CivitAI are recorded in database.
+// Hashes no public source knows set PrivateLora and PrivateModel and are listed in PrivateLoras and PrivateModels.
+// It returns false if CivitAI couldn't be reached, in which case the hashes left are not flagged.
+func resolveModels(c echo.Context, sub *db.Submission, cacheToUse cache.Cache, database db.Store) bool {
+	loras := make(map[string]bool)
+	checkpoints := make(map[string]bool)
+	for _, obj := range sub.Metadata.Objects {
+		for hash := range obj.LoraHashes {
+			if hash != "" {
+				loras[hash] = true
+			}
+		}
+		if hash := checkpointHash(obj.OverrideSettings.SDCheckpointHash); hash != "" {
+			checkpoints[hash] = true
+		}
+	}
+
+	resolver := modelResolver{c: c, cache: cacheToUse, database: database}
+	sub.Metadata.PrivateLoras = resolver.unresolved(loras)
+	sub.Metadata.PrivateModels = resolver.unresolved(checkpoints)
+	sub.Metadata.PrivateLora = len(sub.Metadata.PrivateLoras) > 0
+	sub.Metadata.PrivateModel = len(sub.Metadata.PrivateModels) > 0
+
+	return resolver.online()
+}
+
+// checkpointHash returns the AutoV2 hash CivitAI knows checkpoints by, the first 10 characters of the SHA256.
+func checkpointHash(hash string) string {
+	if len(hash) > 10 {
+		return hash[:10]
+	}
+	return hash
+}
+
+type modelResolver struct {
+	c        echo.Context
+	cache    cache.Cache
+	database db.Store
+
+	alive *bool // whether CivitAI is reachable, only checked once a lookup fails
+}
+
+// unresolved returns the sorted hashes that are neither in the models table nor on CivitAI.
+func (r *modelResolver) unresolved(hashes map[string]bool) []string {
+	var private []string
+	for hash := range hashes {
+		if r.database != nil && len(r.database.ModelNamesFromHash(hash)) > 0 {
+			continue
+		}
+
+		models, model, err := QueryCivitAI(r.c, r.cache, hash)
+		var response crashy.ErrorResponse
+		if errors.As(err, &response) {
+			if found, ok := response.Debug.(*civitai.CivitAIModel); ok {
+				// the model was found, but none of its files had a hash of the same kind
+				model, err = found, nil
+			}
+		}
+		if err != nil {
+			if r.reachable() {
+				private = append(private, hash)
+			}
+			continue
+		}
+
+		if models == nil && model != nil {
+			models = db.ModelHashes{hash: []string{model.Name}}
+		}
+		if r.database == nil {
+			continue
+		}
+		if err := r.database.UpsertModel(models); err != nil {
+			r.c.Logger().Errorf("error recording model %s: %v", hash, err)
+		}
+	}
+	slices.Sort(private)
+	return private
+}
+
+// reachable checks once whether CivitAI is up, telling unknown hashes apart from failed lookups.
+func (r *modelResolver) reachable() bool {
+	if r.alive == nil {
+		alive := civitai.As(civitai.DefaultHost).Alive()
+		if !alive {
+			r.c.Logger().Warnf("CivitAI is unreachable, not flagging unresolved models")
+		}
+		r.alive = &alive
+	}
+	return *r.alive
+}
+
+// online reports whether CivitAI was reachable, assuming it is if no lookup failed.
+func (r *modelResolver) online() bool {
+	return r.alive == nil || *r.alive
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ellypaws/inkbunny-sd/entities"
+	"github.com/labstack/echo/v4"
+
+	"github.com/ellypaws/inkbunny-app/pkg/api/cache"
+	"github.com/ellypaws/inkbunny-app/pkg/api/civitai"
+	"github.com/ellypaws/inkbunny-app/pkg/db"
+)
+
+// civitAIStandIn serves models as CivitAI would, keyed by their AutoV3 hash.
+func civitAIStandIn(t *testing.T, models map[string]civitai.CivitAIModel) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			return
+		}
+		model, ok := models[strings.TrimPrefix(r.URL.Path, "/api/v1/model-versions/by-hash/")]
+		if !ok {
+			http.Error(w, `{"error":"Model not found"}`, http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(model)
+	}))
+	t.Cleanup(server.Close)
+
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := civitai.DefaultHost
+	civitai.DefaultHost = (*civitai.Host)(u)
+	t.Cleanup(func() { civitai.DefaultHost = host })
+}
+
+// modelStore keeps the models table in memory, any other method of db.Store panics.
+type modelStore struct {
+	db.Store
+	models db.ModelHashes
+}
+
+func (s modelStore) ModelNamesFromHash(hash string) []string { return s.models[hash] }
+
+func (s modelStore) UpsertModel(models db.ModelHashes) error {
+	for hash, names := range models {
+		s.models[hash] = names
+	}
+	return nil
+}
+
+func TestResolveModels(t *testing.T) {
+	civitAIStandIn(t, map[string]civitai.CivitAIModel{
+		"0123456789ab": {Name: "Public", Files: []civitai.File{{Name: "public.safetensors", Primary: true, Hashes: civitai.Hashes{AutoV3: "0123456789AB"}}}},
+	})
+
+	database := modelStore{models: db.ModelHashes{"fedcba987654": {"recorded"}}}
+
+	sub := db.Submission{Metadata: db.Metadata{Objects: map[string]entities.TextToImageRequest{
+		"a.txt": {
+			LoraHashes:       map[string]string{"0123456789ab": "public", "fedcba987654": "recorded", "deadbeefdead": "private"},
+			OverrideSettings: entities.OverrideSettings{SDCheckpointHash: "1111111111" + strings.Repeat("a", 54)},
+		},
+	}}}
+
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	if !resolveModels(c, &sub, cache.TextCache, database) {
+		t.Fatal("resolveModels() reported CivitAI as unreachable")
+	}
+
+	if want := []string{"deadbeefdead"}; !sub.Metadata.PrivateLora || !slices.Equal(sub.Metadata.PrivateLoras, want) {
+		t.Errorf("PrivateLoras = %v, want %v", sub.Metadata.PrivateLoras, want)
+	}
+	if want := []string{"1111111111"}; !sub.Metadata.PrivateModel || !slices.Equal(sub.Metadata.PrivateModels, want) {
+		t.Errorf("PrivateModels = %v, want %v", sub.Metadata.PrivateModels, want)
+	}
+	if got, want := database.ModelNamesFromHash("0123456789ab"), []string{"Public", "public.safetensors"}; !slices.Equal(got, want) {
+		t.Errorf("recorded %v, want %v", got, want)
+	}
+	if got := database.ModelNamesFromHash("deadbeefdead"); got != nil {
+		t.Errorf("recorded private lora as %v", got)
+	}
+}
+
+func TestResolveModelsUnreachable(t *testing.T) {
+	civitAIStandIn(t, nil)
+	civitai.DefaultHost.Host = "127.0.0.1:1"
+
+	sub := db.Submission{Metadata: db.Metadata{Objects: map[string]entities.TextToImageRequest{
+		"a.txt": {LoraHashes: map[string]string{"deadbeefdead": "private"}},
+	}}}
+
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	if resolveModels(c, &sub, cache.TextCache, nil) {
+		t.Error("resolveModels() reported CivitAI as reachable")
+	}
+	if sub.Metadata.PrivateLora || len(sub.Metadata.PrivateLoras) > 0 {
+		t.Errorf("PrivateLoras = %v, want none", sub.Metadata.PrivateLoras)
+	}
+}
@@ -0,0 +1,287 @@
+package service
+
+import (
+	"cmp"
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ellypaws/inkbunny-sd/entities"
+
+	"github.com/ellypaws/inkbunny-app/pkg/db"
+)
+
+// normalizedPrompt is a prompt rewritten as a comma separated list of lowercase tags.
+// offsets holds the byte in the original prompt each byte of text came from.
+type normalizedPrompt struct {
+	original string
+	text     string
+	offsets  []int
+}
+
+// normalizePrompt rewrites prompt for name matching, so that "(by_some_body:1.3)",
+// "[some body|other]" and "some_body_\(artist\)" all contain "some body".
+// Brackets, alternations, A1111/ComfyUI weights and escapes become separators and underscores become spaces.
+// Unlike [NormalizePrompt] it keeps the offsets of every byte so matches can be located in the original prompt.
+func normalizePrompt(prompt string) normalizedPrompt {
+	var (
+		sb           strings.Builder
+		offsets      []int
+		separator    bool
+		space        bool
+		separatorSet = "()[]{}<>|,;\n"
+	)
+	write := func(s string, at int) {
+		sb.WriteString(s)
+		for range len(s) {
+			offsets = append(offsets, at)
+		}
+	}
+
+	for i := 0; i < len(prompt); {
+		r, size := utf8.DecodeRuneInString(prompt[i:])
+		switch {
+		case r == '\\':
+			// escaped brackets are literal in A1111, only the bracket itself matters here
+		case r == ':':
+			// weights like (artist:1.3) or <lora:name:0.8>
+			separator = true
+			for i+size < len(prompt) && strings.IndexByte(" 0123456789.-", prompt[i+size]) >= 0 {
+				size++
+			}
+		case strings.ContainsRune(separatorSet, r):
+			separator = true
+		case r == '_' || unicode.IsSpace(r):
+			space = true
+		default:
+			if sb.Len() > 0 {
+				if separator {
+					write(", ", i)
+				} else if space {
+					write(" ", i)
+				}
+			}
+			separator, space = false, false
+			write(strings.ToLower(string(r)), i)
+		}
+		i += size
+	}
+
+	return normalizedPrompt{original: prompt, text: sb.String(), offsets: offsets}
+}
+
+// span returns the byte offsets in the original prompt of text[start:end].
+func (p normalizedPrompt) span(start, end int) (int, int) {
+	last := p.offsets[end-1]
+	_, size := utf8.DecodeRuneInString(p.original[last:])
+	return p.offsets[start], last + size
+}
+
+// namePattern matches a name and its aliases in a normalized prompt.
+type namePattern struct {
+	re    *regexp.Regexp
+	names map[string]string // normalized name to the name or alias
+}
+
+func newNamePattern(names ...string) namePattern {
+	pattern := namePattern{names: make(map[string]string)}
+
+	var alternatives []string
+	for _, name := range names {
+		normalized := normalizePrompt(name).text
+		if normalized == "" {
+			continue
+		}
+		if _, ok := pattern.names[normalized]; ok {
+			continue
+		}
+		pattern.names[normalized] = name
+
+		alternative := regexp.QuoteMeta(normalized)
+		if isWordByte(normalized[0]) {
+			alternative = `\b` + alternative
+		}
+		if isWordByte(normalized[len(normalized)-1]) {
+			alternative += `\b`
+		}
+		alternatives = append(alternatives, alternative)
+	}
+	if len(alternatives) == 0 {
+		return pattern
+	}
+
+	// prefer the longest name, "some body" over "some"
+	slices.SortStableFunc(alternatives, func(a, b string) int { return cmp.Compare(len(b), len(a)) })
+	pattern.re, _ = regexp.Compile(strings.Join(alternatives, "|"))
+	return pattern
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || '0' <= b && b <= '9' || 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z'
+}
+
+// find returns the matches of the pattern in prompt, with offsets into the original prompt.
+func (p namePattern) find(object string, prompt normalizedPrompt, negative bool) []db.PromptMatch {
+	if p.re == nil {
+		return nil
+	}
+	var matches []db.PromptMatch
+	for _, loc := range p.re.FindAllStringIndex(prompt.text, -1) {
+		start, end := prompt.span(loc[0], loc[1])
+		matches = append(matches, db.PromptMatch{
+			Alias:    p.names[prompt.text[loc[0]:loc[1]]],
+			Object:   object,
+			Negative: negative,
+			Start:    start,
+			End:      end,
+		})
+	}
+	return matches
+}
+
+// findAll returns where the pattern is found in the prompts and negative prompts of objects.
+func (p namePattern) findAll(objects map[string]entities.TextToImageRequest) []db.PromptMatch {
+	var matches []db.PromptMatch
+	for name, obj := range objects {
+		matches = append(matches, p.find(name, normalizePrompt(obj.Prompt), false)...)
+		matches = append(matches, p.find(name, normalizePrompt(obj.NegativePrompt), true)...)
+	}
+	sortPromptMatches(matches)
+	return matches
+}
+
+func sortPromptMatches(matches []db.PromptMatch) {
+	slices.SortFunc(matches, func(a, b db.PromptMatch) int {
+		if c := cmp.Compare(a.Object, b.Object); c != 0 {
+			return c
+		}
+		if a.Negative != b.Negative {
+			if a.Negative {
+				return 1
+			}
+			return -1
+		}
+		return cmp.Compare(a.Start, b.Start)
+	})
+}
+
+// nameMatcher holds the compiled patterns of a list of names, in the same order.
+type nameMatcher struct {
+	version  uint64
+	patterns []namePattern
+}
+
+// nameMatchers keeps the last compiled nameMatcher, so patterns are only compiled once per version of a list.
+type nameMatchers struct {
+	mu   sync.Mutex
+	last *nameMatcher
+}
+
+// get returns the matcher for names, where each entry is a name followed by its aliases.
+// The last matcher is reused if none of the names changed.
+func (m *nameMatchers) get(names [][]string) *nameMatcher {
+	h := fnv.New64a()
+	for _, aliases := range names {
+		for _, alias := range aliases {
+			h.Write([]byte(alias))
+			h.Write([]byte{0})
+		}
+		h.Write([]byte{1})
+	}
+	version := h.Sum64()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.last != nil && m.last.version == version {
+		return m.last
+	}
+
+	matcher := &nameMatcher{version: version, patterns: make([]namePattern, len(names))}
+	for i, aliases := range names {
+		matcher.patterns[i] = newNamePattern(aliases...)
+	}
+	m.last = matcher
+	return matcher
+}
+
+// promptHighlight is a match to emphasize in a ticket message.
+// Account is the username to link, or empty if the name isn't registered.
+type promptHighlight struct {
+	db.PromptMatch
+	Account string
+}
+
+// highlightPrompt wraps the highlights in the prompt of object with BBCode.
+// It returns false if none of the highlights are in that prompt.
+func highlightPrompt(prompt, object string, negative bool, highlights []promptHighlight) (string, bool) {
+	var spans []promptHighlight
+	for _, h := range highlights {
+		if h.Object == object && h.Negative == negative && h.End <= len(prompt) {
+			spans = append(spans, h)
+		}
+	}
+	if len(spans) == 0 {
+		return prompt, false
+	}
+	slices.SortFunc(spans, func(a, b promptHighlight) int { return cmp.Compare(a.Start, b.Start) })
+
+	var (
+		sb   strings.Builder
+		last int
+	)
+	for _, s := range spans {
+		if s.Start < last {
+			continue
+		}
+		sb.WriteString(prompt[last:s.Start])
+		text := prompt[s.Start:s.End]
+		switch {
+		case s.Account == "":
+			sb.WriteString(fmt.Sprintf("[b] >>> [color=#F78C6C][u]%s[/u][/color] <<< [/b]", text))
+		case strings.EqualFold(s.Alias, s.Account):
+			sb.WriteString(fmt.Sprintf("[b]>>> [u][name]%s[/name][/u] <<<[/b]", text))
+		default:
+			// an alias or a character, link the account instead of the prompted name
+			sb.WriteString(fmt.Sprintf("[b]>>> [u]%s[/u] ([name]%s[/name]) <<<[/b]", text, s.Account))
+		}
+		last = s.End
+	}
+	sb.WriteString(prompt[last:])
+	return sb.String(), true
+}
+
+// writePromptHighlights quotes every prompt containing one of the highlights, with the file it came from.
+func writePromptHighlights(sb *ChunkedWriter, sub *db.Submission, highlights []promptHighlight) {
+	highlight := make(map[string]string)
+	for name, obj := range sub.Metadata.Objects {
+		if prompt, ok := highlightPrompt(obj.Prompt, name, false, highlights); ok {
+			highlight[name] = prompt
+		}
+		if negative, ok := highlightPrompt(obj.NegativePrompt, name, true, highlights); ok {
+			highlight[name] = fmt.Sprintf("%s\n(Found in negative prompt)\n%s", highlight[name], negative)
+		}
+	}
+
+	for title, prompt := range highlight {
+		var file *db.File
+		if slices.ContainsFunc(sub.Files, func(f db.File) bool {
+			if strings.HasPrefix(title, f.File.FileName) {
+				file = &f
+				return true
+			}
+			return false
+		}) {
+			sb.WriteString(fmt.Sprintf("\nFile %d: [url=%s]%s[/url] ([url=https://inkbunny.net/submissionsviewall.php?text=%s&md5=yes&mode=search]%s[/url]) https://inkbunny.net/s/%s",
+				file.File.SubmissionFileOrder+1, file.File.FileURLFull, file.File.FileName, file.File.FullFileMD5, file.File.FullFileMD5, file.File.SubmissionID))
+		} else {
+			sb.WriteString(fmt.Sprintf("\nFrom description: [url=%s]%s[/url] %s", sub.URL, title, sub.URL))
+		}
+		sb.WriteString(fmt.Sprintf("\n[q=%s]%s[/q]", title, prompt))
+		sb.Split()
+	}
+}
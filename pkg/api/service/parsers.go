@@ -0,0 +1,226 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/ellypaws/inkbunny-sd/entities"
+	"github.com/ellypaws/inkbunny-sd/entities/comfyui"
+	"github.com/ellypaws/inkbunny-sd/utils"
+
+	"github.com/ellypaws/inkbunny-app/pkg/db"
+)
+
+// ParserKind is the stage of processParams a parser reads.
+type ParserKind string
+
+const (
+	ParserText        ParserKind = "text"        // text files that aren't a known JSON format
+	ParserJSON        ParserKind = "json"        // JSON files that none of the known formats could read
+	ParserDescription ParserKind = "description" // the description, when there are no parameter files
+)
+
+// Parser reads the parameters of a file, or of the description for ParserDescription.
+// Parse returns either the raw Params, which are converted to objects afterward, or the objects themselves.
+// Generator, if set, is recorded as the generator of the objects.
+type Parser struct {
+	Name      string                                                                                           `json:"name"`
+	Kind      ParserKind                                                                                       `json:"kind"`
+	Generator string                                                                                           `json:"generator,omitempty"`
+	Parse     func(text []byte, fileName string) (utils.Params, map[string]entities.TextToImageRequest, error) `json:"-"`
+}
+
+// The parsers used when no binding applies
+const (
+	defaultTextParser        = "common"
+	defaultDescriptionParser = "description"
+)
+
+var (
+	parsersMu sync.RWMutex
+	parsers   = make(map[string]Parser)
+)
+
+// RegisterParser adds parser to the registry under its name, replacing any parser with the same name.
+// Parsers are bound to submissions with [db.ParserBinding].
+func RegisterParser(parser Parser) {
+	parsersMu.Lock()
+	defer parsersMu.Unlock()
+	parsers[parser.Name] = parser
+}
+
+// LookupParser returns the parser registered under name.
+func LookupParser(name string) (Parser, bool) {
+	parsersMu.RLock()
+	defer parsersMu.RUnlock()
+	parser, ok := parsers[name]
+	return parser, ok
+}
+
+// Parsers returns every registered parser sorted by name.
+func Parsers() []Parser {
+	parsersMu.RLock()
+	defer parsersMu.RUnlock()
+	registered := make([]Parser, 0, len(parsers))
+	for _, name := range slices.Sorted(maps.Keys(parsers)) {
+		registered = append(registered, parsers[name])
+	}
+	return registered
+}
+
+// parserFor returns the first parser of kind bound to the file, or the fallback parser.
+// bindings are tried in order, see [ParserBindings].
+func parserFor(bindings []db.ParserBinding, kind ParserKind, userID int64, fileName string, content []byte, fallback string) (Parser, bool) {
+	for _, binding := range bindings {
+		parser, ok := LookupParser(binding.Parser)
+		if !ok || parser.Kind != kind {
+			continue
+		}
+		if binding.Applies(userID, fileName, content) {
+			return parser, true
+		}
+	}
+	return LookupParser(fallback)
+}
+
+// ParserRegistry lists the registered parsers and the bindings that pick them, in the order they are tried.
+// Definitions are the staff-written parsers, including the ones not activated yet.
+type ParserRegistry struct {
+	Parsers     []Parser              `json:"parsers"`
+	Bindings    []db.ParserBinding    `json:"bindings"`
+	Definitions []db.ParserDefinition `json:"definitions,omitempty"`
+}
+
+// ParserBindings returns the bindings stored in the database followed by the built-in ones.
+// Staff bindings are tried first, so they can override the built-in parser for an artist.
+func ParserBindings(database db.Store) []db.ParserBinding {
+	var bindings []db.ParserBinding
+	if database != nil {
+		bindings = database.AllParserBindings()
+	}
+	return append(bindings, defaultParserBindings...)
+}
+
+func userBinding(parser string, userID int64) db.ParserBinding {
+	return db.ParserBinding{Parser: parser, UserID: &userID}
+}
+
+// defaultParserBindings are the artists with standardized parameter files
+var defaultParserBindings = []db.ParserBinding{
+	userBinding("autosnep", utils.IDAutoSnep),
+	userBinding("druge", utils.IDDruge),
+	userBinding("aibean", utils.IDAIBean),
+	userBinding("artie", utils.IDArtieDragon),
+	userBinding("file_name", 1125540),
+	userBinding("fairygarden", utils.IDFairyGarden),
+	userBinding("cirn0", utils.IDCirn0),
+	userBinding("hornybunny", utils.IDHornybunny),
+	userBinding("methuzalach", utils.IDMethuzalach),
+	userBinding("soph", utils.IDSoph),
+	userBinding("sequential", utils.IDNastAI),
+	userBinding("cubfestai", 1247248),
+	userBinding("rnsdai", utils.IDRNSDAI),
+}
+
+// textParser returns a ParserText parser from a utils parser that reads the raw Params.
+func textParser(name string, parse func(text []byte, fileName string) (utils.Params, error)) Parser {
+	return Parser{
+		Name: name,
+		Kind: ParserText,
+		Parse: func(text []byte, fileName string) (utils.Params, map[string]entities.TextToImageRequest, error) {
+			params, err := parse(text, fileName)
+			return params, nil, err
+		},
+	}
+}
+
+// commonParser returns a ParserText parser for utils.Common with a preset for the artist's format.
+func commonParser(name string, preset func() func(*utils.Config)) Parser {
+	return textParser(name, func(text []byte, fileName string) (utils.Params, error) {
+		return utils.Common(utils.WithBytes(text), preset(), utils.WithFilename(fileName))
+	})
+}
+
+func baseConfig(text []byte, fileName string) func(*utils.Config) {
+	return utils.WithConfig(utils.Config{Text: string(text), Filename: fileName})
+}
+
+func init() {
+	for _, parser := range []Parser{
+		textParser(defaultTextParser, func(text []byte, fileName string) (utils.Params, error) {
+			return utils.Common(
+				utils.WithBytes(bytes.Join([][]byte{[]byte(fileName), text}, []byte("\n"))),
+				utils.WithKeyCondition(func(line string) bool { return strings.HasPrefix(line, fileName) }))
+		}),
+		textParser("autosnep", func(text []byte, fileName string) (utils.Params, error) {
+			return utils.AutoSnep(baseConfig(text, fileName))
+		}),
+		commonParser("druge", utils.UseDruge),
+		commonParser("aibean", utils.UseAIBean),
+		commonParser("artie", utils.UseArtie),
+		commonParser("fairygarden", utils.UseFairyGarden),
+		commonParser("hornybunny", utils.UseHornybunny),
+		commonParser("methuzalach", utils.UseMethuzalach),
+		textParser("file_name", func(text []byte, fileName string) (utils.Params, error) {
+			hasFileName := func(line string) bool { return strings.HasPrefix(line, "File Name") }
+			return utils.Common(baseConfig(text, fileName), utils.WithKeyCondition(hasFileName))
+		}),
+		textParser("cirn0", func(text []byte, fileName string) (utils.Params, error) {
+			return utils.Cirn0(baseConfig(text, fileName))
+		}),
+		textParser("sequential", func(text []byte, fileName string) (utils.Params, error) {
+			return utils.Sequential(baseConfig(text, fileName))
+		}),
+		{
+			Name: "soph",
+			Kind: ParserText,
+			Parse: func(text []byte, fileName string) (utils.Params, map[string]entities.TextToImageRequest, error) {
+				if utils.SophStartInvokeAI.Match(text) {
+					if objects, err := utils.Soph(baseConfig(text, fileName)); err == nil {
+						return nil, objects, nil
+					}
+				}
+				params, err := utils.Common(baseConfig(text, fileName), utils.UseSoph())
+				return params, nil, err
+			},
+		},
+		{
+			Name:      "cubfestai",
+			Kind:      ParserJSON,
+			Generator: "comfy_ui",
+			Parse: func(text []byte, fileName string) (utils.Params, map[string]entities.TextToImageRequest, error) {
+				cubFestAI, err := comfyui.UnmarshalCubFestAIDate(text)
+				if err != nil {
+					return nil, nil, fmt.Errorf("error parsing comfy ui (CubFestAI): %w", err)
+				}
+				objects := make(map[string]entities.TextToImageRequest, len(cubFestAI))
+				for key, value := range cubFestAI {
+					objects[key] = value.Convert()
+				}
+				return utils.Params{fileName: utils.PNGChunk{"comfy_ui": string(text)}}, objects, nil
+			},
+		},
+		{
+			Name: defaultDescriptionParser,
+			Kind: ParserDescription,
+			Parse: func(text []byte, title string) (utils.Params, map[string]entities.TextToImageRequest, error) {
+				heuristics, err := utils.DescriptionHeuristics(string(text))
+				return nil, map[string]entities.TextToImageRequest{title: heuristics}, err
+			},
+		},
+		{
+			Name: "rnsdai",
+			Kind: ParserDescription,
+			Parse: func(text []byte, title string) (utils.Params, map[string]entities.TextToImageRequest, error) {
+				heuristics, err := utils.RNSDAIHeuristics(string(text))
+				return nil, map[string]entities.TextToImageRequest{title: heuristics}, err
+			},
+		},
+	} {
+		RegisterParser(parser)
+	}
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/ellypaws/inkbunny-sd/utils"
+
+	"github.com/ellypaws/inkbunny-app/pkg/db"
+)
+
+func TestParserFor(t *testing.T) {
+	userID := int64(42)
+	staff := []db.ParserBinding{
+		{Parser: "sequential", UserID: &userID, FilePattern: `\.txt$`},
+		{Parser: "cirn0", ContentPattern: `^Batch \d+`},
+		{Parser: "rnsdai", UserID: &userID}, // a description parser, never picked for text files
+		{Parser: "missing", UserID: &userID},
+		userBinding("druge", utils.IDAutoSnep),
+	}
+	bindings := append(staff, defaultParserBindings...)
+
+	tests := []struct {
+		name     string
+		kind     ParserKind
+		userID   int64
+		fileName string
+		content  string
+		want     string
+	}{
+		{name: "bound user", kind: ParserText, userID: 42, fileName: "params.txt", want: "sequential"},
+		{name: "file pattern", kind: ParserText, userID: 42, fileName: "params.rtf", want: defaultTextParser},
+		{name: "content signature", kind: ParserText, userID: 7, fileName: "a.txt", content: "Batch 1\nSteps: 20", want: "cirn0"},
+		{name: "staff override", kind: ParserText, userID: utils.IDAutoSnep, fileName: "a.txt", want: "druge"},
+		{name: "built-in", kind: ParserText, userID: utils.IDCirn0, fileName: "a.txt", want: "cirn0"},
+		{name: "description", kind: ParserDescription, userID: 42, fileName: "title", want: "rnsdai"},
+		{name: "default description", kind: ParserDescription, userID: 7, fileName: "title", want: defaultDescriptionParser},
+		{name: "json", kind: ParserJSON, userID: 1247248, fileName: "a.json", want: "cubfestai"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parser, ok := parserFor(bindings, tt.kind, tt.userID, tt.fileName, []byte(tt.content), defaultParserFor(tt.kind))
+			if !ok {
+				t.Fatalf("parserFor() found no parser, want %s", tt.want)
+			}
+			if parser.Name != tt.want {
+				t.Errorf("parserFor() = %s, want %s", parser.Name, tt.want)
+			}
+		})
+	}
+
+	if parser, ok := parserFor(bindings, ParserJSON, 7, "a.json", nil, ""); ok {
+		t.Errorf("parserFor() = %s, want no JSON parser without a binding", parser.Name)
+	}
+}
+
+func defaultParserFor(kind ParserKind) string {
+	switch kind {
+	case ParserText:
+		return defaultTextParser
+	case ParserDescription:
+		return defaultDescriptionParser
+	}
+	return ""
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ellypaws/inkbunny-app/pkg/db"
+)
+
+// SubmissionQueue writes reviewed submissions to the database in the background,
+// so a review only has to hand the submission over instead of waiting for SQLite.
+type SubmissionQueue struct {
+	database db.Store
+	queue    chan queuedSubmission
+	done     chan struct{}
+
+	// mu guards closed, Push holds it for reading while sending so Close can't close the queue underneath it
+	mu     sync.RWMutex
+	closed bool
+}
+
+type queuedSubmission struct {
+	submission db.Submission
+	labels     []db.TicketLabel
+}
+
+// pushTimeout is how long Push waits for room in a full queue before dropping the submission.
+const pushTimeout = 5 * time.Second
+
+// NewSubmissionQueue starts a writer that stores up to size pending submissions.
+func NewSubmissionQueue(database db.Store, size int) *SubmissionQueue {
+	q := &SubmissionQueue{
+		database: database,
+		queue:    make(chan queuedSubmission, max(size, 1)),
+		done:     make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+// Push queues the submission and its labels to be stored.
+// If the queue is full it waits up to pushTimeout, then drops the submission as it does after Close.
+// The submission is stored again on its next review.
+func (q *SubmissionQueue) Push(submission db.Submission, labels []db.TicketLabel) {
+	if q == nil || q.database == nil {
+		return
+	}
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		log.Printf("warning: submission queue is closed, dropping submission %d", submission.ID)
+		return
+	}
+	item := queuedSubmission{submission: submission, labels: labels}
+	select {
+	case q.queue <- item:
+		return
+	default:
+	}
+
+	timer := time.NewTimer(pushTimeout)
+	defer timer.Stop()
+	select {
+	case q.queue <- item:
+	case <-timer.C:
+		log.Printf("warning: submission queue is full, dropping submission %d", submission.ID)
+	}
+}
+
+// Close waits for every queued submission to be written and stops the writer.
+// Submissions pushed after Close are dropped.
+func (q *SubmissionQueue) Close() {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.queue)
+	}
+	q.mu.Unlock()
+	<-q.done
+}
+
+func (q *SubmissionQueue) run() {
+	defer close(q.done)
+	for item := range q.queue {
+		q.store(item)
+	}
+}
+
+func (q *SubmissionQueue) store(item queuedSubmission) {
+	for _, obj := range item.submission.Metadata.Objects {
+		for hash, model := range obj.LoraHashes {
+			// private hashes stay out of the models table so they are flagged again on the next review
+			if slices.Contains(item.submission.Metadata.PrivateLoras, hash) {
+				continue
+			}
+			err := q.database.UpsertModel(db.ModelHashes{hash: []string{model}})
+			if err != nil {
+				log.Printf("error: inserting model %s: %v", hash, err)
+			}
+		}
+	}
+
+	err := q.database.StoreSubmission(item.submission, item.labels)
+	if err != nil {
+		log.Printf("error: storing submission %d: %v", item.submission.ID, err)
+	}
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/ellypaws/inkbunny-app/pkg/db"
+)
+
+// submissionStore counts the stored submissions, any other method of db.Store panics.
+type submissionStore struct {
+	db.Store
+	mu     sync.Mutex
+	stored map[int64]bool
+}
+
+func (s *submissionStore) StoreSubmission(submission db.Submission, _ []db.TicketLabel) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stored[submission.ID] = true
+	return nil
+}
+
+func TestSubmissionQueue(t *testing.T) {
+	database := &submissionStore{stored: make(map[int64]bool)}
+	q := NewSubmissionQueue(database, 1)
+	for id := range int64(10) {
+		q.Push(db.Submission{ID: id}, nil)
+	}
+	q.Close()
+
+	if len(database.stored) != 10 {
+		t.Errorf("expected every pushed submission to be stored before Close returns, got %d", len(database.stored))
+	}
+}
+
+func TestSubmissionQueueConcurrentClose(t *testing.T) {
+	database := &submissionStore{stored: make(map[int64]bool)}
+	q := NewSubmissionQueue(database, 1)
+
+	var wg sync.WaitGroup
+	for worker := range int64(8) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range int64(50) {
+				q.Push(db.Submission{ID: worker*50 + i}, nil)
+			}
+		}()
+	}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		q.Close()
+	}()
+	go func() {
+		defer wg.Done()
+		q.Close()
+	}()
+	wg.Wait()
+
+	q.Push(db.Submission{ID: -1}, nil)
+	q.Close()
+
+	database.mu.Lock()
+	defer database.mu.Unlock()
+	if database.stored[-1] {
+		t.Error("a submission pushed after Close was stored")
+	}
+}
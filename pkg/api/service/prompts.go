@@ -0,0 +1,176 @@
+package service
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// MaxImagesPerPrompt is the number of images the ACP allows to be posted with the same prompt.
+const MaxImagesPerPrompt = 6
+
+// PromptGroup is a set of images across a user's submissions that were generated with the same normalized prompt.
+// When grouped by seed range, MinSeed and MaxSeed are the bounds of the seeds in the group.
+type PromptGroup struct {
+	Prompt        string  `json:"prompt"`
+	MinSeed       int64   `json:"min_seed,omitempty"`
+	MaxSeed       int64   `json:"max_seed,omitempty"`
+	Images        int     `json:"images"`
+	SubmissionIDs []int64 `json:"submission_ids"`
+}
+
+var (
+	promptWeight  = regexp.MustCompile(`:\s*-?\d+(?:\.\d+)?\s*([)\]>])`)
+	promptBracket = regexp.MustCompile(`[()\[\]{}]`)
+	promptSpace   = regexp.MustCompile(`\s+`)
+)
+
+// NormalizePrompt reduces a prompt to a comparable form.
+// Casing, emphasis brackets, weights and whitespace around commas are ignored,
+// so "(masterpiece:1.2), Cat" and "masterpiece,  cat" are the same prompt.
+func NormalizePrompt(prompt string) string {
+	prompt = strings.ToLower(prompt)
+	prompt = strings.ReplaceAll(prompt, `\(`, "(")
+	prompt = strings.ReplaceAll(prompt, `\)`, ")")
+	prompt = promptWeight.ReplaceAllString(prompt, "$1")
+	prompt = promptBracket.ReplaceAllString(prompt, "")
+
+	tokens := strings.Split(prompt, ",")
+	out := tokens[:0]
+	for _, token := range tokens {
+		token = strings.TrimSpace(promptSpace.ReplaceAllString(token, " "))
+		if token == "" {
+			continue
+		}
+		out = append(out, token)
+	}
+
+	return strings.Join(out, ", ")
+}
+
+type promptImage struct {
+	seed int64
+	id   int64
+}
+
+// GroupPrompts groups the parsed objects of every AI submission by their normalized prompt.
+// If seedRange is greater than zero, each prompt is further split into runs of seeds no more than seedRange apart,
+// which separates batches that happen to reuse a prompt. Images without a prompt are ignored.
+func GroupPrompts(details []Detail, seedRange int64) []PromptGroup {
+	prompts := make(map[string][]promptImage)
+	for _, detail := range details {
+		if detail.Submission == nil || !detail.Submission.Metadata.AISubmission {
+			continue
+		}
+		for _, obj := range detail.Submission.Metadata.Objects {
+			prompt := NormalizePrompt(obj.Prompt)
+			if prompt == "" {
+				continue
+			}
+			prompts[prompt] = append(prompts[prompt], promptImage{seed: obj.Seed, id: detail.Submission.ID})
+		}
+	}
+
+	var groups []PromptGroup
+	for prompt, images := range prompts {
+		if seedRange <= 0 {
+			groups = append(groups, newPromptGroup(prompt, images))
+			continue
+		}
+
+		slices.SortFunc(images, func(a, b promptImage) int { return cmp.Compare(a.seed, b.seed) })
+		start := 0
+		for i := 1; i <= len(images); i++ {
+			if i < len(images) && images[i].seed-images[i-1].seed <= seedRange {
+				continue
+			}
+			group := newPromptGroup(prompt, images[start:i])
+			group.MinSeed = images[start].seed
+			group.MaxSeed = images[i-1].seed
+			groups = append(groups, group)
+			start = i
+		}
+	}
+
+	slices.SortFunc(groups, func(a, b PromptGroup) int {
+		if c := cmp.Compare(b.Images, a.Images); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(a.Prompt, b.Prompt); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.MinSeed, b.MinSeed)
+	})
+
+	return groups
+}
+
+func newPromptGroup(prompt string, images []promptImage) PromptGroup {
+	group := PromptGroup{
+		Prompt: prompt,
+		Images: len(images),
+	}
+	for _, image := range images {
+		if !slices.Contains(group.SubmissionIDs, image.id) {
+			group.SubmissionIDs = append(group.SubmissionIDs, image.id)
+		}
+	}
+	slices.Sort(group.SubmissionIDs)
+	return group
+}
+
+// FlagTooMany sets [db.Metadata.TooMany] on every submission that belongs to a [PromptGroup]
+// with more than [MaxImagesPerPrompt] images, and relabels their tickets.
+// It returns the offending groups.
+func FlagTooMany(details []Detail, seedRange int64) []PromptGroup {
+	var tooMany []PromptGroup
+	offending := make(map[int64]bool)
+	for _, group := range GroupPrompts(details, seedRange) {
+		if group.Images <= MaxImagesPerPrompt {
+			continue
+		}
+		tooMany = append(tooMany, group)
+		for _, id := range group.SubmissionIDs {
+			offending[id] = true
+		}
+	}
+
+	for _, detail := range details {
+		if detail.Submission == nil {
+			continue
+		}
+		flagged := offending[detail.Submission.ID]
+		if detail.Submission.Metadata.TooMany == flagged {
+			continue
+		}
+		detail.Submission.Metadata.TooMany = flagged
+		if detail.Ticket != nil {
+			detail.Ticket.Labels = TicketLabels(*detail.Submission)
+		}
+	}
+
+	return tooMany
+}
+
+// writePromptGroups lists the submissions of each prompt group that went over [MaxImagesPerPrompt].
+func writePromptGroups(writer ChunkedWriter, groups []PromptGroup) {
+	if len(groups) == 0 {
+		return
+	}
+	writer.WriteString(fmt.Sprintf("\n\n[u]More than %d images with the same prompt[/u]:", MaxImagesPerPrompt))
+	for _, group := range groups {
+		writer.WriteString(fmt.Sprintf("\n(%d images) [code]%s[/code]", group.Images, group.Prompt))
+		if group.MinSeed != group.MaxSeed {
+			writer.WriteString(fmt.Sprintf(" seeds %d-%d", group.MinSeed, group.MaxSeed))
+		}
+		writer.WriteString(":\n")
+		for i, id := range group.SubmissionIDs {
+			if i > 0 {
+				writer.WriteString(" ")
+			}
+			writer.WriteString(fmt.Sprintf("#M%d", id))
+		}
+	}
+}
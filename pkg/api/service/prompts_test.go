@@ -0,0 +1,140 @@
+package service
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/ellypaws/inkbunny-sd/entities"
+
+	"github.com/ellypaws/inkbunny-app/pkg/db"
+)
+
+func TestNormalizePromptGrouping(t *testing.T) {
+	tests := []struct {
+		prompt string
+		want   string
+	}{
+		{prompt: "Masterpiece, CAT", want: "masterpiece, cat"},
+		{prompt: "  masterpiece ,cat,  ", want: "masterpiece, cat"},
+		{prompt: "masterpiece,\n\tcat   ears", want: "masterpiece, cat ears"},
+		{prompt: "(masterpiece:1.2), [cat], {solo}", want: "masterpiece, cat, solo"},
+		{prompt: `\(artist\), (cat:-0.5)`, want: "artist, cat"},
+		{prompt: ", , ", want: ""},
+	}
+
+	for _, test := range tests {
+		if got := NormalizePrompt(test.prompt); got != test.want {
+			t.Errorf("NormalizePrompt(%q) = %q, want %q", test.prompt, got, test.want)
+		}
+	}
+}
+
+// promptDetails returns one AI submission per seed, each with a single image of prompt.
+func promptDetails(firstID int64, prompt string, seeds ...int64) []Detail {
+	var details []Detail
+	for i, seed := range seeds {
+		id := firstID + int64(i)
+		details = append(details, Detail{
+			Submission: &db.Submission{
+				ID: id,
+				Metadata: db.Metadata{
+					AISubmission: true,
+					Objects: map[string]entities.TextToImageRequest{
+						fmt.Sprintf("%d.png", id): {Prompt: prompt, Seed: seed},
+					},
+				},
+			},
+			Ticket: &db.Ticket{},
+		})
+	}
+	return details
+}
+
+func TestGroupPrompts(t *testing.T) {
+	details := slices.Concat(
+		promptDetails(1, "Cat, solo", 1, 2, 3),
+		promptDetails(4, "cat,solo ", 4),
+		promptDetails(5, "dog", 1),
+		promptDetails(6, "", 1),
+	)
+	details = append(details, Detail{Submission: &db.Submission{ID: 7, Metadata: db.Metadata{
+		Objects: map[string]entities.TextToImageRequest{"7.png": {Prompt: "cat, solo"}},
+	}}})
+
+	groups := GroupPrompts(details, 0)
+	if len(groups) != 2 {
+		t.Fatalf("expected 2 groups, got %+v", groups)
+	}
+	if groups[0].Prompt != "cat, solo" || groups[0].Images != 4 || !slices.Equal(groups[0].SubmissionIDs, []int64{1, 2, 3, 4}) {
+		t.Errorf("unexpected first group %+v", groups[0])
+	}
+	if groups[1].Prompt != "dog" || groups[1].Images != 1 {
+		t.Errorf("unexpected second group %+v", groups[1])
+	}
+}
+
+func TestGroupPromptsSeedRange(t *testing.T) {
+	details := promptDetails(1, "cat", 100, 101, 103, 500, 502, 10_000)
+
+	groups := GroupPrompts(details, 5)
+	want := []PromptGroup{
+		{Prompt: "cat", MinSeed: 100, MaxSeed: 103, Images: 3, SubmissionIDs: []int64{1, 2, 3}},
+		{Prompt: "cat", MinSeed: 500, MaxSeed: 502, Images: 2, SubmissionIDs: []int64{4, 5}},
+		{Prompt: "cat", MinSeed: 10_000, MaxSeed: 10_000, Images: 1, SubmissionIDs: []int64{6}},
+	}
+	if len(groups) != len(want) {
+		t.Fatalf("expected %d groups, got %+v", len(want), groups)
+	}
+	for i := range want {
+		if groups[i].MinSeed != want[i].MinSeed || groups[i].MaxSeed != want[i].MaxSeed ||
+			groups[i].Images != want[i].Images || !slices.Equal(groups[i].SubmissionIDs, want[i].SubmissionIDs) {
+			t.Errorf("group %d = %+v, want %+v", i, groups[i], want[i])
+		}
+	}
+
+	if groups := GroupPrompts(details, 0); len(groups) != 1 || groups[0].Images != 6 {
+		t.Errorf("expected a single group without a seed range, got %+v", groups)
+	}
+}
+
+func TestFlagTooMany(t *testing.T) {
+	t.Run("six images", func(t *testing.T) {
+		details := promptDetails(1, "cat", 1, 2, 3, 4, 5, 6)
+		if groups := FlagTooMany(details, 0); len(groups) != 0 {
+			t.Errorf("expected no groups, got %+v", groups)
+		}
+		for _, detail := range details {
+			if detail.Submission.Metadata.TooMany {
+				t.Errorf("submission %d was flagged", detail.Submission.ID)
+			}
+		}
+	})
+
+	t.Run("seven images", func(t *testing.T) {
+		details := slices.Concat(promptDetails(1, "cat", 1, 2, 3, 4, 5, 6, 7), promptDetails(8, "dog", 1))
+		groups := FlagTooMany(details, 0)
+		if len(groups) != 1 || groups[0].Images != 7 {
+			t.Fatalf("expected a single group of 7 images, got %+v", groups)
+		}
+		for _, detail := range details {
+			want := detail.Submission.ID != 8
+			if detail.Submission.Metadata.TooMany != want {
+				t.Errorf("submission %d: TooMany = %v, want %v", detail.Submission.ID, detail.Submission.Metadata.TooMany, want)
+			}
+			if slices.Contains(detail.Ticket.Labels, db.LabelTooMany) != want {
+				t.Errorf("submission %d: unexpected labels %v", detail.Submission.ID, detail.Ticket.Labels)
+			}
+		}
+	})
+
+	t.Run("split by seed range", func(t *testing.T) {
+		details := promptDetails(1, "cat", 1, 2, 3, 4, 1000, 1001, 1002)
+		if groups := FlagTooMany(details, 10); len(groups) != 0 {
+			t.Errorf("expected the batches to be under the limit, got %+v", groups)
+		}
+		if groups := FlagTooMany(details, 0); len(groups) != 1 {
+			t.Errorf("expected the batches to be over the limit without a seed range, got %+v", groups)
+		}
+	})
+}
@@ -0,0 +1,254 @@
+package service
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/ellypaws/inkbunny-app/pkg/api/cache"
+	"github.com/ellypaws/inkbunny-app/pkg/db"
+)
+
+// rederive derives the metadata of a submission again from its keywords and files as processSubmission does,
+// reading the attachments through cacheToUse. The models aren't looked up, reposts aren't searched and
+// FlagTooMany isn't run over the user's other submissions, the recorded results are kept instead, see recordedMetadata.
+func rederive(c echo.Context, sub *db.Submission, cacheToUse cache.Cache, database db.Store, bindings []db.ParserBinding, artists []db.Artist, characters []db.Character) {
+	sub.Metadata = recordedMetadata(sub.Metadata)
+
+	SetSubmissionMeta(sub, false)
+	if sub.Metadata.AISubmission {
+		processParams(c, sub, cacheToUse, bindings)
+		processObjectMetadata(sub, artists, characters)
+		checkKeywords(sub, database)
+		checkImg2ImgInput(sub)
+	}
+}
+
+// diffLabels returns the labels in after that aren't in before, and the ones in before that aren't in after.
+func diffLabels(before, after []db.TicketLabel) (added, removed []db.TicketLabel) {
+	for _, label := range after {
+		if !slices.Contains(before, label) {
+			added = append(added, label)
+		}
+	}
+	for _, label := range before {
+		if !slices.Contains(after, label) {
+			removed = append(removed, label)
+		}
+	}
+	return added, removed
+}
+
+// Reevaluation is how the labels of a stored submission changed when it was evaluated again under the current Version.
+type Reevaluation struct {
+	SubmissionID int64            `json:"submission_id"`
+	From         string           `json:"from,omitempty"` // the Version it was stored with, empty if unknown
+	Labels       []db.TicketLabel `json:"labels"`
+	Added        []db.TicketLabel `json:"added,omitempty"`
+	Removed      []db.TicketLabel `json:"removed,omitempty"`
+}
+
+// ReevaluationReport is the outcome of [ReevaluateStored].
+type ReevaluationReport struct {
+	Version   string         `json:"version"`
+	Started   time.Time      `json:"started"`
+	Finished  time.Time      `json:"finished"`
+	Evaluated int            `json:"evaluated"` // stored submissions of an older version or affected by ListChanges
+	Changed   []Reevaluation `json:"changed,omitempty"`
+	Error     string         `json:"error,omitempty"`
+}
+
+// ReevaluationStatus is whether stored submissions are being evaluated again, with the report of the last run.
+type ReevaluationStatus struct {
+	Version string              `json:"version"`
+	Running bool                `json:"running"`
+	Last    *ReevaluationReport `json:"last,omitempty"`
+}
+
+// Lists are the artists, characters and parser bindings the heuristics match against.
+type Lists struct {
+	Artists    []db.Artist
+	Characters []db.Character
+	Bindings   []db.ParserBinding
+}
+
+// ReadLists reads the Lists from database.
+func ReadLists(database db.Store) Lists {
+	return Lists{
+		Artists:    database.AllArtists(),
+		Characters: database.AllCharacters(),
+		Bindings:   ParserBindings(database),
+	}
+}
+
+// ListChanges are the entries of the Lists that were added, removed or edited.
+// An edited entry is listed both as it was and as it is now.
+type ListChanges struct {
+	Artists    []db.Artist
+	Characters []db.Character
+	Bindings   []db.ParserBinding
+}
+
+// Changes returns the entries that differ between l and after.
+func (l Lists) Changes(after Lists) ListChanges {
+	return ListChanges{
+		Artists:    changedEntries(l.Artists, after.Artists),
+		Characters: changedEntries(l.Characters, after.Characters),
+		Bindings:   changedEntries(l.Bindings, after.Bindings),
+	}
+}
+
+// changedEntries returns the entries of before that aren't in after, followed by the entries of after that aren't in before.
+func changedEntries[T any](before, after []T) []T {
+	var changed []T
+	for _, entry := range before {
+		if !slices.ContainsFunc(after, func(other T) bool { return reflect.DeepEqual(entry, other) }) {
+			changed = append(changed, entry)
+		}
+	}
+	for _, entry := range after {
+		if !slices.ContainsFunc(before, func(other T) bool { return reflect.DeepEqual(entry, other) }) {
+			changed = append(changed, entry)
+		}
+	}
+	return changed
+}
+
+// Empty reports whether nothing changed.
+func (c ListChanges) Empty() bool {
+	return len(c.Artists) == 0 && len(c.Characters) == 0 && len(c.Bindings) == 0
+}
+
+// Merge returns the changes of both c and other.
+func (c ListChanges) Merge(other ListChanges) ListChanges {
+	return ListChanges{
+		Artists:    slices.Concat(c.Artists, other.Artists),
+		Characters: slices.Concat(c.Characters, other.Characters),
+		Bindings:   slices.Concat(c.Bindings, other.Bindings),
+	}
+}
+
+// Affects reports whether the changes could relabel the stored submission.
+// It does if the submission used a changed artist, character or parser, if its prompts mention a changed artist or character,
+// or if a changed parser binding is for its user. A binding for every user affects every AI submission.
+func (c ListChanges) Affects(sub db.Submission) bool {
+	for _, artist := range c.Artists {
+		if slices.ContainsFunc(slices.Concat(sub.Metadata.ArtistUsed, sub.Metadata.ArtistConsented), func(used db.Artist) bool {
+			return strings.EqualFold(used.Username, artist.Username)
+		}) {
+			return true
+		}
+	}
+	for _, character := range c.Characters {
+		if slices.ContainsFunc(sub.Metadata.CharacterUsed, func(used db.Character) bool {
+			return used.ID == character.ID || strings.EqualFold(used.Name, character.Name)
+		}) {
+			return true
+		}
+	}
+	for _, binding := range c.Bindings {
+		switch {
+		case sub.Metadata.Parser != "" && sub.Metadata.Parser == binding.Parser:
+			return true
+		case binding.UserID == nil && sub.Metadata.AISubmission:
+			return true
+		case binding.UserID != nil && *binding.UserID == sub.UserID:
+			return true
+		}
+	}
+
+	if len(c.Artists) == 0 && len(c.Characters) == 0 {
+		return false
+	}
+	probe := db.Submission{Username: sub.Username, Updated: sub.Updated, Metadata: db.Metadata{Objects: sub.Metadata.Objects}}
+	findArtists(&probe, c.Artists)
+	findCharacters(&probe, c.Characters)
+	// "by artist" tags of artists that aren't registered are found too, only the changed ones count
+	return len(probe.Metadata.CharacterUsed) > 0 || slices.ContainsFunc(slices.Concat(probe.Metadata.ArtistUsed, probe.Metadata.ArtistConsented), func(found db.Artist) bool {
+		return slices.ContainsFunc(c.Artists, func(artist db.Artist) bool { return strings.EqualFold(found.Username, artist.Username) })
+	})
+}
+
+// reevaluatePage is how many stored submissions are read at once.
+const reevaluatePage = 100
+
+// Reevaluate derives the metadata of a stored submission again under the current Version and returns it with its labels.
+func Reevaluate(c echo.Context, stored db.SubmissionVersion, cacheToUse cache.Cache, database db.Store, bindings []db.ParserBinding, artists []db.Artist, characters []db.Character) (db.Submission, Reevaluation) {
+	sub := stored.Submission
+	sub.Files = slices.Clone(stored.Submission.Files)
+	rederive(c, &sub, cacheToUse, database, bindings, artists, characters)
+	sub.Metadata.Version = Version()
+
+	reevaluation := Reevaluation{
+		SubmissionID: stored.SubmissionID,
+		From:         stored.Submission.Metadata.Version,
+		Labels:       TicketLabels(sub),
+	}
+	reevaluation.Added, reevaluation.Removed = diffLabels(stored.Labels, reevaluation.Labels)
+	return sub, reevaluation
+}
+
+// ReevaluateStored goes through the latest version of every stored submission and evaluates the ones
+// of an older Version, or affected by changes, again, storing them with their new metadata and labels.
+// It waits pause between pages so the attachments aren't all fetched at once.
+// The report lists the submissions whose labels changed. It stops early when the database context is done.
+func ReevaluateStored(c echo.Context, database db.Store, cacheToUse cache.Cache, pause time.Duration, changes ListChanges) (report ReevaluationReport, err error) {
+	report = ReevaluationReport{
+		Version: Version(),
+		Started: time.Now().UTC(),
+	}
+	defer func() {
+		report.Finished = time.Now().UTC()
+		if err != nil {
+			report.Error = err.Error()
+		}
+	}()
+
+	var (
+		bindings   = ParserBindings(database)
+		artists    = database.AllArtists()
+		characters = database.AllCharacters()
+		after      int64
+	)
+	for {
+		if err := database.Context().Err(); err != nil {
+			return report, err
+		}
+		page, err := database.GetLatestSubmissionVersions(after, reevaluatePage)
+		if err != nil {
+			return report, err
+		}
+		if len(page) == 0 {
+			return report, nil
+		}
+		after = page[len(page)-1].SubmissionID
+
+		var evaluated bool
+		for _, stored := range page {
+			if stored.Submission.Metadata.Version == report.Version && !changes.Affects(stored.Submission) {
+				continue
+			}
+			evaluated = true
+			sub, reevaluation := Reevaluate(c, stored, cacheToUse, database, bindings, artists, characters)
+			report.Evaluated++
+			if err := database.StoreSubmission(sub, reevaluation.Labels); err != nil {
+				return report, fmt.Errorf("error storing submission %d: %w", sub.ID, err)
+			}
+			if len(reevaluation.Added) > 0 || len(reevaluation.Removed) > 0 {
+				report.Changed = append(report.Changed, reevaluation)
+			}
+		}
+
+		if evaluated && pause > 0 {
+			select {
+			case <-database.Context().Done():
+				return report, database.Context().Err()
+			case <-time.After(pause):
+			}
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package service
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ellypaws/inkbunny-sd/entities"
+
+	"github.com/ellypaws/inkbunny-app/pkg/db"
+)
+
+func TestReevaluate(t *testing.T) {
+	cases, err := LoadCorpus(filepath.Join("testdata", "corpus"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := slices.IndexFunc(cases, func(cc CorpusCase) bool { return cc.Name == "fooocus_json" })
+	if i < 0 {
+		t.Fatal("missing the fooocus_json case")
+	}
+	corpusCase := cases[i]
+	corpusCache := NewCorpusCache()
+	if err := corpusCase.Seed(corpusCache); err != nil {
+		t.Fatal(err)
+	}
+
+	// stored before versions were recorded, with a label the heuristics no longer give
+	stored := db.SubmissionVersion{
+		SubmissionID: corpusCase.Submission.ID,
+		Submission:   corpusCase.Submission,
+		Labels:       []db.TicketLabel{"missing_prompt", corpusCase.Labels[0]},
+	}
+	sub, reevaluation := Reevaluate(offlineContext(), stored, corpusCache, nil, ParserBindings(nil), corpusCase.Artists, corpusCase.Characters)
+
+	if sub.Metadata.Version != Version() {
+		t.Errorf("version = %q, want %q", sub.Metadata.Version, Version())
+	}
+	if stored.Submission.Metadata.Version != "" {
+		t.Error("Reevaluate() modified the stored submission")
+	}
+	if !slices.Equal(reevaluation.Labels, corpusCase.Labels) {
+		t.Errorf("labels = %v, want %v", reevaluation.Labels, corpusCase.Labels)
+	}
+	if !slices.Equal(reevaluation.Added, corpusCase.Labels[1:]) {
+		t.Errorf("added = %v, want %v", reevaluation.Added, corpusCase.Labels[1:])
+	}
+	if !slices.Equal(reevaluation.Removed, []db.TicketLabel{"missing_prompt"}) {
+		t.Errorf("removed = %v, want [missing_prompt]", reevaluation.Removed)
+	}
+
+	// too_many depends on the user's other submissions, so the stored flag is kept
+	stored.Submission.Metadata.TooMany = true
+	sub, reevaluation = Reevaluate(offlineContext(), stored, corpusCache, nil, ParserBindings(nil), corpusCase.Artists, corpusCase.Characters)
+	if !sub.Metadata.TooMany || !slices.Contains(reevaluation.Labels, "too_many") {
+		t.Errorf("Reevaluate() dropped too_many: %v", reevaluation.Labels)
+	}
+}
+
+func TestListChanges(t *testing.T) {
+	id := int64(1)
+	before := Lists{
+		Artists:    []db.Artist{{Username: "a"}, {Username: "some_body", UserID: &id}},
+		Characters: []db.Character{{ID: 1, Name: "fox", Owner: "a"}},
+		Bindings:   ParserBindings(nil),
+	}
+	if changes := before.Changes(before); !changes.Empty() {
+		t.Errorf("expected no changes, got %+v", changes)
+	}
+
+	after := before
+	after.Artists = []db.Artist{{Username: "a", Aliases: []string{"b"}}, before.Artists[1]}
+	changes := before.Changes(after)
+	if len(changes.Artists) != 2 || len(changes.Characters) != 0 || len(changes.Bindings) != 0 {
+		t.Errorf("expected the old and new version of the edited artist, got %+v", changes)
+	}
+
+	tests := []struct {
+		name    string
+		changes ListChanges
+		sub     db.Submission
+		want    bool
+	}{
+		{
+			name:    "used artist",
+			changes: ListChanges{Artists: []db.Artist{{Username: "A"}}},
+			sub:     db.Submission{Metadata: db.Metadata{ArtistUsed: []db.Artist{{Username: "a"}}}},
+			want:    true,
+		},
+		{
+			name:    "consented artist",
+			changes: ListChanges{Artists: []db.Artist{{Username: "a"}}},
+			sub:     db.Submission{Metadata: db.Metadata{ArtistConsented: []db.Artist{{Username: "a"}}}},
+			want:    true,
+		},
+		{
+			name:    "new artist in the prompt",
+			changes: ListChanges{Artists: []db.Artist{{Username: "some_body"}}},
+			sub: db.Submission{Metadata: db.Metadata{Objects: map[string]entities.TextToImageRequest{
+				"a.png": {Prompt: "masterpiece, (some body:1.2), solo"},
+			}}},
+			want: true,
+		},
+		{
+			name:    "other artist in the prompt",
+			changes: ListChanges{Artists: []db.Artist{{Username: "some_body"}}},
+			sub: db.Submission{Metadata: db.Metadata{
+				ArtistUsed: []db.Artist{{Username: "nobody"}},
+				Objects: map[string]entities.TextToImageRequest{
+					"a.png": {Prompt: "masterpiece, by nobody, solo"},
+				},
+			}},
+		},
+		{
+			name:    "used character",
+			changes: ListChanges{Characters: []db.Character{{ID: 2, Name: "Fox"}}},
+			sub:     db.Submission{Metadata: db.Metadata{CharacterUsed: []db.Character{{ID: 1, Name: "fox"}}}},
+			want:    true,
+		},
+		{
+			name:    "parser used",
+			changes: ListChanges{Bindings: []db.ParserBinding{{Parser: "a1111", UserID: &id}}},
+			sub:     db.Submission{UserID: 2, Metadata: db.Metadata{Parser: "a1111"}},
+			want:    true,
+		},
+		{
+			name:    "binding for the user",
+			changes: ListChanges{Bindings: []db.ParserBinding{{Parser: "a1111", UserID: &id}}},
+			sub:     db.Submission{UserID: 1, Metadata: db.Metadata{Parser: "comfy_ui"}},
+			want:    true,
+		},
+		{
+			name:    "binding for another user",
+			changes: ListChanges{Bindings: []db.ParserBinding{{Parser: "a1111", UserID: &id}}},
+			sub:     db.Submission{UserID: 2, Metadata: db.Metadata{AISubmission: true, Parser: "comfy_ui"}},
+		},
+		{
+			name:    "binding for every user",
+			changes: ListChanges{Bindings: []db.ParserBinding{{Parser: "a1111", FilePattern: `\.txt$`}}},
+			sub:     db.Submission{UserID: 2, Metadata: db.Metadata{AISubmission: true}},
+			want:    true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.changes.Affects(test.sub); got != test.want {
+				t.Errorf("Affects() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCacheVersion(t *testing.T) {
+	t.Cleanup(func() { listsRevision.Store("") })
+
+	id := int64(1)
+	lists := Lists{
+		Artists:    []db.Artist{{Username: "a"}, {Username: "b", UserID: &id}},
+		Characters: []db.Character{{ID: 1, Name: "fox", Owner: "a"}},
+		Bindings:   ParserBindings(nil),
+	}
+	UpdateListsRevision(lists)
+	key := parametersKey(14576)
+	version := Version()
+	if !strings.HasPrefix(CacheVersion(), version+"+") {
+		t.Errorf("expected CacheVersion() to extend Version() %s, got %s", version, CacheVersion())
+	}
+
+	reversed := lists
+	reversed.Artists = []db.Artist{lists.Artists[1], lists.Artists[0]}
+	UpdateListsRevision(reversed)
+	if parametersKey(14576) != key {
+		t.Errorf("the cache key depends on the order of the artists: %s != %s", parametersKey(14576), key)
+	}
+
+	changed := []Lists{
+		{Artists: append(slices.Clone(lists.Artists), db.Artist{Username: "c"}), Characters: lists.Characters, Bindings: lists.Bindings},
+		{Artists: lists.Artists, Characters: []db.Character{{ID: 1, Name: "fox", Owner: "a", Aliases: []string{"vixen"}}}, Bindings: lists.Bindings},
+		{Artists: lists.Artists, Characters: lists.Characters, Bindings: append(ParserBindings(nil), db.ParserBinding{Parser: "a1111", FilePattern: `\.txt$`})},
+	}
+	for _, after := range changed {
+		UpdateListsRevision(after)
+		if parametersKey(14576) == key {
+			t.Errorf("the cache key didn't change with the lists %+v", after)
+		}
+		if !strings.HasPrefix(CacheVersion(), version+"+") {
+			t.Errorf("expected only CacheVersion() to change with the lists, got %s and %s", version, CacheVersion())
+		}
+	}
+}
@@ -53,15 +53,19 @@ type User struct {
 type Report struct {
 	Auditor *User `json:"auditor,omitempty"`
 	api.UsernameID
+	Version     string    `json:"version,omitempty"` // the Version of the heuristics that labeled the submissions
 	Violations  int       `json:"violations"`
 	Ratio       float64   `json:"violation_ratio"`
 	Audited     int       `json:"total_audited"`
 	ReportDate  time.Time `json:"report_date"`
 	Submissions []SubInfo `json:"submissions"`
+
+	TooMany []PromptGroup `json:"too_many,omitempty"`
 }
 
 func CreateReport(processed []Detail, auditor *db.Auditor, host *url.URL) Report {
 	out := Report{
+		Version:    Version(),
 		ReportDate: time.Now().UTC(),
 	}
 
@@ -182,8 +186,11 @@ func getColor(label db.TicketLabel, colors map[string]string) string {
 	return colors[string(label)]
 }
 
-func CreateTicketReport(auditor *db.Auditor, details []Detail, host *url.URL) TicketReport {
+// CreateTicketReport creates a report of the details, flagging the prompts used too many times as [FlagTooMany] with seedRange.
+func CreateTicketReport(auditor *db.Auditor, details []Detail, host *url.URL, seedRange int64) TicketReport {
+	tooMany := FlagTooMany(details, seedRange)
 	report := CreateReport(details, auditor, host)
+	report.TooMany = tooMany
 	auditorAsUser := AuditorAsUsernameID(auditor)
 
 	var info struct {
@@ -279,6 +286,10 @@ func CreateTicketReport(auditor *db.Auditor, details []Detail, host *url.URL) Ti
 
 	message.Split()
 
+	writePromptGroups(message, report.TooMany)
+
+	message.Split()
+
 	if len(info.Artists) > 0 {
 		message.WriteString("\n\n")
 		message.WriteString("The prompt may have used these artists: ")
@@ -296,6 +307,63 @@ func CreateTicketReport(auditor *db.Auditor, details []Detail, host *url.URL) Ti
 		added++
 	}
 
+	added = 0
+	for _, detail := range details {
+		if len(detail.Submission.Metadata.ArtistConsented) == 0 {
+			continue
+		}
+		if added == 0 {
+			message.WriteString("\n\n")
+			message.WriteString("These artists allowed the use of their name:")
+		}
+		message.WriteString(writeArtistConsented(detail.Submission))
+		added++
+	}
+
+	added = 0
+	for _, detail := range details {
+		if len(detail.Submission.Metadata.CharacterUsed) == 0 {
+			continue
+		}
+		if added == 0 {
+			message.WriteString("\n\n")
+			message.WriteString("The prompt may have used these characters: ")
+		} else {
+			message.WriteString("\n")
+		}
+		message.WriteString(writeCharacterUsed(detail.Submission))
+		added++
+	}
+
+	message.Split()
+
+	for _, detail := range details {
+		if !detail.Submission.Metadata.SoldArt {
+			continue
+		}
+		message.WriteString(fmt.Sprintf("\n\nSubmission #%d appears to be sold:", detail.Submission.ID))
+		message.WriteString(writeSoldArt(detail.Submission))
+	}
+
+	message.Split()
+
+	for _, detail := range details {
+		if len(detail.Submission.Metadata.Reposts) == 0 {
+			continue
+		}
+		message.WriteString(fmt.Sprintf("\n\nSubmission #%d was posted earlier in:", detail.Submission.ID))
+		message.WriteString(writeReposts(detail.Submission))
+	}
+
+	message.Split()
+
+	for _, detail := range details {
+		if len(detail.Submission.Metadata.SuggestedKeywords) == 0 {
+			continue
+		}
+		message.WriteString(fmt.Sprintf("\n\nSuggested keywords for #%d: %s", detail.Submission.ID, strings.Join(detail.Submission.Metadata.SuggestedKeywords, ", ")))
+	}
+
 	message.Split()
 
 	var lastSubmission string
@@ -346,7 +414,7 @@ func CreateTicketReport(auditor *db.Auditor, details []Detail, host *url.URL) Ti
 	return out
 }
 
-func StoreReport(c echo.Context, database *db.Sqlite, ticket TicketReport) {
+func StoreReport(c echo.Context, database db.Store, ticket TicketReport) {
 	reportKey := fmt.Sprintf(
 		"%s:report:%s:%s",
 		echo.MIMEApplicationJSON,
@@ -512,6 +580,10 @@ func RecreateReport(report *TicketReport) error {
 
 	message.Split()
 
+	writePromptGroups(message, report.Report.TooMany)
+
+	message.Split()
+
 	report.Ticket.Status = "audited"
 	report.Ticket.Labels = info.Labels
 
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/disintegration/imaging"
+	"github.com/ellypaws/inkbunny/api"
+	"github.com/labstack/echo/v4"
+
+	"github.com/ellypaws/inkbunny-app/pkg/api/cache"
+	"github.com/ellypaws/inkbunny-app/pkg/db"
+)
+
+const (
+	// RepostLimit is the number of times the same work may be posted to an account.
+	RepostLimit = 3
+	// RepostWindow is the time that has to pass before the same work can be posted again.
+	RepostWindow = 72 * time.Hour
+	// RepostDistance is the maximum number of differing bits for two perceptual hashes to be the same image.
+	RepostDistance = 6
+)
+
+// PerceptualHash returns the difference hash of an image.
+// The image is reduced to a 9x8 grayscale thumbnail and each bit records whether a pixel is brighter than its right neighbour,
+// so re-encoded or resized copies of the same image produce hashes that differ by only a few bits.
+func PerceptualHash(img image.Image) uint64 {
+	small := imaging.Grayscale(imaging.Resize(img, 9, 8, imaging.Box))
+	var hash uint64
+	for y := range 8 {
+		for x := range 8 {
+			left := small.Pix[small.PixOffset(x, y)]
+			right := small.Pix[small.PixOffset(x+1, y)]
+			hash <<= 1
+			if left > right {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// checkReposts hashes every image in the submission, looks up earlier postings of the same images by the user,
+// then stores the hashes so later reviews can find this submission.
+// It sets [db.Metadata.ContentRepost] when an image was posted more than [RepostLimit] times or again within [RepostWindow].
+func checkReposts(c echo.Context, sub *db.Submission, config *Config) {
+	if config.Database == nil {
+		return
+	}
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		hashes []db.FileHash
+	)
+	for _, file := range sub.Files {
+		if !strings.HasPrefix(file.File.MimeType, "image") || file.File.FullFileMD5 == "" {
+			continue
+		}
+		wg.Add(1)
+		go func(file api.File) {
+			defer wg.Done()
+			hash := fileHash(sub, file)
+			hash.PHash = screenHash(c, config.Cache, file)
+			mu.Lock()
+			hashes = append(hashes, hash)
+			mu.Unlock()
+		}(file.File)
+	}
+	wg.Wait()
+
+	var reposts []db.Repost
+	for _, hash := range hashes {
+		found, err := config.Database.GetReposts(hash, RepostDistance)
+		if err != nil {
+			c.Logger().Errorf("error looking up reposts for %s: %v", sub.URL, err)
+			continue
+		}
+		for _, repost := range found {
+			if !slices.ContainsFunc(reposts, func(r db.Repost) bool { return r.FileID == repost.FileID }) {
+				reposts = append(reposts, repost)
+			}
+		}
+	}
+
+	if err := config.Database.UpsertFileHash(hashes...); err != nil {
+		c.Logger().Errorf("error storing file hashes for %s: %v", sub.URL, err)
+	}
+
+	if len(reposts) == 0 {
+		return
+	}
+
+	slices.SortFunc(reposts, func(a, b db.Repost) int { return a.Posted.Compare(b.Posted) })
+	sub.Metadata.Reposts = reposts
+	sub.Metadata.ContentRepost = repostViolation(hashes, reposts)
+}
+
+// repostViolation reports whether the earlier postings break the repost policy,
+// either by being posted more than [RepostLimit] times in total or within [RepostWindow] after an earlier posting.
+func repostViolation(hashes []db.FileHash, reposts []db.Repost) bool {
+	var submissions []int64
+	for _, repost := range reposts {
+		if !slices.Contains(submissions, repost.SubmissionID) {
+			submissions = append(submissions, repost.SubmissionID)
+		}
+	}
+	if len(submissions)+1 > RepostLimit {
+		return true
+	}
+
+	for _, hash := range hashes {
+		for _, repost := range reposts {
+			if hash.Posted.Sub(repost.Posted) < RepostWindow {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func fileHash(sub *db.Submission, file api.File) db.FileHash {
+	fileID, _ := strconv.ParseInt(file.FileID, 10, 64)
+	posted, err := time.Parse(InkbunnyTimeLayout, file.CreateDateTime)
+	if err != nil {
+		posted = sub.Updated
+	}
+	return db.FileHash{
+		FileID:       fileID,
+		SubmissionID: sub.ID,
+		UserID:       sub.UserID,
+		MD5:          file.FullFileMD5,
+		Posted:       posted.UTC(),
+	}
+}
+
+// screenHash fetches the screen sized image and returns its [PerceptualHash], or 0 if it could not be decoded.
+func screenHash(c echo.Context, cacheToUse cache.Cache, file api.File) uint64 {
+	fileURL := file.FileURLScreen
+	if fileURL == "" {
+		fileURL = file.FileURLFull
+	}
+	threeMonths := 3 * cache.Month
+	b, errFunc := cache.Retrieve(c, cacheToUse, cache.Fetch{
+		Key:      fmt.Sprintf("%s:%s", file.MimeType, fileURL),
+		URL:      fileURL,
+		MimeType: file.MimeType,
+		Duration: &threeMonths,
+	})
+	if errFunc != nil {
+		c.Logger().Errorf("error fetching %s", fileURL)
+		return 0
+	}
+
+	img, err := imaging.Decode(bytes.NewReader(b.Blob))
+	if err != nil {
+		c.Logger().Warnf("error decoding %s: %v", fileURL, err)
+		return 0
+	}
+
+	return PerceptualHash(img)
+}
+
+// writeReposts lists the earlier postings of the submission's files.
+func writeReposts(sub *db.Submission) string {
+	var sb strings.Builder
+	var written []int64
+	for _, repost := range sub.Metadata.Reposts {
+		if slices.Contains(written, repost.SubmissionID) {
+			continue
+		}
+		written = append(written, repost.SubmissionID)
+		sb.WriteString(fmt.Sprintf("\n[url=https://inkbunny.net/s/%d]#%d[/url] (%s)",
+			repost.SubmissionID, repost.SubmissionID, repost.Posted.Format(time.DateTime)))
+	}
+	return sb.String()
+}
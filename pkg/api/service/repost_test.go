@@ -0,0 +1,73 @@
+package service
+
+import (
+	"image"
+	"image/color"
+	"testing"
+	"time"
+
+	"github.com/disintegration/imaging"
+
+	"github.com/ellypaws/inkbunny-app/pkg/db"
+)
+
+// testPattern draws uneven bands so neighbouring pixels of the thumbnail differ in brightness.
+func testPattern(width, height int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			fx, fy := x*256/width, y*256/height
+			img.Set(x, y, color.RGBA{R: uint8(fx * fy / 256), G: uint8((fx ^ fy) & 0xE0), B: uint8(fx), A: 255})
+		}
+	}
+	return img
+}
+
+func TestPerceptualHash(t *testing.T) {
+	original := testPattern(512, 384)
+	hash := PerceptualHash(original)
+	if hash == 0 {
+		t.Fatal("PerceptualHash() of a pattern returned 0")
+	}
+
+	if distance := db.HashDistance(hash, PerceptualHash(original)); distance != 0 {
+		t.Errorf("expected the same image to have a distance of 0, got %d", distance)
+	}
+	if distance := db.HashDistance(hash, PerceptualHash(imaging.Resize(original, 256, 192, imaging.Lanczos))); distance > RepostDistance {
+		t.Errorf("expected a resized copy to be within %d bits, got %d", RepostDistance, distance)
+	}
+	if distance := db.HashDistance(hash, PerceptualHash(imaging.FlipH(original))); distance <= RepostDistance {
+		t.Errorf("expected a mirrored image to differ by more than %d bits, got %d", RepostDistance, distance)
+	}
+}
+
+func TestRepostViolation(t *testing.T) {
+	posted := time.Date(2024, time.January, 10, 0, 0, 0, 0, time.UTC)
+	earlier := func(submissionID int64, before time.Duration) db.Repost {
+		return db.Repost{FileHash: db.FileHash{SubmissionID: submissionID, Posted: posted.Add(-before)}}
+	}
+	week := 7 * 24 * time.Hour
+
+	tests := []struct {
+		name    string
+		reposts []db.Repost
+		want    bool
+	}{
+		{name: "no earlier postings"},
+		{name: "posted once before", reposts: []db.Repost{earlier(1, week)}},
+		{name: "posted twice before", reposts: []db.Repost{earlier(1, 2*week), earlier(2, week)}},
+		{name: "posted three times before", reposts: []db.Repost{earlier(1, 3*week), earlier(2, 2*week), earlier(3, week)}, want: true},
+		{name: "several files of one submission", reposts: []db.Repost{earlier(1, 2*week), earlier(1, 2*week), earlier(2, week)}},
+		{name: "within the window", reposts: []db.Repost{earlier(1, RepostWindow-time.Hour)}, want: true},
+		{name: "just outside the window", reposts: []db.Repost{earlier(1, RepostWindow+time.Hour)}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hashes := []db.FileHash{{SubmissionID: 10, Posted: posted}}
+			if got := repostViolation(hashes, test.reposts); got != test.want {
+				t.Errorf("repostViolation() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
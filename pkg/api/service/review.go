@@ -3,7 +3,6 @@ package service
 import (
 	"bytes"
 	"encoding/json"
-	"fmt"
 	"net/http"
 	"net/url"
 	"slices"
@@ -33,10 +32,13 @@ type Review struct {
 	Search        *SearchReview
 	Store         *any
 
-	Database *db.Sqlite
+	Database db.Store
 	ApiHost  *url.URL
 
 	Auditor *db.Auditor
+
+	// SeedRange is passed to FlagTooMany for reports
+	SeedRange int64
 }
 
 func RetrieveReview(c echo.Context, review *Review) (processed []Detail, missed []string, errFunc func(c echo.Context) error) {
@@ -58,13 +60,7 @@ func RetrieveReview(c echo.Context, review *Review) (processed []Detail, missed
 	}
 
 	for _, id := range review.SubmissionIDs {
-		key := fmt.Sprintf(
-			"%s:review:%s:%s?%s",
-			echo.MIMEApplicationJSON,
-			review.Output,
-			id,
-			review.Query.Encode(),
-		)
+		key := ReviewKey(review.Output, id, review.Query)
 
 		item, err := review.Cache.Get(key)
 		if err != nil {
@@ -108,7 +104,7 @@ func RetrieveReview(c echo.Context, review *Review) (processed []Detail, missed
 		*review.Store = CreateSingleTicket(review.Auditor, processed)
 		review.Stream = false
 	case OutputReport, OutputReportIDs:
-		report := CreateTicketReport(review.Auditor, processed, review.ApiHost)
+		report := CreateTicketReport(review.Auditor, processed, review.ApiHost, review.SeedRange)
 		StoreReport(c, review.Database, report)
 		*review.Store = report
 	default:
@@ -16,8 +16,6 @@ import (
 	"github.com/ellypaws/inkbunny-app/pkg/crashy"
 )
 
-const ReviewSearchFormat = "%s:review:%s:search:%s:%d?%s"
-
 func RetrieveReviewSearch(c echo.Context, sid string, output string, query url.Values, cacheToUse cache.Cache) (*api.SubmissionSearchResponse, func(echo.Context) error) {
 	var request = api.SubmissionSearchRequest{
 		Text:               "ai_generated",
@@ -58,6 +56,7 @@ func RetrieveReviewSearch(c echo.Context, sid string, output string, query url.V
 		searchReviewKey := fmt.Sprintf(
 			ReviewSearchFormat,
 			echo.MIMEApplicationJSON,
+			CacheVersion(),
 			output,
 			request.RID,
 			request.Page,
@@ -98,8 +97,18 @@ func RetrieveReviewSearch(c echo.Context, sid string, output string, query url.V
 		return &searchResponse, nil
 	}
 
+	if err := RetrieveSearchPages(c, request, &searchResponse); err != nil {
+		return nil, cache.ErrFunc(http.StatusInternalServerError, err)
+	}
+
+	return &searchResponse, nil
+}
+
+// RetrieveSearchPages retrieves every page after the first of a search made with request,
+// appending their submissions to searchResponse.
+func RetrieveSearchPages(c echo.Context, request api.SubmissionSearchRequest, searchResponse *api.SubmissionSearchResponse) error {
 	if searchResponse.PagesCount <= 1 {
-		return &searchResponse, nil
+		return nil
 	}
 
 	var requests = make(chan api.SubmissionSearchRequest, searchResponse.PagesCount-1)
@@ -137,11 +146,11 @@ func RetrieveReviewSearch(c echo.Context, sid string, output string, query url.V
 		case response := <-responses:
 			searchResponse.Submissions = append(searchResponse.Submissions, response.Submissions...)
 		case err := <-errors:
-			return nil, cache.ErrFunc(http.StatusInternalServerError, err)
+			return err
 		}
 	}
 
-	return &searchResponse, nil
+	return nil
 }
 
 type SearchReview struct {
@@ -167,6 +176,7 @@ func StoreSearchReview(c echo.Context, query url.Values, store *SearchReview) {
 	searchReviewKey := fmt.Sprintf(
 		ReviewSearchFormat,
 		echo.MIMEApplicationJSON,
+		CacheVersion(),
 		c.QueryParam("output"),
 		store.Search.RID,
 		store.Search.Page,
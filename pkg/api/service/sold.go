@@ -0,0 +1,116 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ellypaws/inkbunny-app/pkg/db"
+)
+
+var (
+	// saleOffer matches YCH, adoptable, auction and commission vocabulary
+	saleOffer = regexp.MustCompile(`(?i)\b(?:ych|y\.c\.h|your character here|adopt(?:able)?s?|auction(?:s|ed|ing)?|starting bid|auto[- ]?buy|commissions? (?:are )?open|open for commissions?|for sale|selling|buy it now)\b|\b(?:sb|ab|price[sd]?)\s*[:=]`)
+	salePrice = regexp.MustCompile(`(?i)[$€£]\s?\d+(?:[.,]\d{1,2})?|\b\d+(?:[.,]\d{1,2})?\s?(?:usd|eur|gbp|dollars?|euros?)\b`)
+	// tipJar matches donation links, a price next to one of these is a tip and not a sale
+	tipJar = regexp.MustCompile(`(?i)\b(?:ko-?fi|patreon|subscribestar|tips?|tip jar|donat(?:e|ions?)|buy me a coffee|paypal\.me|support me)\b`)
+)
+
+// snippetContext is the number of bytes kept on each side of a signal
+const snippetContext = 40
+
+// detectSoldArt sets SoldArt if the submission is listed for sale, offers a YCH, adoptable, auction or commission,
+// or names a price that isn't about a tip jar. The signals are kept in SoldArtEvidence.
+func detectSoldArt(submission *db.Submission) {
+	var evidence []db.SaleEvidence
+	if submission.Metadata.ForSale {
+		evidence = append(evidence, db.SaleEvidence{
+			Source:  db.SaleListing,
+			Signal:  "for sale",
+			Snippet: "digital or print sales are enabled on Inkbunny",
+		})
+	}
+
+	for _, field := range []struct {
+		source string
+		text   string
+	}{
+		{db.SaleTitle, submission.Title},
+		{db.SaleDescription, submission.Description},
+	} {
+		for _, loc := range saleOffer.FindAllStringIndex(field.text, -1) {
+			evidence = append(evidence, saleEvidence(field.source, field.text, loc))
+		}
+		for _, loc := range salePrice.FindAllStringIndex(field.text, -1) {
+			if tipJar.MatchString(lineAt(field.text, loc[0])) {
+				continue
+			}
+			evidence = append(evidence, saleEvidence(field.source, field.text, loc))
+		}
+	}
+
+	for _, keyword := range submission.Keywords {
+		if saleOffer.MatchString(keyword.KeywordName) {
+			evidence = append(evidence, db.SaleEvidence{
+				Source:  db.SaleKeyword,
+				Signal:  keyword.KeywordName,
+				Snippet: keyword.KeywordName,
+			})
+		}
+	}
+
+	submission.Metadata.SoldArtEvidence = evidence
+	submission.Metadata.SoldArt = len(evidence) > 0
+}
+
+func saleEvidence(source, text string, loc []int) db.SaleEvidence {
+	return db.SaleEvidence{
+		Source:  source,
+		Signal:  text[loc[0]:loc[1]],
+		Snippet: snippetAround(text, loc[0], loc[1]),
+	}
+}
+
+// snippetAround returns the line around text[start:end], cut to snippetContext bytes on each side.
+func snippetAround(text string, start, end int) string {
+	line := lineAt(text, start)
+	lineStart := strings.LastIndexByte(text[:start], '\n') + 1
+
+	from := max(start-lineStart-snippetContext, 0)
+	to := min(end-lineStart+snippetContext, len(line))
+	for from > 0 && !utf8.RuneStart(line[from]) {
+		from--
+	}
+	for to < len(line) && !utf8.RuneStart(line[to]) {
+		to++
+	}
+
+	snippet := strings.TrimSpace(line[from:to])
+	if from > 0 {
+		snippet = "..." + snippet
+	}
+	if to < len(line) {
+		snippet += "..."
+	}
+	return snippet
+}
+
+// lineAt returns the line of text containing the byte at i.
+func lineAt(text string, i int) string {
+	start := strings.LastIndexByte(text[:i], '\n') + 1
+	end := strings.IndexByte(text[i:], '\n')
+	if end < 0 {
+		return text[start:]
+	}
+	return text[start : i+end]
+}
+
+// writeSoldArt lists the evidence that the submission is being sold.
+func writeSoldArt(sub *db.Submission) string {
+	var sb strings.Builder
+	for _, evidence := range sub.Metadata.SoldArtEvidence {
+		sb.WriteString(fmt.Sprintf("\n%s ([b]%s[/b]): [i]%s[/i]", evidence.Source, evidence.Signal, evidence.Snippet))
+	}
+	return sb.String()
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/ellypaws/inkbunny/api"
+
+	"github.com/ellypaws/inkbunny-app/pkg/db"
+)
+
+func TestDetectSoldArt(t *testing.T) {
+	tests := []struct {
+		name       string
+		submission db.Submission
+		want       []db.SaleEvidence
+	}{
+		{
+			name: "tip jar",
+			submission: db.Submission{
+				Title:       "Sunset",
+				Description: "If you like my work, tips on Ko-fi from $3 are appreciated!",
+			},
+		},
+		{
+			name: "ych",
+			submission: db.Submission{
+				Title:       "YCH open",
+				Description: "Slots are $15 each\nMy Patreon has the full set",
+			},
+			want: []db.SaleEvidence{
+				{Source: db.SaleTitle, Signal: "YCH", Snippet: "YCH open"},
+				{Source: db.SaleDescription, Signal: "$15", Snippet: "Slots are $15 each"},
+			},
+		},
+		{
+			name: "listing and keyword",
+			submission: db.Submission{
+				Keywords: []api.Keyword{{KeywordName: "adoptable"}},
+				Metadata: db.Metadata{ForSale: true},
+			},
+			want: []db.SaleEvidence{
+				{Source: db.SaleListing, Signal: "for sale", Snippet: "digital or print sales are enabled on Inkbunny"},
+				{Source: db.SaleKeyword, Signal: "adoptable", Snippet: "adoptable"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			detectSoldArt(&tt.submission)
+			got := tt.submission.Metadata.SoldArtEvidence
+			if len(got) != len(tt.want) {
+				t.Fatalf("SoldArtEvidence = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("SoldArtEvidence[%d] = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+			if tt.submission.Metadata.SoldArt != (len(tt.want) > 0) {
+				t.Errorf("SoldArt = %v, want %v", tt.submission.Metadata.SoldArt, len(tt.want) > 0)
+			}
+		})
+	}
+}
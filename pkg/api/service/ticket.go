@@ -10,6 +10,7 @@ import (
 
 	"github.com/ellypaws/inkbunny/api"
 
+	"github.com/ellypaws/inkbunny-app/pkg/api/rules"
 	"github.com/ellypaws/inkbunny-app/pkg/db"
 	"github.com/ellypaws/inkbunny-sd/utils"
 )
@@ -39,6 +40,8 @@ func InkbunnySubmissionToDBSubmission(submission api.Submission, override bool)
 		Keywords:    submission.Keywords,
 	}
 
+	dbSubmission.Metadata.ForSale = bool(submission.Digitalsales || submission.Printsales || submission.ForSale)
+
 	for _, f := range submission.Files {
 		dbSubmission.Files = append(dbSubmission.Files, db.File{
 			File:    f,
@@ -54,6 +57,7 @@ func InkbunnySubmissionToDBSubmission(submission api.Submission, override bool)
 var PrivateTools = regexp.MustCompile(`(?i)\b(midjourney|novelai|bing|dall[- ]?e|nijijourney|craiyon|image[- ]*fx|perchance)\b`)
 
 // SetSubmissionMeta modifies a submission's Metadata based on its Keywords and other fields.
+// Keywords are mapped to Metadata flags by the active [rules.Set].
 func SetSubmissionMeta(submission *db.Submission, override bool) {
 	if submission == nil {
 		return
@@ -61,44 +65,7 @@ func SetSubmissionMeta(submission *db.Submission, override bool) {
 	if override {
 		submission.Metadata.AISubmission = true
 	}
-	for _, keyword := range submission.Keywords {
-		switch keyword.KeywordName {
-		case "ai generated", "ai art":
-			submission.Metadata.Generated = true
-			submission.Metadata.AIKeywords = append(submission.Metadata.AIKeywords, keyword.KeywordName)
-			submission.Metadata.AISubmission = true
-		case "ai assisted":
-			submission.Metadata.Assisted = true
-			submission.Metadata.AIKeywords = append(submission.Metadata.AIKeywords, keyword.KeywordName)
-			submission.Metadata.AISubmission = true
-		case "img2img":
-			submission.Metadata.Img2Img = true
-			submission.Metadata.AIKeywords = append(submission.Metadata.AIKeywords, keyword.KeywordName)
-			submission.Metadata.AISubmission = true
-		case "stable diffusion":
-			submission.Metadata.StableDiffusion = true
-			submission.Metadata.AIKeywords = append(submission.Metadata.AIKeywords, keyword.KeywordName)
-			submission.Metadata.AISubmission = true
-		case "comfyui", "comfy ui":
-			submission.Metadata.ComfyUI = true
-			submission.Metadata.AIKeywords = append(submission.Metadata.AIKeywords, keyword.KeywordName)
-			submission.Metadata.AISubmission = true
-		case "human":
-			submission.Metadata.TaggedHuman = true
-		}
-		switch keyword.KeywordID {
-		case db.AIGeneratedID, db.AIArt:
-			submission.Metadata.Generated = true
-		case db.AIAssistedID:
-			submission.Metadata.Assisted = true
-		case db.Img2ImgID:
-			submission.Metadata.Img2Img = true
-		case db.StableDiffusionID:
-			submission.Metadata.StableDiffusion = true
-		case db.ComfyUIID, db.ComfyUI:
-			submission.Metadata.ComfyUI = true
-		}
-	}
+	rules.Active().ApplyKeywords(submission)
 
 	if tool := PrivateTools.FindString(submission.Description); tool != "" {
 		submission.Metadata.AISubmission = true
@@ -167,123 +134,13 @@ func SetSubmissionMeta(submission *db.Submission, override bool) {
 	if submission.Metadata.AISubmission && len(submission.Metadata.AIKeywords) == 0 {
 		submission.Metadata.MissingTags = true
 	}
+	detectSoldArt(submission)
+	checkImg2ImgInput(submission)
 }
 
 var aiRegex = regexp.MustCompile(`(?i)\b(ai|ia|ai generated|ai assisted|img2img|stable diffusion|comfyui)\b`)
 
-var payment = regexp.MustCompile(`(?i)\b(ko-?fi|paypal|patreon|subscribestar|donate|bitcoin|ethereum|monero)\b`)
-
-var sortedTicketLabels = []db.TicketLabel{
-	db.LabelArtistUsed,
-	db.LabelPrivateTool,
-	db.LabelMissingTags,
-	db.LabelMissingParams,
-	db.LabelMissingPrompt,
-	db.LabelMissingModel,
-	db.LabelMissingSeed,
-}
-
+// TicketLabels returns the labels emitted by the active [rules.Set] for the submission.
 func TicketLabels(submission db.Submission) []db.TicketLabel {
-	labels := make(map[db.TicketLabel]bool)
-	metadata := submission.Metadata
-
-	if metadata.TaggedHuman {
-		labels[db.LabelTaggedHuman] = true
-	}
-	if metadata.DetectedHuman {
-		labels[db.LabelDetectedHuman] = true
-	}
-
-	if metadata.AISubmission {
-		if len(metadata.Objects) == 0 {
-			if metadata.HasTxt || metadata.HasJSON {
-				labels[db.LabelCannotParse] = true
-			} else {
-				labels[db.LabelMissingParams] = true
-			}
-		}
-		if metadata.MissingTags {
-			labels[db.LabelMissingTags] = true
-		}
-		if len(metadata.ArtistUsed) > 0 {
-			labels[db.LabelArtistUsed] = true
-		}
-
-		if p := payment.FindString(submission.Description); p != "" {
-			labels[db.TicketLabel(fmt.Sprintf("%s:%s", db.LabelPayMention, p))] = true
-		}
-
-		if submission.Updated.Before(db.Nov21) {
-			labels[db.LabelBeforeRuleRevision] = true
-		}
-
-		if metadata.PrivateTool {
-			labels[db.TicketLabel(fmt.Sprintf("%s:%s", db.LabelPrivateTool, metadata.Generator))] = true
-		}
-
-		const (
-			prompt  = "prompt"
-			model   = "model"
-			seed    = "seed"
-			steps   = "steps"
-			cfg     = "cfg"
-			sampler = "sampler"
-		)
-		hints := [...]hint{
-			0: {label: prompt},
-			1: {label: model},
-			2: {label: seed},
-			3: {label: steps},
-			4: {label: cfg},
-			5: {label: sampler},
-		}
-		for _, obj := range metadata.Objects {
-			hints[0].assert(obj.Prompt != "")
-			hints[1].assert(obj.OverrideSettings.SDModelCheckpoint != nil || obj.OverrideSettings.SDCheckpointHash != "")
-			hints[2].assert(obj.Seed != 0 && obj.Seed != -1)
-			hints[3].assert(obj.Steps > 0)
-			hints[4].assert(obj.CFGScale != 0.0)
-			hints[5].assert(obj.SamplerName != "")
-		}
-		for _, v := range hints {
-			if v.missing {
-				if v.partial {
-					labels[db.TicketLabel("partial_"+v.label)] = true
-				} else {
-					labels[db.TicketLabel("missing_"+v.label)] = true
-				}
-			}
-		}
-	}
-
-	out := make([]db.TicketLabel, 0, len(labels))
-	for _, label := range sortedTicketLabels {
-		if labels[label] {
-			out = append(out, label)
-			labels[label] = false
-		}
-	}
-
-	for label, ok := range labels {
-		if !ok {
-			continue
-		}
-		out = append(out, label)
-	}
-
-	return out
-}
-
-type hint struct {
-	label   string
-	missing bool
-	partial bool
-}
-
-func (h *hint) assert(condition bool) {
-	if condition {
-		h.partial = true
-	} else {
-		h.missing = true
-	}
+	return rules.Active().Labels(&submission)
 }
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"sync/atomic"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/ellypaws/inkbunny-app/pkg/api/rules"
+	"github.com/ellypaws/inkbunny-app/pkg/db"
+)
+
+// HeuristicsVersion is raised with every change to the parsers or heuristics that can change the metadata they derive.
+const HeuristicsVersion = 1
+
+// Version identifies the heuristics and the active rules a result was derived with, e.g. "1+2024.1".
+// It's stamped in db.Metadata and reports and is part of the cache keys, so results of an older version are computed again.
+// Changes to the artists, characters and parser bindings re-evaluate only the stored submissions they affect, see ListChanges,
+// and move the cache keys to a new CacheVersion.
+func Version() string {
+	return fmt.Sprintf("%d+%s", HeuristicsVersion, rules.Active().Version)
+}
+
+// listsRevision identifies the Lists the cached results were derived with, see UpdateListsRevision.
+var listsRevision atomic.Value
+
+// UpdateListsRevision moves the cache keys to a revision of lists, so results derived with other lists
+// are computed again when read. Call it when the server starts and whenever one of the lists changes.
+// Unlike Version, the revision isn't stamped in db.Metadata, the stored submissions are re-evaluated through ListChanges.
+func UpdateListsRevision(lists Lists) {
+	listsRevision.Store(lists.digest())
+}
+
+// CacheVersion is the Version with the revision of the Lists, as it's used in the cache keys, e.g. "1+2024.1+3f9a2c1b".
+func CacheVersion() string {
+	version := Version()
+	if revision, _ := listsRevision.Load().(string); revision != "" {
+		version += "+" + revision
+	}
+	return version
+}
+
+// digest returns a short hash of the lists that doesn't depend on the order they were read in.
+func (l Lists) digest() string {
+	artists := slices.Clone(l.Artists)
+	slices.SortFunc(artists, func(a, b db.Artist) int { return cmp.Compare(a.Username, b.Username) })
+	characters := slices.Clone(l.Characters)
+	slices.SortFunc(characters, func(a, b db.Character) int { return cmp.Compare(a.ID, b.ID) })
+
+	hash := sha256.New()
+	encoder := json.NewEncoder(hash)
+	for _, list := range []any{artists, characters, l.Bindings} {
+		_ = encoder.Encode(list)
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:8]
+}
+
+// ReviewSearchFormat is the cache key of a reviewed search page: MIME type, CacheVersion, output, RID, page and query.
+const ReviewSearchFormat = "%s:review:%s:%s:search:%s:%d?%s"
+
+// ReviewKey is the cache key of the review of one or more comma separated submission IDs.
+func ReviewKey(output OutputType, ids string, query url.Values) string {
+	return fmt.Sprintf("%s:review:%s:%s:%s?%s", echo.MIMEApplicationJSON, CacheVersion(), output, ids, query.Encode())
+}
+
+// parametersKey is the cache key of the metadata derived by RetrieveParams.
+func parametersKey(id int64) string {
+	return fmt.Sprintf("%s:parameters:%s:%d", echo.MIMEApplicationJSON, CacheVersion(), id)
+}
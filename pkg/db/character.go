@@ -0,0 +1,112 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Character is a named non-commercial character, such as a fursona, that belongs to an account.
+type Character struct {
+	ID      int64         `json:"id,omitempty"`
+	Name    string        `json:"name"`
+	Aliases []string      `json:"aliases,omitempty"` // other names the character is prompted with
+	Owner   string        `json:"owner"`             // username of the owner
+	OwnerID *int64        `json:"owner_id,omitempty"`
+	Matches []PromptMatch `json:"matches,omitempty"` // where the character was found in the prompts
+}
+
+var ErrMissingCharacter = errors.New("error: character not found")
+
+// Character statements
+const (
+	// selectCharacters statement for Character
+	selectCharacters = `SELECT character_id, name, aliases, owner, owner_id FROM characters ORDER BY character_id;`
+
+	// insertCharacter statement for Character
+	insertCharacter = `
+	INSERT INTO characters (name, aliases, owner, owner_id) VALUES (?, ?, ?, ?)
+	RETURNING character_id;
+	`
+
+	// updateCharacter statement for Character
+	updateCharacter = `UPDATE characters SET name = ?, aliases = ?, owner = ?, owner_id = ? WHERE character_id = ?;`
+
+	deleteCharacter = `DELETE FROM characters WHERE character_id = ?;`
+)
+
+// AllCharacters returns every registered character, or nil if they can't be read.
+func (db Sqlite) AllCharacters() []Character {
+	rows, err := db.QueryContext(db.context, selectCharacters)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	var characters []Character
+	for rows.Next() {
+		var (
+			character Character
+			aliases   *string
+		)
+		if err := rows.Scan(&character.ID, &character.Name, &aliases, &character.Owner, &character.OwnerID); err != nil {
+			return nil
+		}
+		if aliases != nil {
+			if err := json.Unmarshal([]byte(*aliases), &character.Aliases); err != nil {
+				return nil
+			}
+		}
+		characters = append(characters, character)
+	}
+
+	return characters
+}
+
+// UpsertCharacter stores a new character if its ID is 0, otherwise it replaces the stored one.
+// It returns the ID of the character, or ErrMissingCharacter if there is nothing to replace.
+func (db Sqlite) UpsertCharacter(character Character) (int64, error) {
+	if character.Name == "" {
+		return 0, errors.New("error: missing character name")
+	}
+	if character.Owner == "" {
+		return 0, errors.New("error: missing character owner")
+	}
+
+	aliases, err := marshalNonEmpty(character.Aliases)
+	if err != nil {
+		return 0, err
+	}
+
+	if character.ID == 0 {
+		var id int64
+		err := db.QueryRowContext(db.context, insertCharacter,
+			character.Name, aliases, character.Owner, character.OwnerID).Scan(&id)
+		if err != nil {
+			return 0, fmt.Errorf("error: inserting character: %w", err)
+		}
+		return id, nil
+	}
+
+	result, err := db.ExecContext(db.context, updateCharacter,
+		character.Name, aliases, character.Owner, character.OwnerID, character.ID)
+	if err != nil {
+		return 0, fmt.Errorf("error: updating character: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return 0, ErrMissingCharacter
+	}
+	return character.ID, nil
+}
+
+// DeleteCharacter removes the character with id, or returns ErrMissingCharacter if there is none.
+func (db Sqlite) DeleteCharacter(id int64) error {
+	result, err := db.ExecContext(db.context, deleteCharacter, id)
+	if err != nil {
+		return fmt.Errorf("error: deleting character: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrMissingCharacter
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ArtistConsent records an artist allowing the use of their name in prompts.
+// Empty Users and Characters mean the grant covers every user and every prompt.
+type ArtistConsent struct {
+	ID         int64      `json:"id,omitempty"`
+	Artist     string     `json:"artist"`
+	GrantedBy  string     `json:"granted_by"`           // usually the artist, or staff relaying the permission
+	Users      []string   `json:"users,omitempty"`      // usernames allowed to use the artist
+	Characters []string   `json:"characters,omitempty"` // the prompt has to mention one of these
+	Source     string     `json:"source,omitempty"`     // link to where the permission was given
+	Expires    *time.Time `json:"expires,omitempty"`
+	Created    time.Time  `json:"created"`
+}
+
+var ErrMissingConsent = errors.New("error: artist consent not found")
+
+// Artist consent statements
+const (
+	selectArtistConsentColumns = `SELECT consent_id, artist, granted_by, users, characters, source, expires_at, created_at FROM artist_consents`
+
+	// selectArtistConsents statement for ArtistConsent
+	selectArtistConsents         = selectArtistConsentColumns + ` ORDER BY consent_id;`
+	selectArtistConsentsByArtist = selectArtistConsentColumns + ` WHERE lower(artist) = lower(?) ORDER BY consent_id;`
+
+	// insertArtistConsent statement for ArtistConsent
+	insertArtistConsent = `
+	INSERT INTO artist_consents (artist, granted_by, users, characters, source, expires_at, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	RETURNING consent_id;
+	`
+
+	// updateArtistConsent statement for ArtistConsent
+	updateArtistConsent = `
+	UPDATE artist_consents
+	SET artist = ?, granted_by = ?, users = ?, characters = ?, source = ?, expires_at = ?
+	WHERE consent_id = ?;
+	`
+
+	deleteArtistConsent = `DELETE FROM artist_consents WHERE consent_id = ?;`
+)
+
+// Expired reports whether the consent no longer applies at t.
+func (c ArtistConsent) Expired(t time.Time) bool {
+	return c.Expires != nil && !t.Before(*c.Expires)
+}
+
+// Covers reports whether the consent allows username to use the artist in prompt at time t.
+func (c ArtistConsent) Covers(username, prompt string, t time.Time) bool {
+	if c.Expired(t) {
+		return false
+	}
+
+	if len(c.Users) > 0 && !slices.ContainsFunc(c.Users, func(user string) bool {
+		return strings.EqualFold(strings.TrimPrefix(user, "@"), username)
+	}) {
+		return false
+	}
+
+	if len(c.Characters) == 0 {
+		return true
+	}
+	for _, character := range c.Characters {
+		if character == "" {
+			continue
+		}
+		re, err := regexp.Compile(fmt.Sprintf(`(?i)\b%s\b`, regexp.QuoteMeta(character)))
+		if err != nil {
+			continue
+		}
+		if re.MatchString(prompt) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetArtistConsents returns the consents recorded for artist, or every consent if artist is empty.
+func (db Sqlite) GetArtistConsents(artist string) ([]ArtistConsent, error) {
+	var (
+		rows *sql.Rows
+		err  error
+	)
+	if artist == "" {
+		rows, err = db.QueryContext(db.context, selectArtistConsents)
+	} else {
+		rows, err = db.QueryContext(db.context, selectArtistConsentsByArtist, artist)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error: querying artist consents: %w", err)
+	}
+	defer rows.Close()
+
+	var consents []ArtistConsent
+	for rows.Next() {
+		var (
+			consent    ArtistConsent
+			users      *string
+			characters *string
+			source     *string
+			expiresAt  *string
+			createdAt  string
+		)
+		err := rows.Scan(&consent.ID, &consent.Artist, &consent.GrantedBy, &users, &characters, &source, &expiresAt, &createdAt)
+		if err != nil {
+			return nil, fmt.Errorf("error: scanning artist consent: %w", err)
+		}
+		if users != nil {
+			if err := json.Unmarshal([]byte(*users), &consent.Users); err != nil {
+				return nil, fmt.Errorf("error: unmarshaling users: %w", err)
+			}
+		}
+		if characters != nil {
+			if err := json.Unmarshal([]byte(*characters), &consent.Characters); err != nil {
+				return nil, fmt.Errorf("error: unmarshaling characters: %w", err)
+			}
+		}
+		if source != nil {
+			consent.Source = *source
+		}
+		if expiresAt != nil {
+			expires, err := time.Parse(time.RFC3339Nano, *expiresAt)
+			if err != nil {
+				return nil, fmt.Errorf("error: parsing time: %w", err)
+			}
+			consent.Expires = &expires
+		}
+		consent.Created, err = time.Parse(time.RFC3339Nano, createdAt)
+		if err != nil {
+			return nil, fmt.Errorf("error: parsing time: %w", err)
+		}
+		consents = append(consents, consent)
+	}
+
+	return consents, rows.Err()
+}
+
+// UpsertArtistConsent stores a new consent if its ID is 0, otherwise it replaces the stored one.
+// It returns the ID of the consent, or ErrMissingConsent if there is nothing to replace.
+func (db Sqlite) UpsertArtistConsent(consent ArtistConsent) (int64, error) {
+	if consent.Artist == "" {
+		return 0, errors.New("error: missing artist")
+	}
+	if consent.GrantedBy == "" {
+		return 0, errors.New("error: missing who granted the consent")
+	}
+
+	users, err := marshalNonEmpty(consent.Users)
+	if err != nil {
+		return 0, err
+	}
+	characters, err := marshalNonEmpty(consent.Characters)
+	if err != nil {
+		return 0, err
+	}
+	var expires any
+	if consent.Expires != nil {
+		expires = parseTime(*consent.Expires)
+	}
+
+	if consent.ID == 0 {
+		created := consent.Created
+		if created.IsZero() {
+			created = time.Now()
+		}
+		var id int64
+		err := db.QueryRowContext(db.context, insertArtistConsent,
+			consent.Artist, consent.GrantedBy, users, characters, nullString(consent.Source), expires, parseTime(created),
+		).Scan(&id)
+		if err != nil {
+			return 0, fmt.Errorf("error: inserting artist consent: %w", err)
+		}
+		return id, nil
+	}
+
+	result, err := db.ExecContext(db.context, updateArtistConsent,
+		consent.Artist, consent.GrantedBy, users, characters, nullString(consent.Source), expires, consent.ID)
+	if err != nil {
+		return 0, fmt.Errorf("error: updating artist consent: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return 0, ErrMissingConsent
+	}
+	return consent.ID, nil
+}
+
+// DeleteArtistConsent removes the consent with id, or returns ErrMissingConsent if there is none.
+func (db Sqlite) DeleteArtistConsent(id int64) error {
+	result, err := db.ExecContext(db.context, deleteArtistConsent, id)
+	if err != nil {
+		return fmt.Errorf("error: deleting artist consent: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrMissingConsent
+	}
+	return nil
+}
+
+// withConsents sets the Consents of every artist from consents.
+func withConsents(artists []Artist, consents []ArtistConsent) {
+	byArtist := make(map[string][]ArtistConsent)
+	for _, consent := range consents {
+		key := strings.ToLower(consent.Artist)
+		byArtist[key] = append(byArtist[key], consent)
+	}
+	for i := range artists {
+		artists[i].Consents = byArtist[strings.ToLower(artists[i].Username)]
+	}
+}
+
+func marshalNonEmpty(s []string) (any, error) {
+	if len(s) == 0 {
+		return nil, nil
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		return nil, fmt.Errorf("error: marshaling %v: %w", s, err)
+	}
+	return string(b), nil
+}
@@ -52,9 +52,16 @@ var user = func() *api.Credentials {
 
 var ticket *db.Ticket
 
-var sqlite, _ = db.New(context.WithValue(context.Background(), "filename", "dev.sqlite"))
+var sqlite *db.Sqlite
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		migrate(os.Args[2:])
+		return
+	}
+	if sqlite == nil {
+		sqlite, _ = db.New(context.WithValue(context.Background(), "filename", "dev.sqlite"))
+	}
 	options()
 }
 
@@ -281,7 +288,7 @@ func ParseDataset(file utils.NameContent) utils.NameContent {
 
 func setTicketStatus() {
 	ticket.Closed = !ticket.Closed
-	_, err := sqlite.UpsertTicket(*ticket)
+	_, err := sqlite.UpsertTicket(*ticket, nil)
 	if err != nil {
 		log.Printf("could not update ticket: %v", err)
 		options()
@@ -500,7 +507,7 @@ func newTicket() {
 		},
 	}
 
-	_, err = sqlite.UpsertTicket(ticket)
+	_, err = sqlite.UpsertTicket(ticket, nil)
 	if err != nil {
 		log.Fatalf("could not insert ticket: %v", err)
 	}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/ellypaws/inkbunny-app/pkg/db"
+)
+
+// migrate inspects or changes the schema version of a database without starting the interactive menu.
+//
+//	go run ./pkg/db/dev migrate status
+//	go run ./pkg/db/dev migrate -dry-run to 8
+//	go run ./pkg/db/dev migrate -db audits.sqlite up
+func migrate(args []string) {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	filename := fs.String("db", "dev.sqlite", "database file")
+	dryRun := fs.Bool("dry-run", false, "print the steps without applying them")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: dev migrate [-db file] [-dry-run] status | up | to <version>")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	ctx := context.WithValue(context.Background(), "filename", *filename)
+	database, err := db.New(context.WithValue(ctx, "migrate", false))
+	if err != nil {
+		log.Fatalf("could not open %s: %v", *filename, err)
+	}
+	defer database.Close()
+
+	switch fs.Arg(0) {
+	case "", "status":
+		status, err := database.MigrationStatus()
+		if err != nil {
+			log.Fatalf("could not get migration status: %v", err)
+		}
+		for _, m := range status {
+			state := "pending"
+			if m.Applied {
+				state = "applied"
+				if m.AppliedAt != nil {
+					state = fmt.Sprintf("applied %s", m.AppliedAt.Format("2006-01-02 15:04:05"))
+				}
+			}
+			if m.Modified {
+				state += " (modified)"
+			}
+			fmt.Printf("%3d  %-40s %s\n", m.Version, m.Name, state)
+		}
+	case "up":
+		runMigration(database, db.LatestMigration(), *dryRun)
+	case "to":
+		version, err := strconv.Atoi(fs.Arg(1))
+		if err != nil {
+			fs.Usage()
+			os.Exit(2)
+		}
+		runMigration(database, version, *dryRun)
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+}
+
+func runMigration(database *db.Sqlite, version int, dryRun bool) {
+	steps, err := database.MigrateTo(version, dryRun)
+	for _, step := range steps {
+		if dryRun {
+			fmt.Printf("would run %s\n", step)
+		} else {
+			fmt.Printf("ran %s\n", step)
+		}
+	}
+	if err != nil {
+		log.Fatalf("could not migrate to %d: %v", version, err)
+	}
+	if len(steps) == 0 {
+		fmt.Printf("already at version %d\n", version)
+	}
+}
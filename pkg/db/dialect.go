@@ -0,0 +1,89 @@
+package db
+
+import (
+	"regexp"
+)
+
+// dialect is the SQL flavour spoken by the database behind a [Sqlite].
+// Queries and migrations are written for SQLite and rewritten for the others.
+type dialect int
+
+const (
+	dialectSqlite dialect = iota
+	dialectPostgres
+)
+
+func (d dialect) String() string {
+	switch d {
+	case dialectPostgres:
+		return "postgres"
+	default:
+		return "sqlite"
+	}
+}
+
+// bind rewrites placeholders of a query written for SQLite, e.g. when it runs on a transaction instead of through [Sqlite].
+func (d dialect) bind(query string) string {
+	if d == dialectPostgres {
+		return rebind(query)
+	}
+	return query
+}
+
+// migrations returns the migrations rendered for the dialect.
+func (d dialect) migrations() []Migration {
+	if d == dialectPostgres {
+		return postgresMigrations
+	}
+	return migrations
+}
+
+func (d dialect) schemaMigrationsExists() string {
+	if d == dialectPostgres {
+		return selectSchemaMigrationsExistsPG
+	}
+	return selectSchemaMigrationsExists
+}
+
+// postgresTypes maps SQLite column types to their Postgres equivalent, in order.
+var postgresTypes = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`\bINTEGER PRIMARY KEY AUTOINCREMENT\b`), "BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY"},
+	{regexp.MustCompile(`\bINTEGER\b`), "BIGINT"},
+	{regexp.MustCompile(`\bBLOB\b`), "TEXT"},
+}
+
+// translate rewrites an SQLite script for the dialect.
+// Only column types are rewritten, scripts using anything else specific to SQLite need an override, see [Migration].
+func (d dialect) translate(script string) string {
+	if d != dialectPostgres {
+		return script
+	}
+	for _, t := range postgresTypes {
+		script = t.pattern.ReplaceAllString(script, t.replacement)
+	}
+	return script
+}
+
+// render returns the migration as it runs on the dialect, with overrides applied and the SQL translated.
+func (d dialect) render(m Migration) Migration {
+	if d != dialectPostgres {
+		return m
+	}
+	up, down := d.translate(m.Up), d.translate(m.Down)
+	if m.PostgresUp != "" {
+		up = m.PostgresUp
+	}
+	if m.PostgresDown != "" {
+		down = m.PostgresDown
+	}
+	return Migration{
+		Name:     m.Name,
+		Up:       up,
+		Down:     down,
+		UpFunc:   m.UpFunc,
+		DownFunc: m.DownFunc,
+	}
+}
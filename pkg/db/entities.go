@@ -1,6 +1,9 @@
 package db
 
 import (
+	"bytes"
+	"encoding/json"
+	"math/bits"
 	"time"
 
 	"github.com/ellypaws/inkbunny/api"
@@ -74,6 +77,9 @@ const (
 	FlagUndisclosed   Flag = "undisclosed"
 	FlagTooMany       Flag = "too_many"
 
+	// FlagMissingImg2ImgInput is a Flag when an img2img work does not include the original input
+	FlagMissingImg2ImgInput Flag = "missing_img2img_input"
+
 	// FlagMismatched is a Flag when the prompt do not generate close to the Submission
 	FlagMismatched Flag = "mismatched"
 )
@@ -321,8 +327,42 @@ type Metadata struct {
 	PrivateLora  bool     `json:"private_lora"`           // FlagPrivateLora
 	PrivateTool  bool     `json:"private_tool"`           // FlagPrivateTool
 	SoldArt      bool     `json:"sold_art"`               // FlagSoldArt
+	TooMany      bool     `json:"too_many"`               // FlagTooMany
+
+	// ArtistConsented are artists found in the prompt that allowed the use, with the covering consents.
+	// They are informational and not part of FlagArtistUsed.
+	ArtistConsented []Artist `json:"artists_consented,omitempty"`
+
+	CharacterUsed []Character `json:"characters_used,omitempty"` // FlagCharacterUsed
+
+	// PrivateLoras and PrivateModels are the hashes that set PrivateLora and PrivateModel,
+	// found neither in the models table nor on CivitAI.
+	PrivateLoras  []string `json:"private_loras,omitempty"`
+	PrivateModels []string `json:"private_models,omitempty"`
+
+	// MissingToolTags and MissingModelTags are the keywords for the tools and checkpoints found in the objects
+	// that the submission isn't tagged with. SuggestedKeywords also includes the missing AI keywords.
+	MissingToolTags   []string `json:"missing_tool_tags,omitempty"`
+	MissingModelTags  []string `json:"missing_model_tags,omitempty"`
+	SuggestedKeywords []string `json:"suggested_keywords,omitempty"`
+
+	// MissingImg2ImgInput is set when img2img was used, but no page looks like the input. FlagMissingImg2ImgInput
+	MissingImg2ImgInput bool `json:"missing_img2img_input"`
+	// Img2ImgInputs are the file names of the pages taken as the input of an img2img work.
+	Img2ImgInputs []string `json:"img2img_inputs,omitempty"`
+
+	// ForSale is set when the Inkbunny digital or print sales of the submission are enabled.
+	ForSale bool `json:"for_sale,omitempty"`
+	// SoldArtEvidence are the signals that set SoldArt. Tip jar links on their own are not a sale.
+	SoldArtEvidence []SaleEvidence `json:"sold_art_evidence,omitempty"`
+
+	ContentRepost bool     `json:"content_repost"`    // FlagContentRepost
+	Reposts       []Repost `json:"reposts,omitempty"` // Earlier postings of the same files
 
 	Generator string `json:"generator,omitempty"`
+	Parser    string `json:"parser,omitempty"` // the registered parser that read the parameters
+	// Version of the heuristics and rules the metadata was derived with, empty before versions were recorded.
+	Version string `json:"version,omitempty"`
 
 	Params utils.Params `json:"params,omitempty"`
 
@@ -345,6 +385,47 @@ type SIDHash struct {
 
 type HashID map[string]int64
 
+// SubmissionVersion is a snapshot of a reviewed Submission and the labels it had at the time.
+type SubmissionVersion struct {
+	ID           int64         `json:"version_id"`
+	SubmissionID int64         `json:"submission_id"`
+	StoredAt     time.Time     `json:"stored_at"`
+	Submission   Submission    `json:"submission"`
+	Labels       []TicketLabel `json:"labels,omitempty"`
+}
+
+// Reevaluation is a finished run over the stored submissions that derived the metadata of an older version again.
+type Reevaluation struct {
+	ID        int64     `json:"id,omitempty"`
+	Version   string    `json:"version"` // the version the submissions were brought to
+	Started   time.Time `json:"started"`
+	Finished  time.Time `json:"finished"`
+	Evaluated int       `json:"evaluated"`
+	Changed   int       `json:"changed"` // submissions whose labels changed
+	Error     string    `json:"error,omitempty"`
+}
+
+// FileHash is the exact and perceptual hash of a posted image, used to find reposts.
+type FileHash struct {
+	FileID       int64     `json:"file_id"`
+	SubmissionID int64     `json:"submission_id"`
+	UserID       int64     `json:"user_id"`
+	MD5          string    `json:"md5"`
+	PHash        uint64    `json:"phash,omitempty"` // 0 if the image could not be hashed
+	Posted       time.Time `json:"posted"`
+}
+
+// Repost is an earlier posting of the same or a near-identical image by the same user.
+type Repost struct {
+	FileHash
+	Distance int `json:"distance"` // Hamming distance between the perceptual hashes, 0 when the MD5 matched
+}
+
+// HashDistance returns the number of differing bits between two perceptual hashes.
+func HashDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
 type ModelHashes map[string][]string
 
 type Ticket struct {
@@ -368,6 +449,91 @@ func (t Ticket) Auditor() *Auditor {
 	return t.auditor
 }
 
+// TicketEvent is an entry in the append-only history of a Ticket.
+// Field is the changed json field of the ticket, or TicketCreated and TicketDeleted with the whole ticket as New or Old.
+type TicketEvent struct {
+	ID       int64           `json:"event_id"`
+	TicketID int64           `json:"ticket_id"`
+	ActorID  *int64          `json:"actor_id,omitempty"` // Auditor ID
+	Actor    string          `json:"actor,omitempty"`    // Auditor username at the time of the change
+	Time     time.Time       `json:"time"`
+	Field    string          `json:"field"`
+	Old      json.RawMessage `json:"old,omitempty"`
+	New      json.RawMessage `json:"new,omitempty"`
+}
+
+const (
+	TicketCreated = "created"
+	TicketDeleted = "deleted"
+)
+
+// Roles of the users involved in a Ticket
+const (
+	TicketReporter = "reporter"
+	TicketReported = "reported"
+)
+
+// TicketChanges returns an event for every field that differs between before and after, made by actor.
+// A nil before is a created ticket and a nil after a deleted one.
+func TicketChanges(before, after *Ticket, actor *Auditor) []TicketEvent {
+	event := TicketEvent{Time: time.Now().UTC()}
+	if actor != nil {
+		event.Actor = actor.Username
+		if actor.UserID != 0 {
+			event.ActorID = &actor.UserID
+		}
+	}
+
+	switch {
+	case before == nil && after == nil:
+		return nil
+	case before == nil:
+		event.TicketID = after.ID
+		event.Field = TicketCreated
+		event.New, _ = json.Marshal(after)
+		return []TicketEvent{event}
+	case after == nil:
+		event.TicketID = before.ID
+		event.Field = TicketDeleted
+		event.Old, _ = json.Marshal(before)
+		return []TicketEvent{event}
+	}
+
+	fields := []struct {
+		name     string
+		old, new any
+	}{
+		{"subject", before.Subject, after.Subject},
+		{"date_opened", before.DateOpened, after.DateOpened},
+		{"date_closed", before.DateClosed, after.DateClosed},
+		{"status", before.Status, after.Status},
+		{"labels", before.Labels, after.Labels},
+		{"priority", before.Priority, after.Priority},
+		{"closed", before.Closed, after.Closed},
+		{"flags", before.Flags, after.Flags},
+		{"responses", before.Responses, after.Responses},
+		{"submission_ids", before.SubmissionIDs, after.SubmissionIDs},
+		{"assigned_id", before.AssignedID, after.AssignedID},
+		{"involved", before.UsersInvolved, after.UsersInvolved},
+	}
+
+	var events []TicketEvent
+	for _, field := range fields {
+		oldValue, _ := json.Marshal(field.old)
+		newValue, _ := json.Marshal(field.new)
+		if bytes.Equal(oldValue, newValue) {
+			continue
+		}
+		e := event
+		e.TicketID = after.ID
+		e.Field = field.name
+		e.Old = oldValue
+		e.New = newValue
+		events = append(events, e)
+	}
+	return events
+}
+
 type TicketLabel string
 
 const (
@@ -385,13 +551,18 @@ const (
 	LabelMissingSeed   TicketLabel = "missing_seed"
 	LabelMissingModel  TicketLabel = "missing_model"
 	LabelArtistUsed    TicketLabel = "artist_used"
+	LabelCharacterUsed TicketLabel = "character_used"
 	LabelPrivateModel  TicketLabel = "private_model"
 	LabelPrivateLora   TicketLabel = "private_lora"
 	LabelPrivateTool   TicketLabel = "private_tool"
 	LabelSoldArt       TicketLabel = "sold_art"
 	LabelPayMention    TicketLabel = "payment_mention"
+	LabelTooMany       TicketLabel = "too_many" // More than six images were posted with the same prompt
+	LabelContentRepost TicketLabel = "content_repost"
+
+	LabelMissingImg2ImgInput TicketLabel = "missing_img2img_input" // No page looks like the input of an img2img work
 
-	// LabelBeforeRuleRevision is a [TicketLabel] for submissions before November 21, 2022.
+	// LabelBeforeRuleRevision is a [TicketLabel] for submissions posted before the first ACP revision of the rules, November 21, 2022.
 	// An [announcement] was made on 11/20/2022 21:13 UTC which revised the rules for AI submissions.
 	// "Best effort" for sketches/prompts on work posted before November 21, but keywords are required.
 	// Continuous [revisions] might have been made in the [ACP] since the original draft, which should be monitored.
@@ -400,6 +571,13 @@ const (
 	// [revisions]: https://wiki.inkbunny.net/w/index.php?title=ACP&diff=cur&oldid=1082
 	// [ACP]: https://wiki.inkbunny.net/wiki/ACP#AI
 	LabelBeforeRuleRevision TicketLabel = "before_rule_revision"
+
+	// LabelACPRevision prefixes the [TicketLabel] naming the ACP revision a submission was reviewed against,
+	// added when a rule introduced by a revision matched, e.g. "acp_revision:2022-11-21".
+	LabelACPRevision TicketLabel = "acp_revision"
+	// LabelInformational prefixes the labels of rules introduced by a revision after the submission was posted,
+	// e.g. "info:missing_prompt". They don't count against the submission.
+	LabelInformational TicketLabel = "info"
 )
 
 var Nov21 = time.Date(2022, time.November, 21, 0, 0, 0, 0, time.UTC)
@@ -417,8 +595,34 @@ type Involved struct {
 }
 
 type Artist struct {
-	Username string `json:"username" query:"username"`
-	UserID   *int64 `json:"user_id,omitempty" query:"user_id"`
+	Username string          `json:"username" query:"username"`
+	UserID   *int64          `json:"user_id,omitempty" query:"user_id"`
+	Aliases  []string        `json:"aliases,omitempty"`  // other names the artist is prompted with
+	Consents []ArtistConsent `json:"consents,omitempty"` // permissions to use the artist, see ArtistConsent.Covers
+	Matches  []PromptMatch   `json:"matches,omitempty"`  // where the artist was found in the prompts
+}
+
+// SaleEvidence is a signal that a submission is being sold, see Metadata.SoldArt.
+type SaleEvidence struct {
+	Source  string `json:"source"`  // SaleListing, SaleTitle, SaleDescription or SaleKeyword
+	Signal  string `json:"signal"`  // the matched offer or price
+	Snippet string `json:"snippet"` // the text around the signal
+}
+
+const (
+	SaleListing     = "listing"
+	SaleTitle       = "title"
+	SaleDescription = "description"
+	SaleKeyword     = "keyword"
+)
+
+// PromptMatch is where an artist or character was found in a prompt.
+type PromptMatch struct {
+	Alias    string `json:"alias"`              // the username or alias that matched
+	Object   string `json:"object"`             // key in Metadata.Objects, usually the file name
+	Negative bool   `json:"negative,omitempty"` // found in the negative prompt
+	Start    int    `json:"start"`              // byte offsets of the match in the prompt
+	End      int    `json:"end"`
 }
 
 const TicketDateLayout = "2006-01-02"
@@ -2,6 +2,7 @@ package db
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
 	"database/sql"
 	"encoding/json"
@@ -119,7 +120,8 @@ const (
 	// newTicket statement for Ticket
 	newTicket = `
 	INSERT INTO tickets (subject, date_opened, date_closed, status, labels, priority, flags, closed, responses, submissions_ids, auditor_id, involved)
-	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	RETURNING ticket_id;
 	`
 
 	// upsertTicketReport statement for TicketReport
@@ -136,6 +138,10 @@ const (
 	// deleteTicket statement for Ticket
 	deleteTicket = `DELETE FROM tickets WHERE ticket_id = ?;`
 
+	// lockTicketPG holds the row of a ticket until the transaction ends, so its history is written against the row it replaces.
+	// SQLite doesn't need it as it only allows one writer.
+	lockTicketPG = `SELECT ticket_id FROM tickets WHERE ticket_id = $1 FOR UPDATE;`
+
 	// insertSIDHash statement for SIDHash
 	insertSIDHash = `
 	INSERT INTO sids (sid_hash, auditor_id) VALUES (?, ?)
@@ -160,13 +166,64 @@ const (
 
 	// upsertArtist statement for Artist
 	upsertArtist = `
-	INSERT INTO artists (username, user_id) VALUES (?, ?)
-	ON CONFLICT(username) DO UPDATE SET user_id=excluded.user_id;
+	INSERT INTO artists (username, user_id, aliases) VALUES (?, ?, ?)
+	ON CONFLICT(username) DO UPDATE SET user_id=excluded.user_id, aliases=excluded.aliases;
 	`
 
 	// deleteArtist statement for Artist
 	deleteArtist         = `DELETE FROM artists WHERE user_id = ?;`
 	deleteArtistUsername = `DELETE FROM artists WHERE username = ?;`
+
+	// insertSubmissionVersion statement for SubmissionVersion
+	insertSubmissionVersion = `
+	INSERT INTO submission_history (submission_id, stored_at, submission, labels)
+	VALUES (?, ?, ?, ?);
+	`
+
+	// insertReevaluation statement for Reevaluation
+	insertReevaluation = `
+	INSERT INTO reevaluations (version, started_at, finished_at, evaluated, changed, error)
+	VALUES (?, ?, ?, ?, ?, ?);
+	`
+
+	// insertTicketLabel statement for the labels of a Ticket
+	insertTicketLabel = `INSERT INTO ticket_labels (ticket_id, label) VALUES (?, ?) ON CONFLICT DO NOTHING;`
+	// insertTicketFlag statement for the flags of a Ticket
+	insertTicketFlag = `INSERT INTO ticket_flags (ticket_id, flag) VALUES (?, ?) ON CONFLICT DO NOTHING;`
+	// insertTicketSubmission statement for the submissions of a Ticket
+	insertTicketSubmission = `INSERT INTO ticket_submissions (ticket_id, submission_id) VALUES (?, ?) ON CONFLICT DO NOTHING;`
+	// insertTicketUser statement for the users involved in a Ticket
+	insertTicketUser = `INSERT INTO ticket_users (ticket_id, role, user_id, username) VALUES (?, ?, ?, ?) ON CONFLICT DO NOTHING;`
+
+	deleteTicketLabels      = `DELETE FROM ticket_labels WHERE ticket_id = ?;`
+	deleteTicketFlags       = `DELETE FROM ticket_flags WHERE ticket_id = ?;`
+	deleteTicketSubmissions = `DELETE FROM ticket_submissions WHERE ticket_id = ?;`
+	deleteTicketUsers       = `DELETE FROM ticket_users WHERE ticket_id = ?;`
+
+	// resetTicketSequence moves the Postgres identity past tickets inserted with an explicit id
+	resetTicketSequence = `SELECT setval(pg_get_serial_sequence('tickets', 'ticket_id'), GREATEST((SELECT MAX(ticket_id) FROM tickets), 1));`
+
+	// insertTicketEvent statement for TicketEvent
+	insertTicketEvent = `
+	INSERT INTO ticket_events (ticket_id, actor_id, actor, created_at, field, old_value, new_value)
+	VALUES (?, ?, ?, ?, ?, ?, ?);
+	`
+
+	// updateFileHashPosted statement for FileHash
+	updateFileHashPosted = `UPDATE file_hashes SET posted_at = ? WHERE file_id = ?;`
+
+	// upsertFileHash statement for FileHash
+	upsertFileHash = `
+	INSERT INTO file_hashes (file_id, submission_id, user_id, md5, phash, posted_at)
+	VALUES (?, ?, ?, ?, ?, ?)
+	ON CONFLICT(file_id)
+		DO UPDATE SET
+					  submission_id=excluded.submission_id,
+					  user_id=excluded.user_id,
+					  md5=excluded.md5,
+					  phash=excluded.phash,
+					  posted_at=excluded.posted_at;
+	`
 )
 
 func (db Sqlite) InsertAuditor(auditor Auditor) error {
@@ -234,7 +291,8 @@ func (db Sqlite) InsertAudit(audit Audit) (int64, error) {
 		return 0, fmt.Errorf("error: getting audit by submission id: %w", err)
 	}
 
-	if id, err := res.LastInsertId(); err != nil && id != audit.ID() {
+	// Postgres drivers don't report LastInsertId
+	if id, err := res.LastInsertId(); err != nil && id != audit.ID() && db.dialect != dialectPostgres {
 		return 0, fmt.Errorf("error: last insert id does not match audit id: %w", err)
 	}
 
@@ -316,11 +374,33 @@ const (
 )
 
 func (db Sqlite) InsertSubmission(submission Submission) error {
+	args, err := db.submissionArgs(submission)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTx(db.context, nil)
+	if err != nil {
+		return err
+	}
+
+	// nolint
+	defer tx.Rollback()
+
+	if err := upsertSubmissionTx(db.context, tx, db.dialect, submission, args); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// submissionArgs returns the arguments of upsertSubmission, linking the submission to its audit if it has one.
+func (db Sqlite) submissionArgs(submission Submission) ([]any, error) {
 	if submission.AuditID == nil {
 		audit, err := db.GetAuditBySubmissionID(submission.ID)
 		if err != nil {
 			if !errors.Is(err, sql.ErrNoRows) {
-				return fmt.Errorf("error: getting audit by submission id: %w", err)
+				return nil, fmt.Errorf("error: getting audit by submission id: %w", err)
 			}
 		} else {
 			submission.AuditID = &audit.id
@@ -334,15 +414,19 @@ func (db Sqlite) InsertSubmission(submission Submission) error {
 		submission.Metadata, submission.Ratings, submission.Keywords, submission.Files,
 	)
 	if err != nil {
-		return fmt.Errorf("error: asserting metadata: %w", err)
+		return nil, fmt.Errorf("error: asserting metadata: %w", err)
 	}
+	return args, nil
+}
 
-	_, err = db.ExecContext(db.context, upsertSubmission, args...)
+// upsertSubmissionTx upserts the submission with args from [Sqlite.submissionArgs] and indexes it inside tx.
+func upsertSubmissionTx(ctx context.Context, tx *sql.Tx, d dialect, submission Submission, args []any) error {
+	_, err := tx.ExecContext(ctx, d.bind(upsertSubmission), args...)
 	if err != nil {
 		return fmt.Errorf("error: inserting submission: %w", err)
 	}
 
-	return nil
+	return indexSubmission(ctx, tx, d, submission)
 }
 
 func (db Sqlite) UpdateDescription(submission Submission) error {
@@ -358,49 +442,79 @@ var ErrTicketIsSet = errors.New("error: ticket id is set but InsertTicket was ca
 // The ID is expected to be non-zero as it's a new ticket.
 // This ensures that InsertTicket is only for new tickets.
 // Set force to true to unset the ticket ID and always insert a new ticket.
-func (db Sqlite) InsertTicket(ticket Ticket, force ...bool) (int64, error) {
+func (db Sqlite) InsertTicket(ticket Ticket, actor *Auditor, force ...bool) (int64, error) {
 	if len(force) > 0 && force[0] {
 		ticket.ID = 0
 	}
 	if ticket.ID != 0 {
 		return 0, ErrTicketIsSet
 	}
-	return db.UpsertTicket(ticket)
+	return db.UpsertTicket(ticket, actor)
 }
 
 // UpsertTicket inserts or updates a ticket in the database.
 // If the ticket ID is unset, it will insert a new ticket.
-func (db Sqlite) UpsertTicket(ticket Ticket) (int64, error) {
+// The changes to the stored ticket are added to its history as made by actor, in the same transaction.
+func (db Sqlite) UpsertTicket(ticket Ticket, actor *Auditor) (int64, error) {
 	args, err := assertArgs(
 		ticket.ID, ticket.Subject,
 		ticket.DateOpened, ticket.DateClosed,
 		ticket.Status, ticket.Labels, ticket.Priority, ticket.Flags, ticket.Closed,
 		ticket.Responses, ticket.SubmissionIDs, ticket.AssignedID, ticket.UsersInvolved,
 	)
-
-	var isInsert bool = ticket.ID == 0
-	var query string = upsertTicket
-	if isInsert {
-		query = newTicket
-		args = args[1:]
+	if err != nil {
+		return 0, fmt.Errorf("error: asserting ticket: %w", err)
 	}
-	res, err := db.ExecContext(db.context, query, args...)
+
+	tx, err := db.BeginTx(db.context, nil)
 	if err != nil {
-		var process string = "up"
-		if isInsert {
-			process = "in"
+		return 0, err
+	}
+
+	// nolint
+	defer tx.Rollback()
+
+	var before *Ticket
+	if ticket.ID != 0 {
+		stored, err := lockTicket(db.context, tx, db.dialect, ticket.ID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return 0, err
+		}
+		if err == nil {
+			before = &stored
 		}
-		return 0, fmt.Errorf("error: %vserting ticket: %w", process, err)
 	}
 
-	if isInsert {
-		id, err := res.LastInsertId()
-		if err != nil && id != ticket.ID {
-			return 0, fmt.Errorf("error: last insert id %v does not match ticket id: %v: %w", id, ticket.ID, err)
+	if ticket.ID == 0 {
+		err = tx.QueryRowContext(db.context, db.rebind(newTicket), args[1:]...).Scan(&ticket.ID)
+		if err != nil {
+			return 0, fmt.Errorf("error: inserting ticket: %w", err)
+		}
+	} else {
+		_, err = tx.ExecContext(db.context, db.rebind(upsertTicket), args...)
+		if err != nil {
+			return 0, fmt.Errorf("error: upserting ticket: %w", err)
 		}
+		if db.dialect == dialectPostgres {
+			if _, err := tx.ExecContext(db.context, resetTicketSequence); err != nil {
+				return 0, fmt.Errorf("error: resetting ticket sequence: %w", err)
+			}
+		}
+	}
+
+	if err := syncTicketRelations(db.context, tx, db.dialect, ticket); err != nil {
+		return 0, err
+	}
+
+	if err := indexTicket(db.context, tx, db.dialect, ticket); err != nil {
+		return 0, err
+	}
+
+	if err := insertTicketEvents(db.context, tx, db.dialect, TicketChanges(before, &ticket, actor)); err != nil {
+		return 0, err
 	}
 
-	return ticket.ID, nil
+	return ticket.ID, tx.Commit()
 }
 
 func (db Sqlite) UpsertTicketReport(ticket TicketReport) error {
@@ -415,8 +529,34 @@ func (db Sqlite) UpsertTicketReport(ticket TicketReport) error {
 	return nil
 }
 
-func (db Sqlite) DeleteTicket(id int64) error {
-	result, err := db.ExecContext(db.context, deleteTicket, id)
+// DeleteTicket deletes a ticket and adds the deletion to its history as made by actor, in the same transaction.
+// The history of the ticket is kept. An error wrapping sql.ErrNoRows is returned if the ticket doesn't exist.
+func (db Sqlite) DeleteTicket(id int64, actor *Auditor) error {
+	tx, err := db.BeginTx(db.context, nil)
+	if err != nil {
+		return err
+	}
+
+	// nolint
+	defer tx.Rollback()
+
+	before, err := lockTicket(db.context, tx, db.dialect, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("error: ticket %d doesn't exist in the database: %w", id, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := clearTicketRelations(db.context, tx, db.dialect, id); err != nil {
+		return err
+	}
+
+	if err := unindexDocument(db.context, tx, db.dialect, SearchTicket, id); err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(db.context, db.rebind(deleteTicket), id)
 	if err != nil {
 		return fmt.Errorf("error: deleting ticket: %w", err)
 	}
@@ -427,12 +567,128 @@ func (db Sqlite) DeleteTicket(id int64) error {
 	}
 
 	if rows == 0 {
-		return fmt.Errorf("error: ticket %d doesn't exist in the database", id)
+		return fmt.Errorf("error: ticket %d doesn't exist in the database: %w", id, sql.ErrNoRows)
+	}
+
+	if err := insertTicketEvents(db.context, tx, db.dialect, TicketChanges(&before, nil, actor)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// lockTicket reads the stored ticket inside tx, locking its row on Postgres until tx ends.
+func lockTicket(ctx context.Context, tx *sql.Tx, d dialect, ticketID int64) (Ticket, error) {
+	if d == dialectPostgres {
+		if _, err := tx.ExecContext(ctx, lockTicketPG, ticketID); err != nil {
+			return Ticket{}, fmt.Errorf("error: locking ticket: %w", err)
+		}
+	}
+	return scanTicket(tx.QueryRowContext(ctx, d.bind(selectTicketByID), ticketID))
+}
+
+// syncTicketRelations replaces the rows of the ticket in ticket_labels, ticket_flags, ticket_submissions and ticket_users.
+func syncTicketRelations(ctx context.Context, tx *sql.Tx, d dialect, ticket Ticket) error {
+	if err := clearTicketRelations(ctx, tx, d, ticket.ID); err != nil {
+		return err
+	}
+
+	exec := func(query string, args ...any) error {
+		_, err := tx.ExecContext(ctx, d.bind(query), args...)
+		return err
+	}
+
+	for _, label := range ticket.Labels {
+		if err := exec(insertTicketLabel, ticket.ID, string(label)); err != nil {
+			return fmt.Errorf("error: inserting ticket label: %w", err)
+		}
+	}
+	for _, flag := range ticket.Flags {
+		if err := exec(insertTicketFlag, ticket.ID, string(flag)); err != nil {
+			return fmt.Errorf("error: inserting ticket flag: %w", err)
+		}
+	}
+	for _, submissionID := range ticket.SubmissionIDs {
+		if err := exec(insertTicketSubmission, ticket.ID, submissionID); err != nil {
+			return fmt.Errorf("error: inserting ticket submission: %w", err)
+		}
+	}
+
+	insertUser := func(role string, user api.UsernameID) error {
+		if user.UserID == "" && user.Username == "" {
+			return nil
+		}
+		if err := exec(insertTicketUser, ticket.ID, role, user.UserID, user.Username); err != nil {
+			return fmt.Errorf("error: inserting ticket user: %w", err)
+		}
+		return nil
+	}
+	if err := insertUser(TicketReporter, ticket.UsersInvolved.Reporter); err != nil {
+		return err
+	}
+	for _, reported := range ticket.UsersInvolved.ReportedIDs {
+		if err := insertUser(TicketReported, reported); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+func clearTicketRelations(ctx context.Context, tx *sql.Tx, d dialect, ticketID int64) error {
+	for _, query := range []string{deleteTicketLabels, deleteTicketFlags, deleteTicketSubmissions, deleteTicketUsers} {
+		if _, err := tx.ExecContext(ctx, d.bind(query), ticketID); err != nil {
+			return fmt.Errorf("error: clearing ticket relations: %w", err)
+		}
+	}
+	return nil
+}
+
+// backfillTicketRelations fills the relation tables from the json columns of existing tickets.
+func backfillTicketRelations(d dialect) func(ctx context.Context, tx *sql.Tx) error {
+	return func(ctx context.Context, tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `SELECT ticket_id, labels, flags, submissions_ids, involved FROM tickets;`)
+		if err != nil {
+			return fmt.Errorf("error: querying tickets: %w", err)
+		}
+
+		var tickets []Ticket
+		for rows.Next() {
+			var (
+				ticket                                 Ticket
+				labels, flags, submissionIDs, involved []byte
+			)
+			if err := rows.Scan(&ticket.ID, &labels, &flags, &submissionIDs, &involved); err != nil {
+				rows.Close()
+				return fmt.Errorf("error: scanning ticket: %w", err)
+			}
+			err := Scan(map[any]any{
+				&ticket.Labels:        labels,
+				&ticket.Flags:         flags,
+				&ticket.SubmissionIDs: submissionIDs,
+				&ticket.UsersInvolved: involved,
+			})
+			if err != nil {
+				rows.Close()
+				return fmt.Errorf("error: scanning ticket %d: %w", ticket.ID, err)
+			}
+			tickets = append(tickets, ticket)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, ticket := range tickets {
+			if err := syncTicketRelations(ctx, tx, d, ticket); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
 // assertArgs asserts that the arguments are valid sqlite types and marshals them if necessary.
 // TODO: Include creation query to check what type is expected.
 func assertArgs(args ...any) ([]any, error) {
@@ -513,6 +769,15 @@ func parseTime(t interface{ UTC() time.Time }) string {
 	return t.UTC().Format(time.RFC3339Nano)
 }
 
+// sortableTimeLayout is RFC3339 with a fixed number of fractional digits, so times stored as text sort chronologically.
+// [time.RFC3339Nano] trims trailing zeros, which puts "…:00Z" after "…:00.5Z".
+const sortableTimeLayout = "2006-01-02T15:04:05.000000000Z07:00"
+
+// sortableTime formats t in UTC with [sortableTimeLayout], for columns that are compared or ordered by.
+func sortableTime(t time.Time) string {
+	return t.UTC().Format(sortableTimeLayout)
+}
+
 func isNil(v reflect.Value) bool {
 	if v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
 		if v.IsNil() {
@@ -652,7 +917,11 @@ func (db Sqlite) UpsertArtist(artists ...Artist) error {
 	}
 
 	for _, artist := range artists {
-		_, err := db.ExecContext(db.context, upsertArtist, artist.Username, artist.UserID)
+		aliases, err := marshalNonEmpty(artist.Aliases)
+		if err != nil {
+			return err
+		}
+		_, err = db.ExecContext(db.context, upsertArtist, artist.Username, artist.UserID, aliases)
 		if err != nil {
 			return fmt.Errorf("error: upserting artist: %w", err)
 		}
@@ -665,3 +934,159 @@ func (db Sqlite) DeleteArtist(username string) error {
 	_, err := db.ExecContext(db.context, deleteArtistUsername, username)
 	return err
 }
+
+func (db Sqlite) UpsertFileHash(hashes ...FileHash) error {
+	for _, hash := range hashes {
+		_, err := db.ExecContext(db.context, upsertFileHash,
+			hash.FileID, hash.SubmissionID, hash.UserID, hash.MD5, int64(hash.PHash), sortableTime(hash.Posted))
+		if err != nil {
+			return fmt.Errorf("error: upserting file hash: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// StoreSubmission upserts the submission and records a new version in its history, in one transaction.
+// A version is only added if the submission or its labels changed since the last stored version.
+func (db Sqlite) StoreSubmission(submission Submission, labels []TicketLabel) error {
+	args, err := db.submissionArgs(submission)
+	if err != nil {
+		return err
+	}
+
+	bin, err := json.Marshal(submission)
+	if err != nil {
+		return fmt.Errorf("error: marshalling submission: %w", err)
+	}
+
+	labelsBin, err := marshal(labels, len(labels))
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTx(db.context, nil)
+	if err != nil {
+		return err
+	}
+
+	// nolint
+	defer tx.Rollback()
+
+	if err := upsertSubmissionTx(db.context, tx, db.dialect, submission, args); err != nil {
+		return err
+	}
+
+	var lastSubmission, lastLabels []byte
+	err = tx.QueryRowContext(db.context, db.rebind(selectLatestSubmissionVersion), submission.ID).Scan(&lastSubmission, &lastLabels)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("error: getting latest submission version: %w", err)
+	}
+	if err == nil && bytes.Equal(lastSubmission, bin) && bytes.Equal(lastLabels, labelsBin) {
+		return tx.Commit()
+	}
+
+	_, err = tx.ExecContext(db.context, db.rebind(insertSubmissionVersion),
+		submission.ID, parseTime(time.Now()), bin, labelsBin,
+	)
+	if err != nil {
+		return fmt.Errorf("error: inserting submission version: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// InsertReevaluation records a finished re-evaluation of the stored submissions.
+func (db Sqlite) InsertReevaluation(reevaluation Reevaluation) error {
+	_, err := db.ExecContext(db.context, insertReevaluation,
+		reevaluation.Version, parseTime(reevaluation.Started), parseTime(reevaluation.Finished),
+		reevaluation.Evaluated, reevaluation.Changed, nullString(reevaluation.Error),
+	)
+	if err != nil {
+		return fmt.Errorf("error: inserting reevaluation: %w", err)
+	}
+	return nil
+}
+
+// insertTicketEvents appends events to the history of their tickets inside tx. Events are never updated or deleted.
+func insertTicketEvents(ctx context.Context, tx *sql.Tx, d dialect, events []TicketEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	stmt, err := tx.PrepareContext(ctx, d.bind(insertTicketEvent))
+	if err != nil {
+		return fmt.Errorf("error: preparing ticket event: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, event := range events {
+		if event.Time.IsZero() {
+			event.Time = time.Now().UTC()
+		}
+		_, err := stmt.ExecContext(ctx,
+			event.TicketID, event.ActorID, nullString(event.Actor), parseTime(event.Time),
+			event.Field, nullJSON(event.Old), nullJSON(event.New),
+		)
+		if err != nil {
+			return fmt.Errorf("error: inserting ticket event for %d: %w", event.TicketID, err)
+		}
+	}
+
+	return nil
+}
+
+func nullString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func nullJSON(b json.RawMessage) any {
+	if len(b) == 0 {
+		return nil
+	}
+	return string(b)
+}
+
+// padFileHashTimes rewrites the posted_at of the file hashes stored with [time.RFC3339Nano] in [sortableTimeLayout].
+func padFileHashTimes(d dialect) func(ctx context.Context, tx *sql.Tx) error {
+	return func(ctx context.Context, tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `SELECT file_id, posted_at FROM file_hashes;`)
+		if err != nil {
+			return fmt.Errorf("error: querying file hashes: %w", err)
+		}
+
+		posted := make(map[int64]string)
+		for rows.Next() {
+			var (
+				fileID int64
+				stored string
+			)
+			if err := rows.Scan(&fileID, &stored); err != nil {
+				rows.Close()
+				return fmt.Errorf("error: scanning file hash: %w", err)
+			}
+			t, err := time.Parse(time.RFC3339Nano, stored)
+			if err != nil {
+				rows.Close()
+				return fmt.Errorf("error: parsing the time of file %d: %w", fileID, err)
+			}
+			if padded := sortableTime(t); padded != stored {
+				posted[fileID] = padded
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for fileID, padded := range posted {
+			if _, err := tx.ExecContext(ctx, d.bind(updateFileHashPosted), padded, fileID); err != nil {
+				return fmt.Errorf("error: updating file hash %d: %w", fileID, err)
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,328 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-errors/errors"
+)
+
+// Migration moves the schema from version n-1 to n, where n is its position in migrations starting at 1.
+// Up and Down are SQL scripts and may contain several statements.
+// UpFunc and DownFunc run after the SQL in the same transaction, for changes that need Go code such as backfilling data.
+//
+// The SQL is written for SQLite and translated for Postgres, see [dialect.translate].
+// PostgresUp and PostgresDown replace the translation for features SQLite does differently, such as triggers and full-text search.
+//
+// Applied migrations are recorded with a checksum of their name and SQL.
+// Editing an applied migration is reported as [ErrMigrationModified], add a new migration instead.
+type Migration struct {
+	Name         string
+	Up           string
+	Down         string
+	UpFunc       func(ctx context.Context, tx *sql.Tx) error
+	DownFunc     func(ctx context.Context, tx *sql.Tx) error
+	PostgresUp   string
+	PostgresDown string
+}
+
+// Checksum identifies the contents of the migration as rendered for its dialect. Go functions are not part of the checksum.
+func (m Migration) Checksum() string {
+	sum := sha256.Sum256([]byte(m.Name + "\x00" + m.Up + "\x00" + m.Down))
+	return hex.EncodeToString(sum[:])
+}
+
+// MigrationStatus is the state of a known migration in a database.
+type MigrationStatus struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	Checksum  string     `json:"checksum"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+	Modified  bool       `json:"modified,omitempty"` // The migration changed since it was applied
+}
+
+// MigrationStep is a migration that was, or in a dry run would be, applied or rolled back.
+type MigrationStep struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+	Down    bool   `json:"down,omitempty"`
+}
+
+func (s MigrationStep) String() string {
+	direction := "up"
+	if s.Down {
+		direction = "down"
+	}
+	return fmt.Sprintf("%s %d '%s'", direction, s.Version, s.Name)
+}
+
+var (
+	ErrMigrationModified = errors.New("error: an applied migration was modified")
+	ErrUnknownMigration  = errors.New("error: database has migrations this version does not know about")
+)
+
+const (
+	// createSchemaMigrations keeps track of applied migrations, PRAGMA user_version is kept in sync for older versions.
+	createSchemaMigrations = `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		checksum TEXT NOT NULL,
+		applied_at TEXT NOT NULL
+	)
+	`
+
+	selectSchemaMigrationsExists   = `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations';`
+	selectSchemaMigrationsExistsPG = `SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = 'schema_migrations';`
+	selectSchemaMigrations         = `SELECT version, checksum, applied_at FROM schema_migrations ORDER BY version;`
+	insertSchemaMigration          = `INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (?, ?, ?, ?);`
+	deleteSchemaMigration          = `DELETE FROM schema_migrations WHERE version = ?;`
+)
+
+type appliedMigration struct {
+	version   int
+	checksum  string
+	appliedAt time.Time
+}
+
+// MigrationStatus lists every known migration and whether it has been applied.
+func (db Sqlite) MigrationStatus() ([]MigrationStatus, error) {
+	applied, err := appliedMigrations(db.context, db.DB, db.dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := db.dialect.migrations()
+	status := make([]MigrationStatus, len(migrations))
+	for i, m := range migrations {
+		status[i] = MigrationStatus{
+			Version:  i + 1,
+			Name:     m.Name,
+			Checksum: m.Checksum(),
+		}
+	}
+	for _, a := range applied {
+		if a.version > len(migrations) {
+			continue
+		}
+		s := &status[a.version-1]
+		s.Applied = true
+		if !a.appliedAt.IsZero() {
+			s.AppliedAt = &a.appliedAt
+		}
+		s.Modified = a.checksum != s.Checksum
+	}
+
+	return status, nil
+}
+
+// MigrateTo applies or rolls back migrations until the schema is at version, 0 being an empty database.
+// With dryRun, the steps are returned without touching the database.
+func (db Sqlite) MigrateTo(version int, dryRun bool) ([]MigrationStep, error) {
+	return migrateTo(db.context, db.DB, db.dialect, version, dryRun)
+}
+
+// LatestMigration is the schema version New migrates to.
+func LatestMigration() int {
+	return len(migrations)
+}
+
+// migrate applies every pending migration.
+func migrate(ctx context.Context, db *sql.DB) error {
+	_, err := migrateTo(ctx, db, dialectSqlite, len(migrations), false)
+	return err
+}
+
+func migrateTo(ctx context.Context, db *sql.DB, d dialect, target int, dryRun bool) ([]MigrationStep, error) {
+	migrations := d.migrations()
+	if target < 0 || target > len(migrations) {
+		return nil, fmt.Errorf("error: target version %d is out of range 0-%d", target, len(migrations))
+	}
+
+	applied, err := appliedMigrations(ctx, db, d)
+	if err != nil {
+		return nil, err
+	}
+
+	var current int
+	for _, a := range applied {
+		if a.version > len(migrations) {
+			return nil, fmt.Errorf("%w: version %d, known %d", ErrUnknownMigration, a.version, len(migrations))
+		}
+		if a.checksum != migrations[a.version-1].Checksum() {
+			return nil, fmt.Errorf("%w: %d '%s'", ErrMigrationModified, a.version, migrations[a.version-1].Name)
+		}
+		current = max(current, a.version)
+	}
+
+	log.Printf("Current DB version: %v, required DB version: %v\n", current, target)
+
+	var steps []MigrationStep
+	for version := current + 1; version <= target; version++ {
+		steps = append(steps, MigrationStep{Version: version, Name: migrations[version-1].Name})
+	}
+	for version := current; version > target; version-- {
+		steps = append(steps, MigrationStep{Version: version, Name: migrations[version-1].Name, Down: true})
+	}
+
+	if dryRun {
+		return steps, nil
+	}
+
+	if err := recordLegacyMigrations(ctx, db, d, applied); err != nil {
+		return nil, err
+	}
+
+	for i, step := range steps {
+		if err := execMigration(ctx, db, d, step); err != nil {
+			log.Printf("Error running migration %s\n", step)
+			return steps[:i], err
+		}
+	}
+
+	return steps, nil
+}
+
+// appliedMigrations reads the schema_migrations table.
+// Databases created before it existed only have PRAGMA user_version, every version up to it is treated as applied.
+func appliedMigrations(ctx context.Context, db *sql.DB, d dialect) ([]appliedMigration, error) {
+	var exists int
+	if err := db.QueryRowContext(ctx, d.schemaMigrationsExists()).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("error: checking schema_migrations: %w", err)
+	}
+
+	if exists == 0 && d == dialectPostgres {
+		return nil, nil
+	}
+
+	if exists == 0 {
+		var userVersion int
+		if err := db.QueryRowContext(ctx, getCurrentMigration).Scan(&userVersion); err != nil {
+			return nil, fmt.Errorf("error: getting user_version: %w", err)
+		}
+		applied := make([]appliedMigration, userVersion)
+		for i := range applied {
+			applied[i] = appliedMigration{version: i + 1}
+			if i < len(migrations) {
+				applied[i].checksum = migrations[i].Checksum()
+			}
+		}
+		return applied, nil
+	}
+
+	rows, err := db.QueryContext(ctx, selectSchemaMigrations)
+	if err != nil {
+		return nil, fmt.Errorf("error: querying schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	var applied []appliedMigration
+	for rows.Next() {
+		var (
+			a         appliedMigration
+			appliedAt string
+		)
+		if err := rows.Scan(&a.version, &a.checksum, &appliedAt); err != nil {
+			return nil, fmt.Errorf("error: scanning schema_migrations: %w", err)
+		}
+		a.appliedAt, _ = time.Parse(time.RFC3339Nano, appliedAt)
+		applied = append(applied, a)
+	}
+
+	return applied, rows.Err()
+}
+
+// recordLegacyMigrations creates schema_migrations and fills it with the versions previously tracked by user_version.
+func recordLegacyMigrations(ctx context.Context, db *sql.DB, d dialect, applied []appliedMigration) error {
+	migrations := d.migrations()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	// nolint
+	defer tx.Rollback()
+
+	var exists int
+	if err := tx.QueryRowContext(ctx, d.schemaMigrationsExists()).Scan(&exists); err != nil {
+		return fmt.Errorf("error: checking schema_migrations: %w", err)
+	}
+	if exists > 0 {
+		return nil
+	}
+
+	if _, err := tx.ExecContext(ctx, createSchemaMigrations); err != nil {
+		return fmt.Errorf("error: creating schema_migrations: %w", err)
+	}
+
+	for _, a := range applied {
+		_, err := tx.ExecContext(ctx, d.bind(insertSchemaMigration),
+			a.version, migrations[a.version-1].Name, a.checksum, parseTime(time.Now()))
+		if err != nil {
+			return fmt.Errorf("error: recording migration %d: %w", a.version, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+func execMigration(ctx context.Context, db *sql.DB, d dialect, step MigrationStep) error {
+	log.Printf("Running migration %s\n", step)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	// nolint
+	defer tx.Rollback()
+
+	m := d.migrations()[step.Version-1]
+	script, fn := m.Up, m.UpFunc
+	if step.Down {
+		script, fn = m.Down, m.DownFunc
+	}
+
+	if strings.TrimSpace(script) != "" {
+		if _, err := tx.ExecContext(ctx, script); err != nil {
+			return err
+		}
+	}
+
+	if fn != nil {
+		if err := fn(ctx, tx); err != nil {
+			return err
+		}
+	}
+
+	version := step.Version
+	if step.Down {
+		version--
+		_, err = tx.ExecContext(ctx, d.bind(deleteSchemaMigration), step.Version)
+	} else {
+		_, err = tx.ExecContext(ctx, d.bind(insertSchemaMigration), step.Version, m.Name, m.Checksum(), parseTime(time.Now()))
+	}
+	if err != nil {
+		return err
+	}
+
+	if d == dialectPostgres {
+		return tx.Commit()
+	}
+
+	setQuery := strings.Replace(setCurrentMigration, "?", strconv.Itoa(version), 1)
+	if _, err := tx.ExecContext(ctx, setQuery); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,315 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// ParserBinding attaches a registered parameter parser to the files it should read.
+// A binding applies when every condition it sets holds: the submission is by UserID,
+// the file name matches FilePattern and the file content matches ContentPattern.
+type ParserBinding struct {
+	ID             int64  `json:"id,omitempty"`
+	Parser         string `json:"parser"`                    // name of the parser in the registry
+	UserID         *int64 `json:"user_id,omitempty"`         // the artist whose files are read
+	FilePattern    string `json:"file_pattern,omitempty"`    // regular expression matched against the file name
+	ContentPattern string `json:"content_pattern,omitempty"` // regular expression matched against the file content
+	Priority       int    `json:"priority,omitempty"`        // lower is tried first
+}
+
+var ErrMissingParserBinding = errors.New("error: parser binding not found")
+
+// ParserDefinition is a parser written by staff for a one-off text layout, made of line conditions and field regexes.
+// The text is split into the parameters of each image by KeyPattern and SplitPattern,
+// then each field is filled with the first group of its regular expression.
+type ParserDefinition struct {
+	ID           int64             `json:"id,omitempty"`
+	Name         string            `json:"name"`                    // the name it is registered and bound under
+	KeyPattern   string            `json:"key_pattern,omitempty"`   // a matching line starts the parameters of an image, its first group names them
+	SplitPattern string            `json:"split_pattern,omitempty"` // a matching line ends the parameters of an image
+	Fields       map[string]string `json:"fields"`                  // JSON name of a TextToImageRequest field to its regular expression
+	Author       string            `json:"author,omitempty"`
+	Active       bool              `json:"active,omitempty"` // registered and usable by bindings
+	Created      time.Time         `json:"created"`
+}
+
+var ErrMissingParserDefinition = errors.New("error: parser definition not found")
+
+// Parser binding and definition statements
+const (
+	// selectParserBindings statement for ParserBinding
+	selectParserBindings = `
+	SELECT binding_id, parser, user_id, file_pattern, content_pattern, priority
+	FROM parser_bindings
+	ORDER BY priority, binding_id;
+	`
+
+	// insertParserBinding statement for ParserBinding
+	insertParserBinding = `
+	INSERT INTO parser_bindings (parser, user_id, file_pattern, content_pattern, priority) VALUES (?, ?, ?, ?, ?)
+	RETURNING binding_id;
+	`
+
+	// updateParserBinding statement for ParserBinding
+	updateParserBinding = `
+	UPDATE parser_bindings
+	SET parser = ?, user_id = ?, file_pattern = ?, content_pattern = ?, priority = ?
+	WHERE binding_id = ?;
+	`
+
+	deleteParserBinding = `DELETE FROM parser_bindings WHERE binding_id = ?;`
+
+	selectParserDefinitionColumns = `SELECT definition_id, name, key_pattern, split_pattern, fields, author, active, created_at FROM parser_definitions`
+
+	// selectParserDefinitions statement for ParserDefinition
+	selectParserDefinitions    = selectParserDefinitionColumns + ` ORDER BY definition_id;`
+	selectParserDefinitionByID = selectParserDefinitionColumns + ` WHERE definition_id = ?;`
+
+	// insertParserDefinition statement for ParserDefinition
+	insertParserDefinition = `
+	INSERT INTO parser_definitions (name, key_pattern, split_pattern, fields, author, active, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	RETURNING definition_id;
+	`
+
+	// updateParserDefinition statement for ParserDefinition
+	updateParserDefinition = `
+	UPDATE parser_definitions
+	SET name = ?, key_pattern = ?, split_pattern = ?, fields = ?, author = ?, active = ?
+	WHERE definition_id = ?;
+	`
+)
+
+// Validate reports a binding without a parser or conditions, or with patterns that don't compile.
+func (b ParserBinding) Validate() error {
+	if b.Parser == "" {
+		return errors.New("error: missing parser")
+	}
+	if b.UserID == nil && b.FilePattern == "" && b.ContentPattern == "" {
+		return errors.New("error: parser binding needs a user, file pattern or content pattern")
+	}
+	for _, pattern := range []string{b.FilePattern, b.ContentPattern} {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("error: invalid pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// Applies reports whether the binding's conditions hold for the file fileName with content by userID.
+func (b ParserBinding) Applies(userID int64, fileName string, content []byte) bool {
+	if b.UserID != nil && *b.UserID != userID {
+		return false
+	}
+	if b.FilePattern != "" {
+		re, err := regexp.Compile(b.FilePattern)
+		if err != nil || !re.MatchString(fileName) {
+			return false
+		}
+	}
+	if b.ContentPattern != "" {
+		re, err := regexp.Compile(b.ContentPattern)
+		if err != nil || !re.Match(content) {
+			return false
+		}
+	}
+	return true
+}
+
+// AllParserBindings returns every parser binding in the order they are tried, or nil if they can't be read.
+func (db Sqlite) AllParserBindings() []ParserBinding {
+	rows, err := db.QueryContext(db.context, selectParserBindings)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	var bindings []ParserBinding
+	for rows.Next() {
+		var (
+			binding        ParserBinding
+			filePattern    *string
+			contentPattern *string
+		)
+		err := rows.Scan(&binding.ID, &binding.Parser, &binding.UserID, &filePattern, &contentPattern, &binding.Priority)
+		if err != nil {
+			return nil
+		}
+		if filePattern != nil {
+			binding.FilePattern = *filePattern
+		}
+		if contentPattern != nil {
+			binding.ContentPattern = *contentPattern
+		}
+		bindings = append(bindings, binding)
+	}
+
+	return bindings
+}
+
+// UpsertParserBinding stores a new binding if its ID is 0, otherwise it replaces the stored one.
+// It returns the ID of the binding, or ErrMissingParserBinding if there is nothing to replace.
+func (db Sqlite) UpsertParserBinding(binding ParserBinding) (int64, error) {
+	if err := binding.Validate(); err != nil {
+		return 0, err
+	}
+
+	if binding.ID == 0 {
+		var id int64
+		err := db.QueryRowContext(db.context, insertParserBinding,
+			binding.Parser, binding.UserID, nullString(binding.FilePattern), nullString(binding.ContentPattern), binding.Priority,
+		).Scan(&id)
+		if err != nil {
+			return 0, fmt.Errorf("error: inserting parser binding: %w", err)
+		}
+		return id, nil
+	}
+
+	result, err := db.ExecContext(db.context, updateParserBinding,
+		binding.Parser, binding.UserID, nullString(binding.FilePattern), nullString(binding.ContentPattern), binding.Priority, binding.ID)
+	if err != nil {
+		return 0, fmt.Errorf("error: updating parser binding: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return 0, ErrMissingParserBinding
+	}
+	return binding.ID, nil
+}
+
+// DeleteParserBinding removes the binding with id, or returns ErrMissingParserBinding if there is none.
+func (db Sqlite) DeleteParserBinding(id int64) error {
+	result, err := db.ExecContext(db.context, deleteParserBinding, id)
+	if err != nil {
+		return fmt.Errorf("error: deleting parser binding: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrMissingParserBinding
+	}
+	return nil
+}
+
+// Validate reports a definition without a name or fields, or with patterns that don't compile.
+func (d ParserDefinition) Validate() error {
+	if d.Name == "" {
+		return errors.New("error: missing parser name")
+	}
+	if len(d.Fields) == 0 {
+		return errors.New("error: parser definition has no fields")
+	}
+	for _, pattern := range []string{d.KeyPattern, d.SplitPattern} {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("error: invalid pattern %q: %w", pattern, err)
+		}
+	}
+	for field, pattern := range d.Fields {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("error: invalid pattern for %s: %w", field, err)
+		}
+	}
+	return nil
+}
+
+// AllParserDefinitions returns every parser definition, or nil if they can't be read.
+func (db Sqlite) AllParserDefinitions() []ParserDefinition {
+	rows, err := db.QueryContext(db.context, selectParserDefinitions)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	var definitions []ParserDefinition
+	for rows.Next() {
+		definition, err := scanParserDefinition(rows)
+		if err != nil {
+			return nil
+		}
+		definitions = append(definitions, definition)
+	}
+
+	return definitions
+}
+
+// GetParserDefinition returns the definition with id, or ErrMissingParserDefinition if there is none.
+func (db Sqlite) GetParserDefinition(id int64) (ParserDefinition, error) {
+	definition, err := scanParserDefinition(db.QueryRowContext(db.context, selectParserDefinitionByID, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return definition, ErrMissingParserDefinition
+	}
+	return definition, err
+}
+
+func scanParserDefinition(row interface{ Scan(dest ...any) error }) (ParserDefinition, error) {
+	var (
+		definition   ParserDefinition
+		keyPattern   *string
+		splitPattern *string
+		fields       string
+		author       *string
+		createdAt    string
+	)
+	err := row.Scan(&definition.ID, &definition.Name, &keyPattern, &splitPattern, &fields, &author, &definition.Active, &createdAt)
+	if err != nil {
+		return definition, fmt.Errorf("error: scanning parser definition: %w", err)
+	}
+	if keyPattern != nil {
+		definition.KeyPattern = *keyPattern
+	}
+	if splitPattern != nil {
+		definition.SplitPattern = *splitPattern
+	}
+	if author != nil {
+		definition.Author = *author
+	}
+	if err := json.Unmarshal([]byte(fields), &definition.Fields); err != nil {
+		return definition, fmt.Errorf("error: unmarshaling fields: %w", err)
+	}
+	definition.Created, err = time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return definition, fmt.Errorf("error: parsing time: %w", err)
+	}
+	return definition, nil
+}
+
+// UpsertParserDefinition stores a new definition if its ID is 0, otherwise it replaces the stored one.
+// It returns the ID of the definition, or ErrMissingParserDefinition if there is nothing to replace.
+func (db Sqlite) UpsertParserDefinition(definition ParserDefinition) (int64, error) {
+	if err := definition.Validate(); err != nil {
+		return 0, err
+	}
+
+	fields, err := json.Marshal(definition.Fields)
+	if err != nil {
+		return 0, fmt.Errorf("error: marshaling fields: %w", err)
+	}
+
+	if definition.ID == 0 {
+		created := definition.Created
+		if created.IsZero() {
+			created = time.Now()
+		}
+		var id int64
+		err := db.QueryRowContext(db.context, insertParserDefinition,
+			definition.Name, nullString(definition.KeyPattern), nullString(definition.SplitPattern), string(fields),
+			nullString(definition.Author), definition.Active, parseTime(created),
+		).Scan(&id)
+		if err != nil {
+			return 0, fmt.Errorf("error: inserting parser definition: %w", err)
+		}
+		return id, nil
+	}
+
+	result, err := db.ExecContext(db.context, updateParserDefinition,
+		definition.Name, nullString(definition.KeyPattern), nullString(definition.SplitPattern), string(fields),
+		nullString(definition.Author), definition.Active, definition.ID)
+	if err != nil {
+		return 0, fmt.Errorf("error: updating parser definition: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return 0, ErrMissingParserDefinition
+	}
+	return definition.ID, nil
+}
@@ -0,0 +1,199 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Postgres is a [Store] backed by PostgreSQL so several servers can share one database.
+// It runs the same queries as [Sqlite], with ? placeholders rewritten to $1, $2...
+//
+// No driver is imported by this package. The binary has to register one, by default under the name "pgx":
+//
+//	import _ "github.com/jackc/pgx/v5/stdlib"
+type Postgres struct {
+	Sqlite
+}
+
+// NewPostgres connects to the database at dsn and applies pending migrations.
+// Use context to pass in "driver" to use a driver registered under another name,
+// and "migrate" set to false to skip migrations.
+func NewPostgres(ctx context.Context, dsn string) (*Postgres, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	driver := "pgx"
+	if d, ok := ctx.Value("driver").(string); ok && d != "" {
+		driver = d
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.PingContext(ctx); err != nil {
+		return nil, fmt.Errorf("error: connecting to postgres: %w", err)
+	}
+
+	if run, ok := ctx.Value("migrate").(bool); !ok || run {
+		_, err = migrateTo(ctx, db, dialectPostgres, len(postgresMigrations), false)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &Postgres{Sqlite{DB: db, context: ctx, dialect: dialectPostgres}}, nil
+}
+
+// Wait blocks until the database is reachable.
+func (db Postgres) Wait() {
+	for {
+		if err := db.Ping(); err == nil {
+			return
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// ExecContext runs query on the underlying database, rewriting placeholders for Postgres.
+func (db Sqlite) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return db.DB.ExecContext(ctx, db.rebind(query), args...)
+}
+
+// QueryContext runs query on the underlying database, rewriting placeholders for Postgres.
+func (db Sqlite) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return db.DB.QueryContext(ctx, db.rebind(query), args...)
+}
+
+// QueryRowContext runs query on the underlying database, rewriting placeholders for Postgres.
+func (db Sqlite) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return db.DB.QueryRowContext(ctx, db.rebind(query), args...)
+}
+
+func (db Sqlite) rebind(query string) string {
+	return db.dialect.bind(query)
+}
+
+var rebound sync.Map
+
+// rebind rewrites ? placeholders to $1, $2... skipping quoted strings and comments.
+func rebind(query string) string {
+	if q, ok := rebound.Load(query); ok {
+		return q.(string)
+	}
+
+	var (
+		sb      strings.Builder
+		n       int
+		quote   byte
+		comment bool
+	)
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case comment:
+			comment = ch != '\n'
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"':
+			quote = ch
+		case ch == '-' && i+1 < len(query) && query[i+1] == '-':
+			comment = true
+		case ch == '?':
+			n++
+			sb.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		sb.WriteByte(ch)
+	}
+
+	rebound.Store(query, sb.String())
+	return sb.String()
+}
+
+// Overrides of migrations that can't be translated from SQLite, see [Migration].
+const (
+	// createSubmissionsPG stores user_id as a number so audits can reference it with the same type
+	createSubmissionsPG = `
+	CREATE TABLE IF NOT EXISTS submissions (
+		submission_id BIGINT PRIMARY KEY,
+		user_id BIGINT NOT NULL,
+		url TEXT NOT NULL,
+		audit_id BIGINT UNIQUE,
+		title TEXT NOT NULL,
+		description TEXT NOT NULL,
+		updated_at TEXT NOT NULL,
+		metadata TEXT,
+		ratings TEXT,
+		keywords TEXT,
+		files TEXT
+	)
+	`
+
+	// createAuditsPG declares submission_id as a number, foreign keys have to match the referenced type
+	createAuditsPG = `
+	CREATE TABLE IF NOT EXISTS audits (
+		audit_id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+		auditor_id BIGINT REFERENCES auditors(auditor_id),
+		submission_id BIGINT NOT NULL UNIQUE REFERENCES submissions(submission_id),
+		submission_username TEXT NOT NULL,
+		submission_user_id BIGINT NOT NULL,
+		flags TEXT NOT NULL,
+		action_taken TEXT NOT NULL
+	)
+	`
+
+	// createTicketEventsPG raises from a trigger function instead of SQLite's RAISE(ABORT)
+	createTicketEventsPG = `
+	CREATE TABLE IF NOT EXISTS ticket_events (
+		event_id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+		ticket_id BIGINT NOT NULL,
+		actor_id BIGINT,
+		actor TEXT,
+		created_at TEXT NOT NULL,
+		field TEXT NOT NULL,
+		old_value TEXT,
+		new_value TEXT
+	);
+	CREATE INDEX IF NOT EXISTS ticket_events_ticket_id ON ticket_events (ticket_id);
+	CREATE OR REPLACE FUNCTION ticket_events_append_only() RETURNS trigger AS $$
+	BEGIN
+		RAISE EXCEPTION 'ticket_events is append-only';
+	END;
+	$$ LANGUAGE plpgsql;
+	CREATE TRIGGER ticket_events_append_only BEFORE UPDATE OR DELETE ON ticket_events
+		FOR EACH ROW EXECUTE FUNCTION ticket_events_append_only();
+	`
+
+	dropTicketEventsPG = `
+	DROP TABLE IF EXISTS ticket_events;
+	DROP FUNCTION IF EXISTS ticket_events_append_only();
+	`
+
+	// createSearchIndexPG uses a weighted tsvector instead of FTS5, see searchPostgres
+	createSearchIndexPG = `
+	CREATE TABLE IF NOT EXISTS search_index (
+		rowid BIGINT PRIMARY KEY,
+		kind TEXT NOT NULL,
+		ref_id BIGINT NOT NULL,
+		title TEXT,
+		body TEXT,
+		prompts TEXT,
+		document tsvector GENERATED ALWAYS AS (
+			setweight(to_tsvector('simple', coalesce(title, '')), 'A') ||
+			setweight(to_tsvector('simple', coalesce(prompts, '')), 'B') ||
+			setweight(to_tsvector('simple', coalesce(body, '')), 'C')
+		) STORED
+	);
+	CREATE INDEX IF NOT EXISTS search_index_document ON search_index USING GIN (document);
+	`
+)
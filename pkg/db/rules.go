@@ -0,0 +1,107 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// RuleSet is an ACP rule set activated by staff. The active one is loaded again when the server starts.
+type RuleSet struct {
+	ID      int64     `json:"id,omitempty"`
+	Version string    `json:"version"`
+	Source  string    `json:"source"` // the rules as YAML or JSON, as they were activated
+	Author  string    `json:"author,omitempty"`
+	Active  bool      `json:"active"`
+	Created time.Time `json:"created"`
+}
+
+var ErrMissingRuleSet = errors.New("error: no rule set was activated")
+
+// Rule set statements
+const (
+	// createRuleSets statement for RuleSet
+	createRuleSets = `
+	CREATE TABLE IF NOT EXISTS rule_sets (
+		rule_set_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		version TEXT NOT NULL,
+		source TEXT NOT NULL,
+		author TEXT,
+		active BOOLEAN NOT NULL DEFAULT FALSE,
+		created_at TEXT NOT NULL
+	);
+	`
+
+	selectActiveRuleSet = `
+	SELECT rule_set_id, version, source, author, active, created_at
+	FROM rule_sets
+	WHERE active
+	ORDER BY rule_set_id DESC
+	LIMIT 1;
+	`
+
+	deactivateRuleSets = `UPDATE rule_sets SET active = FALSE WHERE active;`
+
+	// insertRuleSet statement for RuleSet
+	insertRuleSet = `
+	INSERT INTO rule_sets (version, source, author, active, created_at) VALUES (?, ?, ?, TRUE, ?)
+	RETURNING rule_set_id;
+	`
+)
+
+// ActivateRuleSet stores set as the only active rule set and returns its ID.
+// Previously activated sets are kept as history.
+func (db Sqlite) ActivateRuleSet(set RuleSet) (int64, error) {
+	tx, err := db.BeginTx(db.context, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	// nolint
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(db.context, deactivateRuleSets); err != nil {
+		return 0, fmt.Errorf("error: deactivating rule sets: %w", err)
+	}
+
+	created := set.Created
+	if created.IsZero() {
+		created = time.Now()
+	}
+
+	var id int64
+	err = tx.QueryRowContext(db.context, db.rebind(insertRuleSet),
+		set.Version, set.Source, nullString(set.Author), parseTime(created),
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("error: inserting rule set: %w", err)
+	}
+
+	return id, tx.Commit()
+}
+
+// GetActiveRuleSet returns the last activated rule set, or ErrMissingRuleSet if the default rules were never replaced.
+func (db Sqlite) GetActiveRuleSet() (RuleSet, error) {
+	var (
+		set       RuleSet
+		author    *string
+		createdAt string
+	)
+	err := db.QueryRowContext(db.context, selectActiveRuleSet).
+		Scan(&set.ID, &set.Version, &set.Source, &author, &set.Active, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return set, ErrMissingRuleSet
+	}
+	if err != nil {
+		return set, fmt.Errorf("error: scanning rule set: %w", err)
+	}
+	if author != nil {
+		set.Author = *author
+	}
+	set.Created, err = time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return set, fmt.Errorf("error: parsing time: %w", err)
+	}
+	return set, nil
+}
@@ -0,0 +1,225 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// SearchHit is a stored submission or ticket matching a [Sqlite.Search].
+type SearchHit struct {
+	Kind    string  `json:"kind"` // SearchSubmission or SearchTicket
+	ID      int64   `json:"id"`
+	Title   string  `json:"title"`
+	Snippet string  `json:"snippet"` // matches are wrapped in [b][/b]
+	Rank    float64 `json:"rank"`    // higher is more relevant
+}
+
+const (
+	SearchSubmission = "submission"
+	SearchTicket     = "ticket"
+
+	DefaultSearchLimit = 25
+	MaxSearchLimit     = 200
+)
+
+// Search statements. The search_index rowid interleaves submissions (even) and tickets (odd),
+// so a document can be replaced by rowid without scanning the index.
+const (
+	deleteSearchDocument = `DELETE FROM search_index WHERE rowid = ?;`
+	insertSearchDocument = `INSERT INTO search_index (rowid, kind, ref_id, title, body, prompts) VALUES (?, ?, ?, ?, ?, ?);`
+
+	// searchSqlite ranks title matches above prompts and prompts above descriptions and responses
+	searchSqlite = `
+	SELECT
+		kind,
+		ref_id,
+		title,
+		snippet(search_index, -1, '[b]', '[/b]', '...', 24),
+		-bm25(search_index, 0.0, 0.0, 10.0, 1.0, 5.0) AS rank
+	FROM search_index WHERE search_index MATCH ?`
+
+	searchPostgres = `
+	SELECT
+		kind,
+		ref_id,
+		title,
+		ts_headline('simple', concat_ws(' ', title, body, prompts), q, 'StartSel=[b], StopSel=[/b], MaxFragments=2'),
+		ts_rank(document, q) AS rank
+	FROM search_index, websearch_to_tsquery('simple', ?) AS q WHERE document @@ q`
+)
+
+func searchRowID(kind string, id int64) int64 {
+	if kind == SearchTicket {
+		return id*2 + 1
+	}
+	return id * 2
+}
+
+// Search returns stored submissions and tickets matching query, most relevant first.
+// Set kind to SearchSubmission or SearchTicket to only search one of them.
+// SQLite accepts the FTS5 query syntax, e.g. "by somebody" for a phrase, and falls back to matching every word.
+func (db Sqlite) Search(query string, kind string, limit int) ([]SearchHit, error) {
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	limit = min(limit, MaxSearchLimit)
+
+	search := searchSqlite
+	if db.dialect == dialectPostgres {
+		search = searchPostgres
+	}
+
+	run := func(match string) ([]SearchHit, error) {
+		q := search
+		args := []any{match}
+		if kind != "" {
+			q += ` AND kind = ?`
+			args = append(args, kind)
+		}
+		q += ` ORDER BY rank DESC LIMIT ?;`
+		args = append(args, limit)
+
+		rows, err := db.QueryContext(db.context, q, args...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		hits := []SearchHit{}
+		for rows.Next() {
+			var hit SearchHit
+			if err := rows.Scan(&hit.Kind, &hit.ID, &hit.Title, &hit.Snippet, &hit.Rank); err != nil {
+				return nil, fmt.Errorf("error: scanning search hit: %w", err)
+			}
+			hits = append(hits, hit)
+		}
+		return hits, rows.Err()
+	}
+
+	hits, err := run(query)
+	if err != nil && db.dialect != dialectPostgres {
+		// not valid FTS5 syntax, match every word instead
+		hits, err = run(quoteSearchTerms(query))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error: searching: %w", err)
+	}
+
+	return hits, nil
+}
+
+// quoteSearchTerms turns every word into an FTS5 string so operators and punctuation are matched literally.
+func quoteSearchTerms(query string) string {
+	terms := strings.Fields(query)
+	for i, term := range terms {
+		terms[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+	return strings.Join(terms, " ")
+}
+
+// indexSubmission replaces the search document of the submission with its title, description and prompts.
+func indexSubmission(ctx context.Context, tx *sql.Tx, d dialect, submission Submission) error {
+	var prompts []string
+	for _, key := range slices.Sorted(maps.Keys(submission.Metadata.Objects)) {
+		object := submission.Metadata.Objects[key]
+		prompts = append(prompts, object.Prompt, object.NegativePrompt)
+	}
+	return indexDocument(ctx, tx, d, SearchSubmission, submission.ID,
+		submission.Title, submission.Description, strings.Join(prompts, "\n"))
+}
+
+// indexTicket replaces the search document of the ticket with its subject and response messages.
+func indexTicket(ctx context.Context, tx *sql.Tx, d dialect, ticket Ticket) error {
+	var responses []string
+	for _, response := range ticket.Responses {
+		responses = append(responses, response.Message)
+	}
+	return indexDocument(ctx, tx, d, SearchTicket, ticket.ID,
+		ticket.Subject, strings.Join(responses, "\n"), "")
+}
+
+func indexDocument(ctx context.Context, tx *sql.Tx, d dialect, kind string, id int64, title, body, prompts string) error {
+	if err := unindexDocument(ctx, tx, d, kind, id); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, d.bind(insertSearchDocument),
+		searchRowID(kind, id), kind, id, title, body, prompts)
+	if err != nil {
+		return fmt.Errorf("error: indexing %s %d: %w", kind, id, err)
+	}
+	return nil
+}
+
+func unindexDocument(ctx context.Context, tx *sql.Tx, d dialect, kind string, id int64) error {
+	_, err := tx.ExecContext(ctx, d.bind(deleteSearchDocument), searchRowID(kind, id))
+	if err != nil {
+		return fmt.Errorf("error: removing %s %d from the search index: %w", kind, id, err)
+	}
+	return nil
+}
+
+// backfillSearchIndex indexes the submissions and tickets stored before the search index existed.
+func backfillSearchIndex(d dialect) func(ctx context.Context, tx *sql.Tx) error {
+	return func(ctx context.Context, tx *sql.Tx) error {
+		var submissions []Submission
+		rows, err := tx.QueryContext(ctx, `SELECT submission_id, title, description, metadata FROM submissions;`)
+		if err != nil {
+			return fmt.Errorf("error: querying submissions: %w", err)
+		}
+		for rows.Next() {
+			var (
+				submission Submission
+				metadata   []byte
+			)
+			if err := rows.Scan(&submission.ID, &submission.Title, &submission.Description, &metadata); err != nil {
+				rows.Close()
+				return fmt.Errorf("error: scanning submission: %w", err)
+			}
+			if err := Scan(map[any]any{&submission.Metadata: metadata}); err != nil {
+				rows.Close()
+				return fmt.Errorf("error: scanning submission %d: %w", submission.ID, err)
+			}
+			submissions = append(submissions, submission)
+		}
+		rows.Close()
+
+		var tickets []Ticket
+		rows, err = tx.QueryContext(ctx, `SELECT ticket_id, subject, responses FROM tickets;`)
+		if err != nil {
+			return fmt.Errorf("error: querying tickets: %w", err)
+		}
+		for rows.Next() {
+			var (
+				ticket    Ticket
+				responses []byte
+			)
+			if err := rows.Scan(&ticket.ID, &ticket.Subject, &responses); err != nil {
+				rows.Close()
+				return fmt.Errorf("error: scanning ticket: %w", err)
+			}
+			if err := Scan(map[any]any{&ticket.Responses: responses}); err != nil {
+				rows.Close()
+				return fmt.Errorf("error: scanning ticket %d: %w", ticket.ID, err)
+			}
+			tickets = append(tickets, ticket)
+		}
+		rows.Close()
+
+		for _, submission := range submissions {
+			if err := indexSubmission(ctx, tx, d, submission); err != nil {
+				return err
+			}
+		}
+		for _, ticket := range tickets {
+			if err := indexTicket(ctx, tx, d, ticket); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
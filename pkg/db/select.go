@@ -119,7 +119,11 @@ const (
 	// selectTicketsByStatus statement for Ticket
 	selectTicketsByStatus = `SELECT * FROM tickets WHERE status = ?;`
 	// selectTicketsByLabel statement for Ticket
-	selectTicketsByLabel = `SELECT * FROM tickets WHERE CAST(labels as TEXT) LIKE ?;`
+	selectTicketsByLabel = `SELECT * FROM tickets WHERE ticket_id IN (SELECT ticket_id FROM ticket_labels WHERE label = ?);`
+	// selectTicketsBySubmission statement for Ticket
+	selectTicketsBySubmission = `SELECT * FROM tickets WHERE ticket_id IN (SELECT ticket_id FROM ticket_submissions WHERE submission_id = ?);`
+	// selectTicketsByUser statement for Ticket
+	selectTicketsByUser = `SELECT * FROM tickets WHERE ticket_id IN (SELECT ticket_id FROM ticket_users WHERE user_id = ? OR lower(username) = lower(?));`
 	// selectTicketsByPriority statement for Ticket
 	selectTicketsByPriority = `SELECT * FROM tickets WHERE priority = ?;`
 	// selectOpenTickets statement for Ticket
@@ -163,7 +167,81 @@ const (
 	selectModelFromHash = `SELECT models FROM models WHERE hash = ?;`
 
 	// selectArtists statement for ArtistHashes
-	selectArtists = `SELECT username, user_id FROM artists;`
+	selectArtists = `SELECT username, user_id, aliases FROM artists;`
+
+	// selectSubmissionHistory statement for SubmissionVersion
+	selectSubmissionHistory = `
+	SELECT
+		version_id,
+		submission_id,
+		stored_at,
+		submission,
+		labels
+	FROM submission_history WHERE submission_id = ?
+	ORDER BY version_id;
+	`
+
+	// selectLatestSubmissionVersions statement for SubmissionVersion.
+	// Walks the (submission_id, version_id) index from the cursor, so a page only reads the rows it returns.
+	selectLatestSubmissionVersions = `
+	SELECT
+		h.version_id,
+		h.submission_id,
+		h.stored_at,
+		h.submission,
+		h.labels
+	FROM submission_history h
+	WHERE h.submission_id > ?
+	AND NOT EXISTS (
+		SELECT 1 FROM submission_history newer
+		WHERE newer.submission_id = h.submission_id AND newer.version_id > h.version_id
+	)
+	ORDER BY h.submission_id
+	LIMIT ?;
+	`
+
+	// selectLastReevaluation statement for Reevaluation
+	selectLastReevaluation = `
+	SELECT reevaluation_id, version, started_at, finished_at, evaluated, changed
+	FROM reevaluations
+	WHERE error IS NULL
+	ORDER BY reevaluation_id DESC
+	LIMIT 1;
+	`
+
+	// selectLatestSubmissionVersion statement for SubmissionVersion
+	selectLatestSubmissionVersion = `
+	SELECT submission, labels FROM submission_history WHERE submission_id = ?
+	ORDER BY version_id DESC LIMIT 1;
+	`
+
+	// selectTicketEvents statement for TicketEvent
+	selectTicketEvents = `
+	SELECT
+		event_id,
+		ticket_id,
+		actor_id,
+		actor,
+		created_at,
+		field,
+		old_value,
+		new_value
+	FROM ticket_events WHERE ticket_id = ?
+	ORDER BY event_id;
+	`
+
+	// selectFileHashesByUser statement for FileHash
+	selectFileHashesByUser = `
+	SELECT
+		file_id,
+		submission_id,
+		user_id,
+		md5,
+		phash,
+		posted_at
+	FROM file_hashes WHERE user_id = ? AND submission_id != ? AND posted_at < ?
+	ORDER BY posted_at;
+	`
 )
 
 func (db Sqlite) GetAuditBySubmissionID(submissionID int64) (Audit, error) {
@@ -368,6 +446,11 @@ func (db Sqlite) GetSubmissionByID(submissionID int64) (Submission, error) {
 }
 
 func (db Sqlite) GetTicketByID(ticketID int64) (Ticket, error) {
+	return scanTicket(db.QueryRowContext(db.context, selectTicketByID, ticketID))
+}
+
+// scanTicket scans a row of selectTicketByID, which can come from a transaction.
+func scanTicket(row *sql.Row) (Ticket, error) {
 	var ticket Ticket
 	var dateOpened string
 	var dateClosed *string
@@ -377,7 +460,7 @@ func (db Sqlite) GetTicketByID(ticketID int64) (Ticket, error) {
 	var submissionIDs []byte
 	var involved []byte
 
-	err := db.QueryRowContext(db.context, selectTicketByID, ticketID).Scan(
+	err := row.Scan(
 		&ticket.ID, &ticket.Subject, &dateOpened, &dateClosed,
 		&ticket.Status, &labels, &ticket.Priority, &flags, &ticket.Closed,
 		&responses, &submissionIDs, &ticket.AssignedID, &involved,
@@ -407,10 +490,20 @@ func (db Sqlite) GetTicketsByStatus(status string) ([]Ticket, error) {
 	return db.ticketsByQuery(selectTicketsByStatus, status)
 }
 
-// GetTicketsByLabel returns a slice of Ticket by label using selectTicketsByLabel
+// GetTicketsByLabel returns a slice of Ticket with the exact label using selectTicketsByLabel
 func (db Sqlite) GetTicketsByLabel(label string) ([]Ticket, error) {
 	label = strings.ReplaceAll(label, " ", "_")
-	return db.ticketsByQuery(selectTicketsByLabel, "%"+label+"%")
+	return db.ticketsByQuery(selectTicketsByLabel, label)
+}
+
+// GetTicketsBySubmission returns every Ticket about the submission
+func (db Sqlite) GetTicketsBySubmission(submissionID int64) ([]Ticket, error) {
+	return db.ticketsByQuery(selectTicketsBySubmission, submissionID)
+}
+
+// GetTicketsByUser returns every Ticket the user reported or was reported in, by user ID or case-insensitive username
+func (db Sqlite) GetTicketsByUser(user string) ([]Ticket, error) {
+	return db.ticketsByQuery(selectTicketsByUser, user, user)
 }
 func (db Sqlite) GetTicketsByPriority(priority string) ([]Ticket, error) {
 	return db.ticketsByQuery(selectTicketsByPriority, priority)
@@ -779,13 +872,184 @@ func (db Sqlite) AllArtists() []Artist {
 
 	var artists []Artist
 	for rows.Next() {
-		var artist Artist
-		err := rows.Scan(&artist.Username, &artist.UserID)
+		var (
+			artist  Artist
+			aliases *string
+		)
+		err := rows.Scan(&artist.Username, &artist.UserID, &aliases)
 		if err != nil {
 			return nil
 		}
+		if aliases != nil {
+			if err := json.Unmarshal([]byte(*aliases), &artist.Aliases); err != nil {
+				return nil
+			}
+		}
 		artists = append(artists, artist)
 	}
 
+	if consents, err := db.GetArtistConsents(""); err == nil {
+		withConsents(artists, consents)
+	}
+
 	return artists
 }
+
+// GetReposts returns the postings by the same user of the file described by hash made before hash.Posted.
+// A posting matches if its MD5 is identical, or its perceptual hash is within maxDistance bits.
+func (db Sqlite) GetReposts(hash FileHash, maxDistance int) ([]Repost, error) {
+	rows, err := db.QueryContext(db.context, selectFileHashesByUser, hash.UserID, hash.SubmissionID, sortableTime(hash.Posted))
+	if err != nil {
+		return nil, fmt.Errorf("error: querying file hashes: %w", err)
+	}
+	defer rows.Close()
+
+	var reposts []Repost
+	for rows.Next() {
+		var (
+			stored FileHash
+			phash  int64
+			posted string
+		)
+		err := rows.Scan(&stored.FileID, &stored.SubmissionID, &stored.UserID, &stored.MD5, &phash, &posted)
+		if err != nil {
+			return nil, fmt.Errorf("error: scanning file hash: %w", err)
+		}
+		stored.PHash = uint64(phash)
+		stored.Posted, err = time.Parse(time.RFC3339Nano, posted)
+		if err != nil {
+			return nil, fmt.Errorf("error: parsing time: %w", err)
+		}
+
+		switch {
+		case stored.MD5 == hash.MD5:
+			reposts = append(reposts, Repost{FileHash: stored})
+		case stored.PHash != 0 && hash.PHash != 0:
+			if distance := HashDistance(stored.PHash, hash.PHash); distance <= maxDistance {
+				reposts = append(reposts, Repost{FileHash: stored, Distance: distance})
+			}
+		}
+	}
+
+	return reposts, rows.Err()
+}
+
+// GetSubmissionHistory returns every stored version of a submission, oldest first.
+func (db Sqlite) GetSubmissionHistory(submissionID int64) ([]SubmissionVersion, error) {
+	rows, err := db.QueryContext(db.context, selectSubmissionHistory, submissionID)
+	if err != nil {
+		return nil, fmt.Errorf("error: querying submission history: %w", err)
+	}
+	defer rows.Close()
+
+	return scanSubmissionVersions(rows)
+}
+
+// GetLatestSubmissionVersions returns the latest stored version of up to limit submissions
+// with an ID above after, by ID. Pass the last ID returned to get the next page.
+func (db Sqlite) GetLatestSubmissionVersions(after int64, limit int) ([]SubmissionVersion, error) {
+	rows, err := db.QueryContext(db.context, selectLatestSubmissionVersions, after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error: querying latest submission versions: %w", err)
+	}
+	defer rows.Close()
+
+	return scanSubmissionVersions(rows)
+}
+
+var ErrMissingReevaluation = errors.New("error: no reevaluation finished")
+
+// GetLastReevaluation returns the last re-evaluation that went through every stored submission,
+// or ErrMissingReevaluation if there was none.
+func (db Sqlite) GetLastReevaluation() (Reevaluation, error) {
+	var (
+		reevaluation      Reevaluation
+		started, finished string
+	)
+	err := db.QueryRowContext(db.context, selectLastReevaluation).Scan(
+		&reevaluation.ID, &reevaluation.Version, &started, &finished, &reevaluation.Evaluated, &reevaluation.Changed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return reevaluation, ErrMissingReevaluation
+	}
+	if err != nil {
+		return reevaluation, fmt.Errorf("error: scanning reevaluation: %w", err)
+	}
+	if reevaluation.Started, err = time.Parse(time.RFC3339Nano, started); err != nil {
+		return reevaluation, fmt.Errorf("error: parsing time: %w", err)
+	}
+	if reevaluation.Finished, err = time.Parse(time.RFC3339Nano, finished); err != nil {
+		return reevaluation, fmt.Errorf("error: parsing time: %w", err)
+	}
+	return reevaluation, nil
+}
+
+func scanSubmissionVersions(rows *sql.Rows) ([]SubmissionVersion, error) {
+	var versions []SubmissionVersion
+	for rows.Next() {
+		var (
+			version    SubmissionVersion
+			storedAt   string
+			submission []byte
+			labels     []byte
+		)
+		err := rows.Scan(&version.ID, &version.SubmissionID, &storedAt, &submission, &labels)
+		if err != nil {
+			return nil, fmt.Errorf("error: scanning submission version: %w", err)
+		}
+		version.StoredAt, err = time.Parse(time.RFC3339Nano, storedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error: parsing time: %w", err)
+		}
+		if err := json.Unmarshal(submission, &version.Submission); err != nil {
+			return nil, fmt.Errorf("error: unmarshalling submission: %w", err)
+		}
+		if len(labels) > 0 {
+			if err := json.Unmarshal(labels, &version.Labels); err != nil {
+				return nil, fmt.Errorf("error: unmarshalling labels: %w", err)
+			}
+		}
+		versions = append(versions, version)
+	}
+
+	return versions, rows.Err()
+}
+
+// GetTicketEvents returns the history of a ticket, oldest first. Deleted tickets keep their history.
+func (db Sqlite) GetTicketEvents(ticketID int64) ([]TicketEvent, error) {
+	rows, err := db.QueryContext(db.context, selectTicketEvents, ticketID)
+	if err != nil {
+		return nil, fmt.Errorf("error: querying ticket events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []TicketEvent
+	for rows.Next() {
+		var (
+			event     TicketEvent
+			actor     *string
+			createdAt string
+			oldValue  *string
+			newValue  *string
+		)
+		err := rows.Scan(&event.ID, &event.TicketID, &event.ActorID, &actor, &createdAt, &event.Field, &oldValue, &newValue)
+		if err != nil {
+			return nil, fmt.Errorf("error: scanning ticket event: %w", err)
+		}
+		event.Time, err = time.Parse(time.RFC3339Nano, createdAt)
+		if err != nil {
+			return nil, fmt.Errorf("error: parsing time: %w", err)
+		}
+		if actor != nil {
+			event.Actor = *actor
+		}
+		if oldValue != nil {
+			event.Old = json.RawMessage(*oldValue)
+		}
+		if newValue != nil {
+			event.New = json.RawMessage(*newValue)
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
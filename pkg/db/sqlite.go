@@ -7,8 +7,7 @@ import (
 	"database/sql"
 	"log"
 	"os"
-	"strconv"
-	"strings"
+	"reflect"
 	"time"
 
 	"github.com/go-errors/errors"
@@ -26,22 +25,45 @@ const (
 type Sqlite struct {
 	*sql.DB
 	context context.Context
+	dialect dialect // placeholders are rewritten for Postgres, set by [NewPostgres]
 }
 
-type migration struct {
-	migrationName  string
-	migrationQuery string
-}
+var (
+	migrations         = migrationsFor(dialectSqlite)
+	postgresMigrations = migrationsFor(dialectPostgres)
+)
 
-var migrations = []migration{
-	{migrationName: "create auditors table", migrationQuery: createAuditors},
-	{migrationName: "create submissions table", migrationQuery: createSubmissions},
-	{migrationName: "create audits table", migrationQuery: createAudits},
-	{migrationName: "create tickets table", migrationQuery: createTickets},
-	{migrationName: "create sids table", migrationQuery: createSIDs},
-	{migrationName: "create models table", migrationQuery: createModels},
-	{migrationName: "create artists table", migrationQuery: createArtists},
-	{migrationName: "create reports table", migrationQuery: createReports},
+// migrationsFor lists every migration in order. The SQL is written for SQLite and translated for d,
+// PostgresUp and PostgresDown replace it where a translation isn't enough.
+func migrationsFor(d dialect) []Migration {
+	list := []Migration{
+		{Name: "create auditors table", Up: createAuditors, Down: `DROP TABLE IF EXISTS auditors;`},
+		{Name: "create submissions table", Up: createSubmissions, Down: `DROP TABLE IF EXISTS submissions;`, PostgresUp: createSubmissionsPG},
+		{Name: "create audits table", Up: createAudits, Down: `DROP TABLE IF EXISTS audits;`, PostgresUp: createAuditsPG},
+		{Name: "create tickets table", Up: createTickets, Down: `DROP TABLE IF EXISTS tickets;`},
+		{Name: "create sids table", Up: createSIDs, Down: `DROP TABLE IF EXISTS sids;`},
+		{Name: "create models table", Up: createModels, Down: `DROP TABLE IF EXISTS models;`},
+		{Name: "create artists table", Up: createArtists, Down: `DROP TABLE IF EXISTS artists;`},
+		{Name: "create reports table", Up: createReports, Down: `DROP TABLE IF EXISTS reports;`},
+		{Name: "create file hashes table", Up: createFileHashes, Down: `DROP TABLE IF EXISTS file_hashes;`},
+		{Name: "create submission history table", Up: createSubmissionHistory, Down: `DROP TABLE IF EXISTS submission_history;`},
+		{Name: "create ticket events table", Up: createTicketEvents, Down: `DROP TABLE IF EXISTS ticket_events;`, PostgresUp: createTicketEventsPG, PostgresDown: dropTicketEventsPG},
+		{Name: "create ticket relation tables", Up: createTicketRelations, Down: dropTicketRelations, UpFunc: backfillTicketRelations(d)},
+		{Name: "create search index", Up: createSearchIndex, Down: `DROP TABLE IF EXISTS search_index;`, UpFunc: backfillSearchIndex(d), PostgresUp: createSearchIndexPG},
+		{Name: "create artist consents table", Up: createArtistConsents, Down: `DROP TABLE IF EXISTS artist_consents;`},
+		{Name: "add artist aliases", Up: `ALTER TABLE artists ADD COLUMN aliases TEXT;`, Down: `ALTER TABLE artists DROP COLUMN aliases;`},
+		{Name: "create characters table", Up: createCharacters, Down: `DROP TABLE IF EXISTS characters;`},
+		{Name: "create parser bindings table", Up: createParserBindings, Down: `DROP TABLE IF EXISTS parser_bindings;`},
+		{Name: "create parser definitions table", Up: createParserDefinitions, Down: `DROP TABLE IF EXISTS parser_definitions;`},
+		{Name: "create rule sets table", Up: createRuleSets, Down: `DROP TABLE IF EXISTS rule_sets;`},
+		{Name: "index submission history versions", Up: createSubmissionHistoryVersionIndex, Down: dropSubmissionHistoryVersionIndex},
+		{Name: "create reevaluations table", Up: createReevaluations, Down: `DROP TABLE IF EXISTS reevaluations;`},
+		{Name: "pad file hash posting times", UpFunc: padFileHashTimes(d)},
+	}
+	for i, m := range list {
+		list[i] = d.render(m)
+	}
+	return list
 }
 
 // sql statements
@@ -146,6 +168,201 @@ const (
 	    report BLOB
 	)
 	`
+
+	// createFileHashes statement for FileHash
+	createFileHashes = `
+	CREATE TABLE IF NOT EXISTS file_hashes (
+		file_id INTEGER PRIMARY KEY,
+		submission_id INTEGER NOT NULL,
+		user_id INTEGER NOT NULL,
+		md5 TEXT NOT NULL,
+--		perceptual hash of the screen image, stored as a signed integer
+		phash INTEGER NOT NULL DEFAULT 0,
+		posted_at TEXT NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS file_hashes_user_id ON file_hashes (user_id);
+	`
+
+	// createSubmissionHistory statement for SubmissionVersion
+	createSubmissionHistory = `
+	CREATE TABLE IF NOT EXISTS submission_history (
+		version_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		submission_id INTEGER NOT NULL,
+		stored_at TEXT NOT NULL,
+--		the full submission including metadata and files as a json string
+		submission BLOB NOT NULL,
+		labels BLOB
+	);
+	CREATE INDEX IF NOT EXISTS submission_history_submission_id ON submission_history (submission_id);
+	`
+
+	// createTicketEvents statement for TicketEvent
+	createTicketEvents = `
+	CREATE TABLE IF NOT EXISTS ticket_events (
+		event_id INTEGER PRIMARY KEY AUTOINCREMENT,
+--		no foreign key, the history outlives deleted tickets
+		ticket_id INTEGER NOT NULL,
+		actor_id INTEGER,
+		actor TEXT,
+		created_at TEXT NOT NULL,
+		field TEXT NOT NULL,
+--		json encoded values
+		old_value TEXT,
+		new_value TEXT
+	);
+	CREATE INDEX IF NOT EXISTS ticket_events_ticket_id ON ticket_events (ticket_id);
+	CREATE TRIGGER IF NOT EXISTS ticket_events_no_update BEFORE UPDATE ON ticket_events
+	BEGIN
+		SELECT RAISE(ABORT, 'ticket_events is append-only');
+	END;
+	CREATE TRIGGER IF NOT EXISTS ticket_events_no_delete BEFORE DELETE ON ticket_events
+	BEGIN
+		SELECT RAISE(ABORT, 'ticket_events is append-only');
+	END;
+	`
+
+	// createTicketRelations statement for the labels, flags, submissions and users of a Ticket.
+	// The json columns in tickets are still written, these tables are for lookups.
+	createTicketRelations = `
+	CREATE TABLE IF NOT EXISTS ticket_labels (
+		ticket_id INTEGER NOT NULL,
+		label TEXT NOT NULL,
+		PRIMARY KEY (ticket_id, label),
+		FOREIGN KEY(ticket_id) REFERENCES tickets(ticket_id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS ticket_labels_label ON ticket_labels (label);
+
+	CREATE TABLE IF NOT EXISTS ticket_flags (
+		ticket_id INTEGER NOT NULL,
+		flag TEXT NOT NULL,
+		PRIMARY KEY (ticket_id, flag),
+		FOREIGN KEY(ticket_id) REFERENCES tickets(ticket_id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS ticket_flags_flag ON ticket_flags (flag);
+
+	CREATE TABLE IF NOT EXISTS ticket_submissions (
+		ticket_id INTEGER NOT NULL,
+		submission_id INTEGER NOT NULL,
+		PRIMARY KEY (ticket_id, submission_id),
+		FOREIGN KEY(ticket_id) REFERENCES tickets(ticket_id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS ticket_submissions_submission_id ON ticket_submissions (submission_id);
+
+	CREATE TABLE IF NOT EXISTS ticket_users (
+		ticket_id INTEGER NOT NULL,
+--		reporter or reported
+		role TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		username TEXT NOT NULL,
+		PRIMARY KEY (ticket_id, role, user_id, username),
+		FOREIGN KEY(ticket_id) REFERENCES tickets(ticket_id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS ticket_users_user_id ON ticket_users (user_id);
+	CREATE INDEX IF NOT EXISTS ticket_users_username ON ticket_users (lower(username));
+	`
+
+	// createSearchIndex statement for SearchHit, see indexSubmission and indexTicket
+	createSearchIndex = `
+	CREATE VIRTUAL TABLE IF NOT EXISTS search_index USING fts5(
+		kind UNINDEXED,
+		ref_id UNINDEXED,
+		title,
+		body,
+		prompts,
+		tokenize = 'unicode61'
+	);
+	`
+
+	// createArtistConsents statement for ArtistConsent
+	createArtistConsents = `
+	CREATE TABLE IF NOT EXISTS artist_consents (
+		consent_id INTEGER PRIMARY KEY AUTOINCREMENT,
+--		not a foreign key, consent can be recorded before the artist is added
+		artist TEXT NOT NULL,
+		granted_by TEXT NOT NULL,
+--		json encoded usernames and character names, empty for everyone and any character
+		users TEXT,
+		characters TEXT,
+		source TEXT,
+		expires_at TEXT,
+		created_at TEXT NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS artist_consents_artist ON artist_consents (lower(artist));
+	`
+
+	// createCharacters statement for Character
+	createCharacters = `
+	CREATE TABLE IF NOT EXISTS characters (
+		character_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+--		json encoded names
+		aliases TEXT,
+		owner TEXT NOT NULL,
+		owner_id INTEGER
+	);
+	CREATE UNIQUE INDEX IF NOT EXISTS characters_name_owner ON characters (lower(name), lower(owner));
+	`
+
+	// createParserBindings statement for ParserBinding
+	createParserBindings = `
+	CREATE TABLE IF NOT EXISTS parser_bindings (
+		binding_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		parser TEXT NOT NULL,
+		user_id INTEGER,
+--		regular expressions, empty to match any file
+		file_pattern TEXT,
+		content_pattern TEXT,
+		priority INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE INDEX IF NOT EXISTS parser_bindings_user_id ON parser_bindings (user_id);
+	`
+
+	// createParserDefinitions statement for ParserDefinition
+	createParserDefinitions = `
+	CREATE TABLE IF NOT EXISTS parser_definitions (
+		definition_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		key_pattern TEXT,
+		split_pattern TEXT,
+--		json encoded field names to regular expressions
+		fields TEXT NOT NULL,
+		author TEXT,
+		active BOOLEAN NOT NULL DEFAULT FALSE,
+		created_at TEXT NOT NULL
+	);
+	`
+
+	// createSubmissionHistoryVersionIndex replaces the submission_id index, which is a prefix of the new one,
+	// see selectLatestSubmissionVersions
+	createSubmissionHistoryVersionIndex = `
+	CREATE INDEX IF NOT EXISTS submission_history_submission_version ON submission_history (submission_id, version_id);
+	DROP INDEX IF EXISTS submission_history_submission_id;
+	`
+
+	dropSubmissionHistoryVersionIndex = `
+	CREATE INDEX IF NOT EXISTS submission_history_submission_id ON submission_history (submission_id);
+	DROP INDEX IF EXISTS submission_history_submission_version;
+	`
+
+	// createReevaluations statement for Reevaluation
+	createReevaluations = `
+	CREATE TABLE IF NOT EXISTS reevaluations (
+		reevaluation_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		version TEXT NOT NULL,
+		started_at TEXT NOT NULL,
+		finished_at TEXT NOT NULL,
+		evaluated INTEGER NOT NULL,
+		changed INTEGER NOT NULL,
+		error TEXT
+	);
+	`
+
+	dropTicketRelations = `
+	DROP TABLE IF EXISTS ticket_labels;
+	DROP TABLE IF EXISTS ticket_flags;
+	DROP TABLE IF EXISTS ticket_submissions;
+	DROP TABLE IF EXISTS ticket_users;
+	`
 )
 
 // New creates a new Sqlite database connection
@@ -154,6 +371,7 @@ const (
 //	context.WithValue(context.Background(), "filename", "audits.sqlite")
 //
 // Alternatively, use context to pass in ":memory:" to create an in-memory database
+// Pending migrations are applied unless "migrate" is set to false, see [Sqlite.MigrateTo]
 func New(ctx context.Context) (*Sqlite, error) {
 	if ctx == nil {
 		ctx = context.Background()
@@ -197,12 +415,14 @@ func New(ctx context.Context) (*Sqlite, error) {
 		return nil, errors.New("failed to set busy timeout")
 	}
 
-	err = migrate(ctx, db)
-	if err != nil {
-		return nil, err
+	if run, ok := ctx.Value("migrate").(bool); !ok || run {
+		err = migrate(ctx, db)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	return &Sqlite{db, ctx}, nil
+	return &Sqlite{DB: db, context: ctx}, nil
 }
 
 func (db Sqlite) Context() context.Context {
@@ -235,73 +455,17 @@ func touchDBFile(filename string) error {
 	return nil
 }
 
-func migrate(ctx context.Context, db *sql.DB) error {
-	var currentMigration int
-
-	row := db.QueryRowContext(ctx, getCurrentMigration)
-
-	err := row.Scan(&currentMigration)
-	if err != nil {
-		return err
-	}
-
-	requiredMigration := len(migrations)
-
-	log.Printf("Current DB version: %v, required DB version: %v\n", currentMigration, requiredMigration)
-
-	if currentMigration < requiredMigration {
-		for migrationNum := currentMigration + 1; migrationNum <= requiredMigration; migrationNum++ {
-			err = execMigration(ctx, db, migrationNum)
-			if err != nil {
-				log.Printf("Error running migration %v '%v'\n", migrationNum, migrations[migrationNum-1].migrationName)
-
-				return err
-			}
-		}
-	}
-
-	return nil
-}
-
-func execMigration(ctx context.Context, db *sql.DB, migrationNum int) error {
-	log.Printf("Running migration %v '%v'\n", migrationNum, migrations[migrationNum-1].migrationName)
-
-	tx, err := db.BeginTx(ctx, nil)
-	if err != nil {
-		return err
-	}
-
-	// nolint
-	defer tx.Rollback()
-
-	_, err = tx.ExecContext(ctx, migrations[migrationNum-1].migrationQuery)
-	if err != nil {
-		return err
-	}
-
-	setQuery := strings.Replace(setCurrentMigration, "?", strconv.Itoa(migrationNum), 1)
-
-	_, err = tx.ExecContext(ctx, setQuery)
-	if err != nil {
-		return err
-	}
-
-	err = tx.Commit()
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
 var nilDatabase = errors.New("database error")
 
 const timeout = 15 * time.Second
 
-func Error(db *Sqlite) error {
+func Error(db Store) error {
 	if db == nil {
 		return nilDatabase
 	}
+	if v := reflect.ValueOf(db); v.Kind() == reflect.Pointer && v.IsNil() {
+		return nilDatabase
+	}
 	ctx, cancel := context.WithTimeout(db.Context(), timeout)
 	defer cancel()
 	return db.PingContext(ctx)
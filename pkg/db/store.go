@@ -0,0 +1,124 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/ellypaws/inkbunny/api"
+)
+
+// Store is the storage used by the API server.
+// [Sqlite] is the default implementation, [Postgres] allows several servers to share a database.
+type Store interface {
+	Context() context.Context
+	PingContext(ctx context.Context) error
+	Close() error
+	Wait()
+
+	MigrationStatus() ([]MigrationStatus, error)
+	MigrateTo(version int, dryRun bool) ([]MigrationStep, error)
+
+	// Auditors
+	InsertAuditor(auditor Auditor) error
+	EditAuditorRole(auditorID int64, role Role) error
+	DeleteAuditor(auditorID int64) error
+	IncreaseAuditCount(auditorID int64) error
+	SyncAuditCount(auditorID int64) error
+	GetAuditorByID(auditorID int64) (Auditor, error)
+	IsInAuditor(auditorID int64) (bool, error)
+	IsAuditorRole(auditorID int64) bool
+	GetRole(auditorID int64) (Role, error)
+	AllAuditors() []Auditor
+
+	// Audits
+	InsertAudit(audit Audit) (int64, error)
+	FixAuditsInSubmissions() error
+	GetAuditBySubmissionID(submissionID int64) (Audit, error)
+	GetAuditByID(auditID int64) (Audit, error)
+	GetAuditsByAuditor(auditorID int64) ([]Audit, error)
+
+	// Submissions
+	InsertFile(file File) error
+	InsertSubmission(submission Submission) error
+	UpdateDescription(submission Submission) error
+	StoreSubmission(submission Submission, labels []TicketLabel) error
+	GetSubmissionByID(submissionID int64) (Submission, error)
+	GetSubmissionHistory(submissionID int64) ([]SubmissionVersion, error)
+	GetLatestSubmissionVersions(after int64, limit int) ([]SubmissionVersion, error)
+	InsertReevaluation(reevaluation Reevaluation) error
+	GetLastReevaluation() (Reevaluation, error)
+	UpsertFileHash(hashes ...FileHash) error
+	GetReposts(hash FileHash, maxDistance int) ([]Repost, error)
+
+	// Tickets
+	InsertTicket(ticket Ticket, actor *Auditor, force ...bool) (int64, error)
+	UpsertTicket(ticket Ticket, actor *Auditor) (int64, error)
+	DeleteTicket(id int64, actor *Auditor) error
+	GetTicketByID(ticketID int64) (Ticket, error)
+	GetTicketsByAuditor(auditorID int64) ([]Ticket, error)
+	GetTicketsByStatus(status string) ([]Ticket, error)
+	GetTicketsByLabel(label string) ([]Ticket, error)
+	GetTicketsBySubmission(submissionID int64) ([]Ticket, error)
+	GetTicketsByUser(user string) ([]Ticket, error)
+	GetTicketsByPriority(priority string) ([]Ticket, error)
+	GetOpenTickets() ([]Ticket, error)
+	GetClosedTickets() ([]Ticket, error)
+	GetAllTickets() ([]Ticket, error)
+	QueryTickets(q TicketQuery) (TicketPage, error)
+	GetTicketEvents(ticketID int64) ([]TicketEvent, error)
+
+	// Search
+	Search(query string, kind string, limit int) ([]SearchHit, error)
+
+	// Reports
+	UpsertTicketReport(ticket TicketReport) error
+	GetTicketReportByKey(key string) (TicketReport, error)
+	GetTicketReport(artist string, date time.Time) (TicketReport, error)
+	GetTicketReports(artist string) ([]TicketReport, error)
+	GetLatestTicketReport(artist string) (TicketReport, error)
+
+	// SIDs
+	InsertSIDHash(sid SIDHash) error
+	RemoveSIDHash(sid SIDHash) error
+	LogoutAll(sid SIDHash) error
+	GetAuditorFromHash(hash string) (Auditor, error)
+	GetUserIDFromSID(sid string) (int64, error)
+	GetHashesFromID(userID int64) (HashID, error)
+	ValidSID(user api.Credentials) bool
+
+	// Models
+	InsertModel(models ModelHashes) error
+	UpsertModel(models ModelHashes) error
+	AllModels() (ModelHashes, error)
+	ModelNamesFromHash(hash string) []string
+
+	// Artists
+	UpsertArtist(artists ...Artist) error
+	DeleteArtist(username string) error
+	AllArtists() []Artist
+	GetArtistConsents(artist string) ([]ArtistConsent, error)
+	UpsertArtistConsent(consent ArtistConsent) (int64, error)
+	DeleteArtistConsent(id int64) error
+
+	// Characters
+	AllCharacters() []Character
+	UpsertCharacter(character Character) (int64, error)
+	DeleteCharacter(id int64) error
+
+	// Parsers
+	AllParserBindings() []ParserBinding
+	UpsertParserBinding(binding ParserBinding) (int64, error)
+	DeleteParserBinding(id int64) error
+	AllParserDefinitions() []ParserDefinition
+	GetParserDefinition(id int64) (ParserDefinition, error)
+	UpsertParserDefinition(definition ParserDefinition) (int64, error)
+
+	// Rules
+	ActivateRuleSet(set RuleSet) (int64, error)
+	GetActiveRuleSet() (RuleSet, error)
+}
+
+var (
+	_ Store = (*Sqlite)(nil)
+	_ Store = (*Postgres)(nil)
+)
@@ -0,0 +1,268 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TicketQuery filters, sorts and paginates tickets for [Sqlite.QueryTickets].
+// Zero values are ignored and every set filter has to match.
+type TicketQuery struct {
+	Status       string
+	Label        TicketLabel // exact label
+	Priority     string
+	Closed       *bool
+	AssignedID   *int64
+	Reported     string // user ID or username of a reported user
+	Reporter     string // user ID or username of the reporter
+	SubmissionID int64
+	OpenedAfter  *time.Time
+	OpenedBefore *time.Time
+	ClosedAfter  *time.Time
+	ClosedBefore *time.Time
+
+	// Sort is id, date_opened, date_closed or priority, prefixed with - for descending order. Defaults to -id, newest first.
+	Sort string
+	// Limit is the page size, between 1 and MaxTicketLimit. Defaults to DefaultTicketLimit.
+	Limit int
+	// Cursor is the NextCursor of the previous page.
+	Cursor string
+}
+
+// TicketPage is a page of tickets. Total counts every ticket matching the filters, not only this page.
+type TicketPage struct {
+	Tickets    []Ticket `json:"tickets"`
+	Total      int      `json:"total"`
+	NextCursor string   `json:"next_cursor,omitempty"`
+}
+
+const (
+	DefaultTicketLimit = 50
+	MaxTicketLimit     = 500
+)
+
+var (
+	ErrInvalidCursor = errors.New("error: invalid cursor")
+	ErrInvalidSort   = errors.New("error: sort must be one of id, date_opened, date_closed or priority")
+)
+
+type ticketSort struct {
+	expr  string
+	value func(Ticket) any
+}
+
+// ticketSorts are the fields tickets can be sorted by, with the value of a ticket used for its cursor.
+var ticketSorts = map[string]ticketSort{
+	"id": {
+		expr:  `ticket_id`,
+		value: func(t Ticket) any { return t.ID },
+	},
+	"date_opened": {
+		expr:  `date_opened`,
+		value: func(t Ticket) any { return parseTime(t.DateOpened) },
+	},
+	"date_closed": {
+		expr: `COALESCE(date_closed, '')`,
+		value: func(t Ticket) any {
+			if t.DateClosed == nil {
+				return ""
+			}
+			return parseTime(*t.DateClosed)
+		},
+	},
+	"priority": {
+		expr:  `CASE priority WHEN 'high' THEN 2 WHEN 'medium' THEN 1 ELSE 0 END`,
+		value: func(t Ticket) any { return priorityRank(t.Priority) },
+	},
+}
+
+func priorityRank(priority string) int64 {
+	switch priority {
+	case "high":
+		return 2
+	case "medium":
+		return 1
+	default:
+		return 0
+	}
+}
+
+// ticketCursor is the position after the last ticket of a page.
+type ticketCursor struct {
+	Sort  string          `json:"s"`
+	Value json.RawMessage `json:"v"`
+	ID    int64           `json:"id"`
+}
+
+const selectTicketColumns = `
+	SELECT
+		ticket_id,
+		subject,
+		date_opened,
+		date_closed,
+		status,
+		labels,
+		priority,
+		flags,
+		closed,
+		responses,
+		submissions_ids,
+		auditor_id,
+		involved
+	FROM tickets`
+
+// QueryTickets returns the page of tickets matching q.
+func (db Sqlite) QueryTickets(q TicketQuery) (TicketPage, error) {
+	sortName, desc := strings.CutPrefix(q.Sort, "-")
+	if sortName == "" {
+		sortName, desc = "id", true
+	}
+	sort, ok := ticketSorts[sortName]
+	if !ok {
+		return TicketPage{}, fmt.Errorf("%w: got %q", ErrInvalidSort, sortName)
+	}
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultTicketLimit
+	}
+	limit = min(limit, MaxTicketLimit)
+
+	where, args := q.where()
+
+	var page TicketPage
+	err := db.QueryRowContext(db.context, `SELECT COUNT(*) FROM tickets`+where, args...).Scan(&page.Total)
+	if err != nil {
+		return page, fmt.Errorf("error: counting tickets: %w", err)
+	}
+
+	if q.Cursor != "" {
+		cursor, err := decodeTicketCursor(q.Cursor)
+		if err != nil || cursor.Sort != q.Sort {
+			return page, ErrInvalidCursor
+		}
+		var value any
+		if sortName == "id" || sortName == "priority" {
+			var n int64
+			err = json.Unmarshal(cursor.Value, &n)
+			value = n
+		} else {
+			var s string
+			err = json.Unmarshal(cursor.Value, &s)
+			value = s
+		}
+		if err != nil {
+			return page, ErrInvalidCursor
+		}
+
+		comparison := ">"
+		if desc {
+			comparison = "<"
+		}
+		where = and(where, fmt.Sprintf("(%s, ticket_id) %s (?, ?)", sort.expr, comparison))
+		args = append(args, value, cursor.ID)
+	}
+
+	order := "ASC"
+	if desc {
+		order = "DESC"
+	}
+	query := fmt.Sprintf("%s%s ORDER BY %s %s, ticket_id %s LIMIT ?", selectTicketColumns, where, sort.expr, order, order)
+
+	page.Tickets, err = db.ticketsByQuery(query, append(args, limit+1)...)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return page, err
+	}
+	if page.Tickets == nil {
+		page.Tickets = []Ticket{}
+	}
+
+	if len(page.Tickets) > limit {
+		page.Tickets = page.Tickets[:limit]
+		last := page.Tickets[limit-1]
+		page.NextCursor = encodeTicketCursor(q.Sort, sort.value(last), last.ID)
+	}
+
+	return page, nil
+}
+
+// where returns the WHERE clause and its arguments for the filters in q.
+func (q TicketQuery) where() (string, []any) {
+	var (
+		where string
+		args  []any
+	)
+	add := func(condition string, arg ...any) {
+		where = and(where, condition)
+		args = append(args, arg...)
+	}
+
+	if q.Status != "" {
+		add(`status = ?`, q.Status)
+	}
+	if q.Priority != "" {
+		add(`priority = ?`, q.Priority)
+	}
+	if q.Closed != nil {
+		add(`closed = ?`, *q.Closed)
+	}
+	if q.AssignedID != nil {
+		add(`auditor_id = ?`, *q.AssignedID)
+	}
+	if q.Label != "" {
+		add(`ticket_id IN (SELECT ticket_id FROM ticket_labels WHERE label = ?)`, string(q.Label))
+	}
+	if q.SubmissionID != 0 {
+		add(`ticket_id IN (SELECT ticket_id FROM ticket_submissions WHERE submission_id = ?)`, q.SubmissionID)
+	}
+	if q.Reporter != "" {
+		add(`ticket_id IN (SELECT ticket_id FROM ticket_users WHERE role = ? AND (user_id = ? OR lower(username) = lower(?)))`,
+			TicketReporter, q.Reporter, q.Reporter)
+	}
+	if q.Reported != "" {
+		add(`ticket_id IN (SELECT ticket_id FROM ticket_users WHERE role = ? AND (user_id = ? OR lower(username) = lower(?)))`,
+			TicketReported, q.Reported, q.Reported)
+	}
+	if q.OpenedAfter != nil {
+		add(`date_opened >= ?`, parseTime(*q.OpenedAfter))
+	}
+	if q.OpenedBefore != nil {
+		add(`date_opened < ?`, parseTime(*q.OpenedBefore))
+	}
+	if q.ClosedAfter != nil {
+		add(`date_closed >= ?`, parseTime(*q.ClosedAfter))
+	}
+	if q.ClosedBefore != nil {
+		add(`date_closed < ?`, parseTime(*q.ClosedBefore))
+	}
+
+	return where, args
+}
+
+func and(where, condition string) string {
+	if where == "" {
+		return " WHERE " + condition
+	}
+	return where + " AND " + condition
+}
+
+func encodeTicketCursor(sort string, value any, id int64) string {
+	v, _ := json.Marshal(value)
+	b, _ := json.Marshal(ticketCursor{Sort: sort, Value: v, ID: id})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeTicketCursor(s string) (ticketCursor, error) {
+	var cursor ticketCursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor, err
+	}
+	err = json.Unmarshal(b, &cursor)
+	return cursor, err
+}